@@ -0,0 +1,158 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/MayCMF/ofs"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// MaxCopyObjectSize the largest object CopyObject could copy, larger objects are copied with multipart UploadPartCopy
+	MaxCopyObjectSize = 5 * 1024 * 1024 * 1024
+	// CopyPartSize size of each part of multipart copies
+	CopyPartSize = 512 * 1024 * 1024
+)
+
+// Copy copy object src to dst inside the bucket with its metadata
+func (client Client) Copy(src, dst string) (*ofs.Object, error) {
+	return client.copyObject(context.Background(), client, src, dst)
+}
+
+// CopyFrom copy object srcPath of another Client using the same endpoint into dstPath server side, other storages are unsupported
+func (client Client) CopyFrom(ctx context.Context, src ofs.StorageInterface, srcPath, dstPath string) (*ofs.Object, error) {
+	var srcClient Client
+	switch storage := src.(type) {
+	case Client:
+		srcClient = storage
+	case *Client:
+		srcClient = *storage
+	default:
+		return nil, ofs.NewError("copy", srcPath, ofs.ErrUnsupported, nil)
+	}
+
+	if srcClient.S3 == nil || client.S3 == nil || srcClient.S3.Endpoint != client.S3.Endpoint {
+		return nil, ofs.NewError("copy", srcPath, ofs.ErrUnsupported, nil)
+	}
+	return client.copyObject(ctx, srcClient, srcPath, dstPath)
+}
+
+// Move move object src to dst inside the bucket with its metadata, S3 has no rename, the object is copied then deleted
+func (client Client) Move(src, dst string) (*ofs.Object, error) {
+	object, err := client.Copy(src, dst)
+	if err != nil {
+		return nil, err
+	}
+	return object, client.Delete(src)
+}
+
+// copyObject server side copy of object src of srcClient's bucket to dst
+func (client Client) copyObject(ctx context.Context, srcClient Client, src, dst string) (*ofs.Object, error) {
+	var (
+		srcKey     = strings.TrimPrefix(srcClient.ToRelativePath(src), "/")
+		dstKey     = client.ToRelativePath(dst)
+		copySource = escapeCopySource(srcClient.Config.Bucket + "/" + srcKey)
+	)
+
+	srcObject, err := srcClient.headObject(ctx, srcKey)
+	if err != nil {
+		return nil, wrapError(ctx, "copy", src, err)
+	}
+
+	if aws.Int64Value(srcObject.ContentLength) > MaxCopyObjectSize {
+		err = client.multipartCopy(ctx, copySource, dstKey, srcObject)
+	} else {
+		_, err = client.S3.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+			Bucket:            aws.String(client.Config.Bucket),
+			Key:               aws.String(dstKey),
+			CopySource:        aws.String(copySource),
+			ACL:               aws.String(client.Config.ACL),
+			MetadataDirective: aws.String(s3.MetadataDirectiveCopy),
+		})
+	}
+	if err != nil {
+		return nil, wrapError(ctx, "copy", dst, err)
+	}
+	return client.StatWithContext(ctx, dstKey)
+}
+
+func (client Client) headObject(ctx context.Context, key string) (*s3.HeadObjectOutput, error) {
+	return client.S3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(client.Config.Bucket),
+		Key:    aws.String(key),
+	})
+}
+
+// multipartCopy copy objects larger than MaxCopyObjectSize part by part, the upload is aborted if any part fails
+func (client Client) multipartCopy(ctx context.Context, copySource, dstKey string, srcObject *s3.HeadObjectOutput) error {
+	upload, err := client.S3.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:             aws.String(client.Config.Bucket),
+		Key:                aws.String(dstKey),
+		ACL:                aws.String(client.Config.ACL),
+		CacheControl:       srcObject.CacheControl,
+		ContentDisposition: srcObject.ContentDisposition,
+		ContentEncoding:    srcObject.ContentEncoding,
+		ContentType:        srcObject.ContentType,
+		Metadata:           srcObject.Metadata,
+	})
+	if err != nil {
+		return err
+	}
+
+	var (
+		size  = aws.Int64Value(srcObject.ContentLength)
+		parts []*s3.CompletedPart
+	)
+
+	for offset, number := int64(0), int64(1); offset < size; offset, number = offset+CopyPartSize, number+1 {
+		end := offset + CopyPartSize - 1
+		if end >= size {
+			end = size - 1
+		}
+
+		var part *s3.UploadPartCopyOutput
+		part, err = client.S3.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:          aws.String(client.Config.Bucket),
+			Key:             aws.String(dstKey),
+			CopySource:      aws.String(copySource),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", offset, end)),
+			PartNumber:      aws.Int64(number),
+			UploadId:        upload.UploadId,
+		})
+		if err != nil {
+			break
+		}
+		parts = append(parts, &s3.CompletedPart{ETag: part.CopyPartResult.ETag, PartNumber: aws.Int64(number)})
+	}
+
+	if err == nil {
+		_, err = client.S3.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(client.Config.Bucket),
+			Key:             aws.String(dstKey),
+			UploadId:        upload.UploadId,
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+		})
+	}
+
+	if err != nil {
+		client.S3.AbortMultipartUploadWithContext(context.Background(), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(client.Config.Bucket),
+			Key:      aws.String(dstKey),
+			UploadId: upload.UploadId,
+		})
+	}
+	return err
+}
+
+// escapeCopySource URL-encode bucket/key for CopySource, keeping the slashes
+func escapeCopySource(source string) string {
+	segments := strings.Split(source, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
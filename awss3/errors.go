@@ -0,0 +1,52 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/MayCMF/ofs"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// wrapError classify AWS errors as ofs errors, the original awserr.Error stays reachable with errors.As
+func wrapError(ctx context.Context, op, path string, err error) error {
+	var ofsErr *ofs.Error
+	if err == nil || errors.As(err, &ofsErr) {
+		return err
+	}
+
+	var kind error
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case s3.ErrCodeNoSuchKey, s3.ErrCodeNoSuchBucket, s3.ErrCodeNoSuchUpload, "NotFound":
+			kind = ofs.ErrNotFound
+		case "AccessDenied", "Forbidden", "AllAccessDisabled":
+			kind = ofs.ErrPermission
+		case "KeyTooLongError", "InvalidObjectName":
+			kind = ofs.ErrInvalidPath
+		case "NotImplemented":
+			kind = ofs.ErrUnsupported
+		case request.CanceledErrorCode:
+			kind = ctx.Err()
+		}
+
+		if reqErr, ok := err.(awserr.RequestFailure); ok && kind == nil {
+			switch reqErr.StatusCode() {
+			case http.StatusNotFound:
+				kind = ofs.ErrNotFound
+			case http.StatusForbidden:
+				kind = ofs.ErrPermission
+			case http.StatusNotImplemented:
+				kind = ofs.ErrUnsupported
+			}
+		}
+	}
+
+	if kind == nil && ctx.Err() != nil {
+		kind = ctx.Err()
+	}
+	return ofs.NewError(op, path, kind, err)
+}
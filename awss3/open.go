@@ -0,0 +1,66 @@
+package s3
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/MayCMF/ofs"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func init() {
+	ofs.Register("s3", Open)
+}
+
+// Open initialize S3 storage from a URL like `s3://bucket/prefix?region=eu-west-1&acl=private`, it is registered as scheme `s3` of ofs.Open,
+// a prefix confines the storage to the objects under it with ofs.WithPrefix,
+// static credentials are given as user info, `s3://access_id:access_key@bucket`, the default credentials are used otherwise, parameters:
+//
+//	region          Region
+//	acl             ACL, one of the canned object ACLs
+//	endpoint        Endpoint
+//	s3_endpoint     S3Endpoint, e.g. of S3 compatible services
+//	path_style      S3ForcePathStyle
+//	cache_control   CacheControl
+//	session_token   SessionToken
+//	role_arn        RoleARN
+//	part_size       UploadPartSize
+//	concurrency     UploadConcurrency
+//	read_ahead      ReadAheadSize
+func Open(u *url.URL) (ofs.StorageInterface, error) {
+	if u.Host == "" {
+		return nil, errors.New("missing bucket, e.g. s3://bucket")
+	}
+	params := ofs.NewURLParams(u)
+	config := &Config{
+		Bucket:            u.Host,
+		Region:            params.String("region"),
+		ACL:               params.OneOf("acl", s3.ObjectCannedACL_Values()...),
+		Endpoint:          params.String("endpoint"),
+		S3Endpoint:        params.String("s3_endpoint"),
+		S3ForcePathStyle:  params.Bool("path_style"),
+		CacheControl:      params.String("cache_control"),
+		SessionToken:      params.String("session_token"),
+		RoleARN:           params.String("role_arn"),
+		UploadPartSize:    params.Int64("part_size"),
+		UploadConcurrency: int(params.Int64("concurrency")),
+		ReadAheadSize:     params.Int64("read_ahead"),
+	}
+	if err := params.Err(); err != nil {
+		return nil, err
+	}
+
+	if u.User != nil {
+		config.AccessID = u.User.Username()
+		config.AccessKey, _ = u.User.Password()
+		if config.AccessID == "" || config.AccessKey == "" {
+			return nil, errors.New("credentials need both access id and access key, e.g. s3://access_id:access_key@bucket")
+		}
+	}
+
+	if prefix := strings.Trim(u.Path, "/"); prefix != "" {
+		return ofs.WithPrefix(New(config), prefix), nil
+	}
+	return New(config), nil
+}
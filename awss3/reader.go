@@ -0,0 +1,166 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/MayCMF/ofs"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// DefaultReadAheadSize default minimum size of Range GETs made by readers from OpenReaderAt
+const DefaultReadAheadSize = 256 * 1024
+
+// GetRange get length bytes of the object starting at offset, or till the end if length is negative, with a Range GET
+func (client Client) GetRange(path string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 {
+		return nil, ofs.NewError("get range", path, ofs.ErrInvalidPath, fmt.Errorf("negative offset %d", offset))
+	}
+	if length == 0 {
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+
+	ctx := context.Background()
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length > 0 {
+		byteRange = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	}
+
+	getResponse, err := client.S3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(client.Config.Bucket),
+		Key:    aws.String(client.ToRelativePath(path)),
+		Range:  aws.String(byteRange),
+	})
+	if err != nil {
+		return nil, wrapError(ctx, "get range", path, err)
+	}
+	return getResponse.Body, nil
+}
+
+// OpenReaderAt open a random access reader of the object, reads are served by Range GETs of at least Config.ReadAheadSize bytes
+func (client Client) OpenReaderAt(path string) (ofs.ObjectReader, error) {
+	object, err := client.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	readAhead := client.Config.ReadAheadSize
+	if readAhead <= 0 {
+		readAhead = DefaultReadAheadSize
+	}
+	return &objectReader{client: client, path: path, size: object.Size, readAhead: readAhead}, nil
+}
+
+// objectReader random access reader backed by Range GETs, keeps the last fetched range as read-ahead buffer
+type objectReader struct {
+	client    Client
+	path      string
+	size      int64
+	readAhead int64
+	offset    int64
+
+	mutex        sync.Mutex
+	buffer       []byte
+	bufferOffset int64
+}
+
+func (reader *objectReader) Size() int64 {
+	return reader.size
+}
+
+func (reader *objectReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("s3: negative offset")
+	}
+
+	var n int
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= reader.size {
+			return n, io.EOF
+		}
+
+		copied, err := reader.readBuffered(p[n:], pos)
+		if err != nil {
+			return n, err
+		}
+		n += copied
+	}
+	return n, nil
+}
+
+// readBuffered copy data at pos from the buffer, fetch a new range first if pos isn't buffered
+func (reader *objectReader) readBuffered(p []byte, pos int64) (int, error) {
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+
+	if pos < reader.bufferOffset || pos >= reader.bufferOffset+int64(len(reader.buffer)) {
+		length := int64(len(p))
+		if length < reader.readAhead {
+			length = reader.readAhead
+		}
+		if pos+length > reader.size {
+			length = reader.size - pos
+		}
+
+		body, err := reader.client.GetRange(reader.path, pos, length)
+		if err != nil {
+			return 0, err
+		}
+		buffer, err := ioutil.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return 0, err
+		}
+		if len(buffer) == 0 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		reader.buffer, reader.bufferOffset = buffer, pos
+	}
+
+	return copy(p, reader.buffer[pos-reader.bufferOffset:]), nil
+}
+
+func (reader *objectReader) Read(p []byte) (int, error) {
+	if reader.offset >= reader.size {
+		return 0, io.EOF
+	}
+
+	n, err := reader.ReadAt(p, reader.offset)
+	reader.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (reader *objectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += reader.offset
+	case io.SeekEnd:
+		offset += reader.size
+	default:
+		return 0, errors.New("s3: invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("s3: negative position")
+	}
+	reader.offset = offset
+	return offset, nil
+}
+
+func (reader *objectReader) Close() error {
+	reader.mutex.Lock()
+	reader.buffer = nil
+	reader.mutex.Unlock()
+	return nil
+}
@@ -2,6 +2,8 @@ package s3
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -12,6 +14,7 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -22,7 +25,8 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
 	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3s"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
 // Client S3 storage
@@ -44,6 +48,13 @@ type Config struct {
 	S3ForcePathStyle bool
 	CacheControl     string
 
+	// UploadPartSize size of each part of multipart uploads, s3manager.DefaultUploadPartSize (5MB) if zero
+	UploadPartSize int64
+	// UploadConcurrency number of parts uploaded in parallel, s3manager.DefaultUploadConcurrency if zero
+	UploadConcurrency int
+	// ReadAheadSize minimum size of Range GETs made by readers from OpenReaderAt, DefaultReadAheadSize if zero
+	ReadAheadSize int64
+
 	Session *session.Session
 
 	RoleARN string
@@ -117,7 +128,12 @@ func New(config *Config) *Client {
 
 // Get receive file with given path
 func (client Client) Get(path string) (file *os.File, err error) {
-	readCloser, err := client.GetStream(path)
+	return client.GetWithContext(context.Background(), path)
+}
+
+// GetWithContext receive file with given path
+func (client Client) GetWithContext(ctx context.Context, path string) (file *os.File, err error) {
+	readCloser, err := client.GetStreamWithContext(ctx, path)
 
 	ext := filepath.Ext(path)
 	pattern := fmt.Sprintf("s3*%s", ext)
@@ -135,62 +151,166 @@ func (client Client) Get(path string) (file *os.File, err error) {
 
 // GetStream get file as stream
 func (client Client) GetStream(path string) (io.ReadCloser, error) {
-	getResponse, err := client.S3.GetObject(&s3.GetObjectInput{
+	return client.GetStreamWithContext(context.Background(), path)
+}
+
+// GetStreamWithContext get file as stream
+func (client Client) GetStreamWithContext(ctx context.Context, path string) (io.ReadCloser, error) {
+	getResponse, err := client.S3.GetObjectWithContext(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(client.Config.Bucket),
 		Key:    aws.String(client.ToRelativePath(path)),
 	})
 
-	return getResponse.Body, err
+	if err != nil {
+		return nil, wrapError(ctx, "get", path, err)
+	}
+	return getResponse.Body, nil
 }
 
 // Put store a reader into given path
 func (client Client) Put(urlPath string, reader io.Reader) (*ofs.Object, error) {
+	return client.PutWithContext(context.Background(), urlPath, reader)
+}
+
+// PutWithContext store a reader into given path
+func (client Client) PutWithContext(ctx context.Context, urlPath string, reader io.Reader) (*ofs.Object, error) {
+	return client.PutWithOptions(ctx, urlPath, reader, nil)
+}
+
+// PutWithOptions store a reader into given path, options override Config's ACL and CacheControl,
+// options.CreateOnly is checked with a HEAD request before uploading, so concurrent writers could still overwrite each other
+func (client Client) PutWithOptions(ctx context.Context, urlPath string, reader io.Reader, options *ofs.PutOptions) (*ofs.Object, error) {
 	if seeker, ok := reader.(io.ReadSeeker); ok {
 		seeker.Seek(0, 0)
 	}
 
+	if options == nil {
+		options = &ofs.PutOptions{}
+	}
+
 	urlPath = client.ToRelativePath(urlPath)
-	buffer, err := ioutil.ReadAll(reader)
 
-	fileType := mime.TypeByExtension(path.Ext(urlPath))
+	if options.CreateOnly {
+		if _, err := client.headObject(ctx, urlPath); err == nil {
+			return nil, ofs.NewError("put", urlPath, ofs.ErrExists, nil)
+		} else if err = wrapError(ctx, "put", urlPath, err); !errors.Is(err, ofs.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	// only sniff the head of the content, the body is streamed to S3 in parts
+	head := make([]byte, 512)
+	n, err := io.ReadFull(ofs.ContextReader(ctx, reader), head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, wrapError(ctx, "put", urlPath, err)
+	}
+	head = head[:n]
+
+	fileType := options.ContentType
 	if fileType == "" {
-		fileType = http.DetectContentType(buffer)
+		fileType = mime.TypeByExtension(path.Ext(urlPath))
+	}
+	if fileType == "" {
+		fileType = http.DetectContentType(head)
+	}
+
+	acl := options.ACL
+	if acl == "" {
+		acl = client.Config.ACL
 	}
 
-	params := &s3.PutObjectInput{
-		Bucket:        aws.String(client.Config.Bucket), // required
-		Key:           aws.String(urlPath),              // required
-		ACL:           aws.String(client.Config.ACL),
-		Body:          bytes.NewReader(buffer),
-		ContentLength: aws.Int64(int64(len(buffer))),
-		ContentType:   aws.String(fileType),
+	body := &countingReader{reader: io.MultiReader(bytes.NewReader(head), reader)}
+	params := &s3manager.UploadInput{
+		Bucket:      aws.String(client.Config.Bucket), // required
+		Key:         aws.String(urlPath),              // required
+		ACL:         aws.String(acl),
+		Body:        body,
+		ContentType: aws.String(fileType),
 	}
-	if client.Config.CacheControl != "" {
+	if cacheControl := options.CacheControl; cacheControl != "" {
+		params.CacheControl = aws.String(cacheControl)
+	} else if client.Config.CacheControl != "" {
 		params.CacheControl = aws.String(client.Config.CacheControl)
 	}
+	if options.ContentDisposition != "" {
+		params.ContentDisposition = aws.String(options.ContentDisposition)
+	}
+	if options.ContentEncoding != "" {
+		params.ContentEncoding = aws.String(options.ContentEncoding)
+	}
+	if metadata := options.NormalizedMetadata(); metadata != nil {
+		params.Metadata = aws.StringMap(metadata)
+	}
 
-	_, err = client.S3.PutObject(params)
+	// incomplete multipart uploads are aborted by the uploader on failure
+	_, err = client.uploader().UploadWithContext(ctx, params)
 
 	now := time.Now()
 	return &ofs.Object{
-		Path:             urlPath,
-		Name:             filepath.Base(urlPath),
-		LastModified:     &now,
-		StorageInterface: client,
-	}, err
+		Path:               urlPath,
+		Name:               filepath.Base(urlPath),
+		LastModified:       &now,
+		Size:               body.n,
+		ContentType:        fileType,
+		ContentDisposition: options.ContentDisposition,
+		ContentEncoding:    options.ContentEncoding,
+		CacheControl:       aws.StringValue(params.CacheControl),
+		Metadata:           options.NormalizedMetadata(),
+		StorageInterface:   client,
+	}, wrapError(ctx, "put", urlPath, err)
+}
+
+// OpenWriter open a writer that streams into a multipart upload, Close reports the upload's error, Abort cancels the upload
+func (client Client) OpenWriter(path string, options *ofs.PutOptions) (ofs.Writer, error) {
+	return ofs.NewPipeWriter(context.Background(), func(ctx context.Context, reader io.Reader) error {
+		_, err := client.PutWithOptions(ctx, path, reader, options)
+		return err
+	}), nil
+}
+
+func (client Client) uploader() *s3manager.Uploader {
+	return s3manager.NewUploaderWithClient(client.S3, func(uploader *s3manager.Uploader) {
+		if client.Config.UploadPartSize > 0 {
+			uploader.PartSize = client.Config.UploadPartSize
+		}
+		if client.Config.UploadConcurrency > 0 {
+			uploader.Concurrency = client.Config.UploadConcurrency
+		}
+	})
+}
+
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += int64(n)
+	return n, err
 }
 
 // Delete delete file
 func (client Client) Delete(path string) error {
-	_, err := client.S3.DeleteObject(&s3.DeleteObjectInput{
+	return client.DeleteWithContext(context.Background(), path)
+}
+
+// DeleteWithContext delete file
+func (client Client) DeleteWithContext(ctx context.Context, path string) error {
+	_, err := client.S3.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(client.Config.Bucket),
 		Key:    aws.String(client.ToRelativePath(path)),
 	})
-	return err
+	return wrapError(ctx, "delete", path, err)
 }
 
 // List list all objects under current path
 func (client Client) List(path string) ([]*ofs.Object, error) {
+	return client.ListWithContext(context.Background(), path)
+}
+
+// ListWithContext list all objects under current path, staged tails of resumable uploads are left out, see UploadStagingPrefix
+func (client Client) ListWithContext(ctx context.Context, path string) ([]*ofs.Object, error) {
 	var objects []*ofs.Object
 	var prefix string
 
@@ -198,23 +318,127 @@ func (client Client) List(path string) ([]*ofs.Object, error) {
 		prefix = strings.Trim(path, "/") + "/"
 	}
 
-	listObjectsResponse, err := client.S3.ListObjectsV2(&s3.ListObjectsV2Input{
+	err := client.S3.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
 		Bucket: aws.String(client.Config.Bucket),
 		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, content := range page.Contents {
+			if !isStaged(aws.StringValue(content.Key), path) {
+				objects = append(objects, client.toObject(content))
+			}
+		}
+		return true
 	})
 
-	if err == nil {
-		for _, content := range listObjectsResponse.Contents {
-			objects = append(objects, &ofs.Object{
-				Path:             client.ToRelativePath(*content.Key),
-				Name:             filepath.Base(*content.Key),
-				LastModified:     content.LastModified,
-				StorageInterface: client,
-			})
+	return objects, wrapError(ctx, "list", path, err)
+}
+
+// ListPage list one page of entries under path, common prefixes are returned as directory entries when not listing recursively,
+// staged tails of resumable uploads are left out, so pages may hold fewer than MaxKeys entries
+func (client Client) ListPage(ctx context.Context, path string, options ofs.ListOptions) (*ofs.ListResult, error) {
+	var (
+		result  = &ofs.ListResult{}
+		maxKeys = options.MaxKeys
+		params  = &s3.ListObjectsV2Input{
+			Bucket: aws.String(client.Config.Bucket),
+			Prefix: aws.String(strings.TrimPrefix(ofs.DirPrefix(path), "/")),
+		}
+	)
+
+	if maxKeys <= 0 {
+		maxKeys = ofs.DefaultMaxKeys
+	}
+	params.MaxKeys = aws.Int64(int64(maxKeys))
+
+	if !options.Recursive {
+		params.Delimiter = aws.String("/")
+	}
+	if options.StartAfter != "" {
+		params.StartAfter = aws.String(strings.TrimPrefix(options.StartAfter, "/"))
+	}
+	if options.ContinuationToken != "" {
+		params.ContinuationToken = aws.String(options.ContinuationToken)
+	}
+
+	listObjectsResponse, err := client.S3.ListObjectsV2WithContext(ctx, params)
+	if err != nil {
+		return nil, wrapError(ctx, "list", path, err)
+	}
+
+	for _, content := range listObjectsResponse.Contents {
+		if !isStaged(aws.StringValue(content.Key), path) {
+			result.Objects = append(result.Objects, client.toObject(content))
+		}
+	}
+	for _, commonPrefix := range listObjectsResponse.CommonPrefixes {
+		key := aws.StringValue(commonPrefix.Prefix)
+		if isStaged(key, path) {
+			continue
 		}
+		result.Objects = append(result.Objects, &ofs.Object{
+			Path:             "/" + key,
+			Name:             filepath.Base(key),
+			IsDir:            true,
+			StorageInterface: client,
+		})
 	}
+	sort.Slice(result.Objects, func(i, j int) bool { return result.Objects[i].Path < result.Objects[j].Path })
 
-	return objects, err
+	if aws.BoolValue(listObjectsResponse.IsTruncated) {
+		result.NextContinuationToken = aws.StringValue(listObjectsResponse.NextContinuationToken)
+	}
+	return result, nil
+}
+
+func (client Client) toObject(content *s3.Object) *ofs.Object {
+	return &ofs.Object{
+		Path:             client.ToRelativePath(*content.Key),
+		Name:             filepath.Base(*content.Key),
+		LastModified:     content.LastModified,
+		Size:             aws.Int64Value(content.Size),
+		ETag:             strings.Trim(aws.StringValue(content.ETag), `"`),
+		StorageInterface: client,
+	}
+}
+
+// Stat get object's metadata with a HEAD request
+func (client Client) Stat(path string) (*ofs.Object, error) {
+	return client.StatWithContext(context.Background(), path)
+}
+
+// StatWithContext get object's metadata with a HEAD request
+func (client Client) StatWithContext(ctx context.Context, path string) (*ofs.Object, error) {
+	key := client.ToRelativePath(path)
+	headResponse, err := client.S3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(client.Config.Bucket),
+		Key:    aws.String(key),
+	})
+
+	if err != nil {
+		return nil, wrapError(ctx, "stat", path, err)
+	}
+
+	var metadata map[string]string
+	for key, value := range headResponse.Metadata {
+		if metadata == nil {
+			metadata = map[string]string{}
+		}
+		metadata[strings.ToLower(key)] = aws.StringValue(value)
+	}
+
+	return &ofs.Object{
+		Path:               key,
+		Name:               filepath.Base(key),
+		LastModified:       headResponse.LastModified,
+		Size:               aws.Int64Value(headResponse.ContentLength),
+		ContentType:        aws.StringValue(headResponse.ContentType),
+		ContentDisposition: aws.StringValue(headResponse.ContentDisposition),
+		ContentEncoding:    aws.StringValue(headResponse.ContentEncoding),
+		CacheControl:       aws.StringValue(headResponse.CacheControl),
+		ETag:               strings.Trim(aws.StringValue(headResponse.ETag), `"`),
+		Metadata:           metadata,
+		StorageInterface:   client,
+	}, nil
 }
 
 // GetEndpoint get endpoint, FileSystem's endpoint is /
@@ -245,23 +469,29 @@ func (client Client) ToRelativePath(urlPath string) string {
 	}
 
 	if client.Config.S3ForcePathStyle { // First part of path will be bucket name
-		return "/" + strings.TrimPrefix(urlPath, "/"+client.Config.Bucket+"/")
+		return "/" + strings.TrimPrefix(strings.TrimPrefix(urlPath, "/"+client.Config.Bucket+"/"), "/")
 	}
 	return "/" + strings.TrimPrefix(urlPath, "/")
 }
 
 // GetURL get public accessible URL
 func (client Client) GetURL(path string) (url string, err error) {
-	if client.Endpoint == "" {
+	return client.GetURLWithContext(context.Background(), path)
+}
+
+// GetURLWithContext get public accessible URL
+func (client Client) GetURLWithContext(ctx context.Context, path string) (url string, err error) {
+	if client.Config.Endpoint == "" {
 		if client.Config.ACL == s3.BucketCannedACLPrivate || client.Config.ACL == s3.BucketCannedACLAuthenticatedRead {
 			getResponse, _ := client.S3.GetObjectRequest(&s3.GetObjectInput{
 				Bucket: aws.String(client.Config.Bucket),
 				Key:    aws.String(client.ToRelativePath(path)),
 			})
+			getResponse.SetContext(ctx)
 
 			return getResponse.Presign(1 * time.Hour)
 		}
 	}
 
-	return path, nil
+	return path, ctx.Err()
 }
@@ -1,13 +1,24 @@
 package s3_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	s3 "github.com/MayCMF/ofs/awss3"
+	"github.com/MayCMF/ofs"
+	"github.com/MayCMF/ofs/awss3/s3test"
+	"github.com/MayCMF/ofs/ofstest"
 	awss3 "github.com/aws/aws-sdk-go/service/s3"
 	"github.com/jinzhu/configor"
-	"github.com/qor/oss/s3"
-	"github.com/qor/oss/tests"
 )
 
 type Config struct {
@@ -30,16 +41,97 @@ func init() {
 }
 
 func TestAll(t *testing.T) {
+	server := s3test.NewServer("ofs")
+	defer server.Close()
+
+	for _, acl := range []string{awss3.BucketCannedACLPublicRead, awss3.BucketCannedACLPrivate, awss3.BucketCannedACLAuthenticatedRead} {
+		fmt.Printf("testing fake S3 with %v ACL\n", acl)
+		s3Config := server.Config("ofs")
+		s3Config.ACL = acl
+		ofstest.TestAll(s3.New(s3Config), t)
+	}
+
+	if server.PendingUploads() != 0 {
+		t.Errorf("all multipart uploads should be completed or aborted, but %v are pending", server.PendingUploads())
+	}
+}
+
+func TestAllWithAWS(t *testing.T) {
+	if config.Bucket == "" {
+		t.Skip("QOR_AWS_BUCKET isn't set")
+	}
+
 	fmt.Println("testing S3 with public ACL")
-	tests.TestAll(client, t)
+	ofstest.TestAll(client, t)
 
 	fmt.Println("testing S3 with private ACL")
 	privateClient := s3.New(&s3.Config{AccessID: config.AccessID, AccessKey: config.AccessKey, Region: config.Region, Bucket: config.Bucket, ACL: awss3.BucketCannedACLPrivate, Endpoint: config.Endpoint})
-	tests.TestAll(privateClient, t)
+	ofstest.TestAll(privateClient, t)
 
 	fmt.Println("testing S3 with AuthenticatedRead ACL")
 	authenticatedReadClient := s3.New(&s3.Config{AccessID: config.AccessID, AccessKey: config.AccessKey, Region: config.Region, Bucket: config.Bucket, ACL: awss3.BucketCannedACLAuthenticatedRead, Endpoint: config.Endpoint})
-	tests.TestAll(authenticatedReadClient, t)
+	ofstest.TestAll(authenticatedReadClient, t)
+}
+
+func TestPresignedURL(t *testing.T) {
+	server := s3test.NewServer("ofs")
+	defer server.Close()
+
+	s3Config := server.Config("ofs")
+	s3Config.ACL = awss3.BucketCannedACLPrivate
+	client := s3.New(s3Config)
+
+	if _, err := client.Put("/private.txt", strings.NewReader("private content")); err != nil {
+		t.Fatalf("Put fail %v", err)
+	}
+
+	url, err := client.GetURL("/private.txt")
+	if err != nil || !strings.Contains(url, "X-Amz-Signature=") {
+		t.Fatalf("private object should have a presigned URL, but got %v, %v", url, err)
+	}
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Get presigned URL fail %v", err)
+	}
+	defer resp.Body.Close()
+
+	if data, _ := ioutil.ReadAll(resp.Body); string(data) != "private content" {
+		t.Errorf("presigned URL should serve the object, but got %q", data)
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	server := s3test.NewServer("ofs")
+	defer server.Close()
+
+	s3Config := server.Config("ofs")
+	s3Config.UploadPartSize = 5 * 1024 * 1024
+	client := s3.New(s3Config)
+
+	content := strings.Repeat("0123456789", 1024*1024+1)
+	if _, err := client.Put("/large.txt", strings.NewReader(content)); err != nil {
+		t.Fatalf("Put fail %v", err)
+	}
+
+	object, err := client.Stat("/large.txt")
+	if err != nil || object.Size != int64(len(content)) || !strings.HasSuffix(object.ETag, "-3") {
+		t.Errorf("large object should be uploaded in 3 parts, but got %+v, %v", object, err)
+	}
+
+	writer, err := client.OpenWriter("/aborted.txt", nil)
+	if err != nil {
+		t.Fatalf("OpenWriter fail %v", err)
+	}
+	writer.Write([]byte(content))
+	writer.Abort()
+
+	if _, err := client.Stat("/aborted.txt"); err == nil {
+		t.Errorf("aborted upload shouldn't create the object")
+	}
+	if server.PendingUploads() != 0 {
+		t.Errorf("aborted multipart upload should be cleaned up, but %v are pending", server.PendingUploads())
+	}
 }
 
 func TestToRelativePath(t *testing.T) {
@@ -76,3 +168,203 @@ func TestToRelativePathWithS3ForcePathStyle(t *testing.T) {
 		}
 	}
 }
+
+func TestOpen(t *testing.T) {
+	server := s3test.NewServer("ofs")
+	defer server.Close()
+
+	storage, err := ofs.Open("s3://access_id:access_key@ofs?region=us-east-1&acl=private&path_style&part_size=6291456&s3_endpoint=" + server.URL)
+	if err != nil {
+		t.Fatalf("Open fail %v", err)
+	}
+
+	client, ok := storage.(*s3.Client)
+	if !ok || client.Config.Bucket != "ofs" || client.Config.ACL != "private" || !client.Config.S3ForcePathStyle ||
+		client.Config.UploadPartSize != 6291456 || client.Config.AccessID != "access_id" || client.Config.AccessKey != "access_key" {
+		t.Fatalf("parameters should be mapped onto Config, but got %#v", storage)
+	}
+
+	if _, err := storage.Put("/open.txt", strings.NewReader("opened")); err != nil {
+		t.Errorf("Put fail %v", err)
+	}
+
+	prefixed, err := ofs.Open("s3://access_id:access_key@ofs/tenants/1?region=us-east-1&path_style&s3_endpoint=" + server.URL)
+	if err != nil {
+		t.Fatalf("Open fail %v", err)
+	}
+	if object, err := prefixed.Stat("/../open.txt"); !errors.Is(err, ofs.ErrInvalidPath) {
+		t.Errorf("prefixed storage shouldn't escape its prefix, but got %v %v", object, err)
+	}
+	if _, err := prefixed.Put("/open.txt", strings.NewReader("tenant")); err != nil {
+		t.Errorf("Put fail %v", err)
+	}
+	if _, err := client.Stat("/tenants/1/open.txt"); err != nil {
+		t.Errorf("object should be stored under the prefix, but got %v", err)
+	}
+
+	for _, rawURL := range []string{
+		"s3://?region=us-east-1",
+		"s3://ofs?acl=public",
+		"s3://ofs?part_size=large",
+		"s3://ofs?bucket=other",
+		"s3://access_id@ofs",
+	} {
+		if _, err := ofs.Open(rawURL); !errors.Is(err, ofs.ErrInvalidConfig) {
+			t.Errorf("Open(%q) should fail with ErrInvalidConfig, but got %v", rawURL, err)
+		}
+	}
+}
+
+func TestResumableUploadStaging(t *testing.T) {
+	server := s3test.NewServer("ofs")
+	defer server.Close()
+
+	var (
+		client = s3.New(server.Config("ofs"))
+		ctx    = context.Background()
+	)
+
+	uploadID, err := client.CreateUpload(ctx, "/staged.txt", nil)
+	if err != nil {
+		t.Fatalf("CreateUpload fail %v", err)
+	}
+	if _, err = client.WriteUpload(ctx, "/staged.txt", uploadID, 0, strings.NewReader("tail")); err != nil {
+		t.Fatalf("WriteUpload fail %v", err)
+	}
+
+	if objects, _ := client.List(""); len(objects) != 0 {
+		t.Errorf("staged tails shouldn't be listed, but got %v", objects[0].Path)
+	}
+	if result, _ := client.ListPage(ctx, "/", ofs.ListOptions{}); len(result.Objects) != 0 {
+		t.Errorf("staging prefix shouldn't be listed, but got %v", result.Objects[0].Path)
+	}
+	if objects, _ := client.List(s3.UploadStagingPrefix); len(objects) != 1 {
+		t.Errorf("staged tails should be listed under the staging prefix, but got %v", len(objects))
+	}
+
+	if _, err = client.CompleteUpload(ctx, "/staged.txt", uploadID); err != nil {
+		t.Fatalf("CompleteUpload fail %v", err)
+	}
+	if objects, _ := client.List(""); len(objects) != 1 || objects[0].Path != "/staged.txt" {
+		t.Errorf("completed upload should be listed, but got %v", objects)
+	}
+}
+
+func TestResumableUploadStaleTail(t *testing.T) {
+	server := s3test.NewServer("ofs")
+	defer server.Close()
+
+	// staged tails can't be removed, e.g. because of a network failure
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodDelete && strings.Contains(req.URL.Path, strings.Trim(s3.UploadStagingPrefix, "/")) {
+			http.Error(w, "denied", http.StatusForbidden)
+			return
+		}
+		server.ServeHTTP(w, req)
+	}))
+	defer proxy.Close()
+
+	s3Config := server.Config("ofs")
+	s3Config.S3Endpoint = proxy.URL
+	var (
+		client = s3.New(s3Config)
+		ctx    = context.Background()
+		head   = "tail"
+		rest   = strings.Repeat("x", 5*1024*1024-len(head))
+	)
+
+	uploadID, err := client.CreateUpload(ctx, "/stale.txt", nil)
+	if err != nil {
+		t.Fatalf("CreateUpload fail %v", err)
+	}
+	if _, err = client.WriteUpload(ctx, "/stale.txt", uploadID, 0, strings.NewReader(head)); err != nil {
+		t.Fatalf("WriteUpload fail %v", err)
+	}
+	if n, err := client.WriteUpload(ctx, "/stale.txt", uploadID, int64(len(head)), strings.NewReader(rest)); err != nil || n != int64(len(rest)) {
+		t.Fatalf("WriteUpload should upload a part, but got %v, %v", n, err)
+	}
+
+	if offset, err := client.UploadOffset(ctx, "/stale.txt", uploadID); err != nil || offset != int64(len(head)+len(rest)) {
+		t.Errorf("tail uploaded as part shouldn't be counted again, but got %v, %v", offset, err)
+	}
+
+	if _, err = client.CompleteUpload(ctx, "/stale.txt", uploadID); err != nil {
+		t.Fatalf("CompleteUpload fail %v", err)
+	}
+	stream, err := client.GetStream("/stale.txt")
+	if err != nil {
+		t.Fatalf("GetStream fail %v", err)
+	}
+	defer stream.Close()
+	if data, _ := ioutil.ReadAll(stream); string(data) != head+rest {
+		t.Errorf("tail uploaded as part shouldn't be copied again, but got %v bytes", len(data))
+	}
+}
+
+// streamReader generate size bytes starting with an HTML head, after stallAt bytes it waits for resume,
+// so reads only go on if the data before has been sent already
+type streamReader struct {
+	size, read, stallAt int64
+	resume              <-chan struct{}
+}
+
+func (reader *streamReader) Read(p []byte) (int, error) {
+	if reader.read >= reader.size {
+		return 0, io.EOF
+	}
+	if reader.read >= reader.stallAt {
+		select {
+		case <-reader.resume:
+		case <-time.After(5 * time.Second):
+			return 0, errors.New("content should be uploaded while it is read")
+		}
+	}
+
+	if remaining := reader.size - reader.read; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	if reader.read < reader.stallAt && int64(len(p)) > reader.stallAt-reader.read {
+		p = p[:reader.stallAt-reader.read]
+	}
+	for i := range p {
+		p[i] = "<html><body>"[(reader.read+int64(i))%12]
+	}
+	reader.read += int64(len(p))
+	return len(p), nil
+}
+
+func TestPutStreaming(t *testing.T) {
+	server := s3test.NewServer("ofs")
+	defer server.Close()
+
+	var (
+		partSize = int64(5 * 1024 * 1024)
+		resume   = make(chan struct{})
+		once     sync.Once
+	)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		server.ServeHTTP(w, req)
+		if req.Method == http.MethodPut && req.URL.Query().Get("partNumber") != "" {
+			once.Do(func() { close(resume) })
+		}
+	}))
+	defer proxy.Close()
+
+	s3Config := server.Config("ofs")
+	s3Config.S3Endpoint = proxy.URL
+	s3Config.UploadPartSize = partSize
+	client := s3.New(s3Config)
+
+	reader := &streamReader{size: 3*partSize - 1, stallAt: partSize + 1, resume: resume}
+	if _, err := client.Put("/stream", reader); err != nil {
+		t.Fatalf("Put of a non-seekable reader larger than a part should stream it, but got %v", err)
+	}
+
+	object, err := client.Stat("/stream")
+	if err != nil || object.Size != reader.size || !strings.HasSuffix(object.ETag, "-3") {
+		t.Errorf("content should be uploaded in 3 parts, but got %+v, %v", object, err)
+	}
+	if object != nil && !strings.HasPrefix(object.ContentType, "text/html") {
+		t.Errorf("content type should be sniffed from the head of the content, but got %v", object.ContentType)
+	}
+}
@@ -0,0 +1,536 @@
+// Package s3test implements a fake S3 endpoint for testing s3.Client without AWS
+//
+// It supports path-style requests of GetObject, PutObject, HeadObject, DeleteObject, ListObjectsV2, CopyObject
+// and multipart uploads including ListParts, requests are not authenticated, so presigned URLs work as well.
+package s3test
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	s3 "github.com/MayCMF/ofs/awss3"
+)
+
+// Server fake S3 endpoint, safe for concurrent use
+type Server struct {
+	*httptest.Server
+
+	mutex    sync.Mutex
+	buckets  map[string]map[string]*object
+	uploads  map[string]*upload
+	uploadID int
+}
+
+type object struct {
+	data         []byte
+	header       http.Header
+	etag         string
+	lastModified time.Time
+}
+
+type upload struct {
+	bucket string
+	key    string
+	header http.Header
+	parts  map[int]*object
+}
+
+// NewServer start a fake S3 endpoint with given buckets, close it with Close
+func NewServer(buckets ...string) *Server {
+	server := &Server{buckets: map[string]map[string]*object{}, uploads: map[string]*upload{}}
+	for _, bucket := range buckets {
+		server.buckets[bucket] = map[string]*object{}
+	}
+	server.Server = httptest.NewServer(server)
+	return server
+}
+
+// Config return a client config using the fake endpoint with path-style addressing
+func (server *Server) Config(bucket string) *s3.Config {
+	return &s3.Config{
+		AccessID:         "access_id",
+		AccessKey:        "access_key",
+		Region:           "us-east-1",
+		Bucket:           bucket,
+		S3Endpoint:       server.URL,
+		S3ForcePathStyle: true,
+	}
+}
+
+// PendingUploads number of multipart uploads that are neither completed nor aborted
+func (server *Server) PendingUploads() int {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return len(server.uploads)
+}
+
+// ServeHTTP serve S3 API requests
+func (server *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	var (
+		query       = req.URL.Query()
+		bucket, key = splitPath(req.URL.Path)
+	)
+
+	if bucket == "" {
+		writeError(w, req, http.StatusBadRequest, "InvalidRequest", "bucket is required")
+		return
+	}
+
+	if key == "" {
+		switch req.Method {
+		case http.MethodPut:
+			if _, ok := server.buckets[bucket]; !ok {
+				server.buckets[bucket] = map[string]*object{}
+			}
+		case http.MethodGet:
+			server.listObjects(w, req, bucket)
+		default:
+			writeError(w, req, http.StatusNotImplemented, "NotImplemented", req.Method+" bucket isn't implemented")
+		}
+		return
+	}
+
+	objects, ok := server.buckets[bucket]
+	if !ok {
+		writeError(w, req, http.StatusNotFound, "NoSuchBucket", "the specified bucket does not exist")
+		return
+	}
+
+	switch {
+	case req.Method == http.MethodPost && query.Has("uploads"):
+		server.createMultipartUpload(w, req, bucket, key)
+	case req.Method == http.MethodPost && query.Has("uploadId"):
+		server.completeMultipartUpload(w, req, objects, query.Get("uploadId"))
+	case req.Method == http.MethodPut && query.Has("uploadId"):
+		server.uploadPart(w, req, query.Get("uploadId"), query.Get("partNumber"))
+	case req.Method == http.MethodPut && req.Header.Get("X-Amz-Copy-Source") != "":
+		server.copyObject(w, req, objects, key)
+	case req.Method == http.MethodPut:
+		data, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			writeError(w, req, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		obj := newObject(data, req.Header)
+		objects[key] = obj
+		w.Header().Set("ETag", obj.etag)
+	case req.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(server.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case req.Method == http.MethodDelete:
+		delete(objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case req.Method == http.MethodGet && query.Has("uploadId"):
+		server.listParts(w, req, query.Get("uploadId"))
+	case req.Method == http.MethodGet || req.Method == http.MethodHead:
+		server.getObject(w, req, objects, key)
+	default:
+		writeError(w, req, http.StatusNotImplemented, "NotImplemented", req.Method+" object isn't implemented")
+	}
+}
+
+// splitPath split path-style request path into bucket and key
+func splitPath(path string) (bucket, key string) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+	if len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return parts[0], ""
+}
+
+// storedHeaders headers of PutObject kept with the object
+var storedHeaders = []string{"Content-Type", "Content-Disposition", "Content-Encoding", "Cache-Control", "X-Amz-Acl"}
+
+func newObject(data []byte, header http.Header) *object {
+	checksum := md5.Sum(data)
+	obj := &object{data: data, header: http.Header{}, etag: `"` + hex.EncodeToString(checksum[:]) + `"`, lastModified: time.Now().UTC()}
+
+	for key, values := range header {
+		if strings.HasPrefix(key, "X-Amz-Meta-") {
+			obj.header[key] = values
+		}
+	}
+	for _, key := range storedHeaders {
+		if value := header.Get(key); value != "" {
+			obj.header.Set(key, value)
+		}
+	}
+	if obj.header.Get("Content-Type") == "" {
+		obj.header.Set("Content-Type", "binary/octet-stream")
+	}
+	return obj
+}
+
+func (server *Server) getObject(w http.ResponseWriter, req *http.Request, objects map[string]*object, key string) {
+	obj, ok := objects[key]
+	if !ok {
+		writeError(w, req, http.StatusNotFound, "NoSuchKey", "the specified key does not exist")
+		return
+	}
+
+	for key, values := range obj.header {
+		if key != "X-Amz-Acl" {
+			w.Header()[key] = values
+		}
+	}
+	w.Header().Set("ETag", obj.etag)
+	w.Header().Set("Last-Modified", obj.lastModified.Format(http.TimeFormat))
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	data, status := obj.data, http.StatusOK
+	if byteRange := req.Header.Get("Range"); byteRange != "" {
+		start, end, ok := parseRange(byteRange, int64(len(obj.data)))
+		if !ok {
+			writeError(w, req, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "the requested range is not satisfiable")
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(obj.data)))
+		data, status = obj.data[start:end+1], http.StatusPartialContent
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if req.Method == http.MethodGet {
+		w.Write(data)
+	}
+}
+
+// parseRange parse a single `bytes=start-end` range, end is inclusive
+func parseRange(byteRange string, size int64) (start, end int64, ok bool) {
+	spec := strings.SplitN(strings.TrimPrefix(byteRange, "bytes="), "-", 2)
+	if len(spec) != 2 {
+		return 0, 0, false
+	}
+
+	start, err := strconv.ParseInt(spec[0], 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, false
+	}
+
+	end = size - 1
+	if spec[1] != "" {
+		if end, err = strconv.ParseInt(spec[1], 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, true
+}
+
+// copySource find the object of X-Amz-Copy-Source
+func (server *Server) copySource(req *http.Request) (*object, bool) {
+	source, err := url.PathUnescape(req.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		return nil, false
+	}
+
+	bucket, key := splitPath(strings.SplitN(source, "?", 2)[0])
+	obj, ok := server.buckets[bucket][key]
+	return obj, ok
+}
+
+type copyResult struct {
+	ETag         string
+	LastModified string
+}
+
+func (server *Server) copyObject(w http.ResponseWriter, req *http.Request, objects map[string]*object, key string) {
+	src, ok := server.copySource(req)
+	if !ok {
+		writeError(w, req, http.StatusNotFound, "NoSuchKey", "the specified copy source does not exist")
+		return
+	}
+
+	header := src.header
+	if req.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+		header = req.Header
+	}
+
+	obj := newObject(src.data, header)
+	if acl := req.Header.Get("X-Amz-Acl"); acl != "" {
+		obj.header.Set("X-Amz-Acl", acl)
+	}
+	objects[key] = obj
+
+	writeXML(w, http.StatusOK, struct {
+		XMLName xml.Name `xml:"CopyObjectResult"`
+		copyResult
+	}{copyResult: copyResult{ETag: obj.etag, LastModified: obj.lastModified.Format(time.RFC3339)}})
+}
+
+func (server *Server) createMultipartUpload(w http.ResponseWriter, req *http.Request, bucket, key string) {
+	server.uploadID++
+	uploadID := strconv.Itoa(server.uploadID)
+	server.uploads[uploadID] = &upload{bucket: bucket, key: key, header: newObject(nil, req.Header).header, parts: map[int]*object{}}
+
+	writeXML(w, http.StatusOK, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Bucket   string
+		Key      string
+		UploadId string
+	}{Bucket: bucket, Key: key, UploadId: uploadID})
+}
+
+func (server *Server) uploadPart(w http.ResponseWriter, req *http.Request, uploadID, partNumber string) {
+	up, ok := server.uploads[uploadID]
+	number, err := strconv.Atoi(partNumber)
+	if !ok || err != nil {
+		writeError(w, req, http.StatusNotFound, "NoSuchUpload", "the specified upload does not exist")
+		return
+	}
+
+	if req.Header.Get("X-Amz-Copy-Source") != "" {
+		src, ok := server.copySource(req)
+		if !ok {
+			writeError(w, req, http.StatusNotFound, "NoSuchKey", "the specified copy source does not exist")
+			return
+		}
+
+		data := src.data
+		if byteRange := req.Header.Get("X-Amz-Copy-Source-Range"); byteRange != "" {
+			start, end, ok := parseRange(byteRange, int64(len(data)))
+			if !ok {
+				writeError(w, req, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "the requested range is not satisfiable")
+				return
+			}
+			data = data[start : end+1]
+		}
+
+		part := newObject(data, nil)
+		up.parts[number] = part
+		writeXML(w, http.StatusOK, struct {
+			XMLName xml.Name `xml:"CopyPartResult"`
+			copyResult
+		}{copyResult: copyResult{ETag: part.etag, LastModified: part.lastModified.Format(time.RFC3339)}})
+		return
+	}
+
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, req, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	part := newObject(data, nil)
+	up.parts[number] = part
+	w.Header().Set("ETag", part.etag)
+}
+
+func (server *Server) listParts(w http.ResponseWriter, req *http.Request, uploadID string) {
+	up, ok := server.uploads[uploadID]
+	if !ok {
+		writeError(w, req, http.StatusNotFound, "NoSuchUpload", "the specified upload does not exist")
+		return
+	}
+
+	type listPart struct {
+		PartNumber   int
+		ETag         string
+		Size         int
+		LastModified string
+	}
+
+	result := struct {
+		XMLName     xml.Name `xml:"ListPartsResult"`
+		Bucket      string
+		Key         string
+		UploadId    string
+		IsTruncated bool
+		Parts       []listPart `xml:"Part"`
+	}{Bucket: up.bucket, Key: up.key, UploadId: uploadID}
+
+	for number, part := range up.parts {
+		result.Parts = append(result.Parts, listPart{PartNumber: number, ETag: part.etag, Size: len(part.data), LastModified: part.lastModified.Format(time.RFC3339)})
+	}
+	sort.Slice(result.Parts, func(i, j int) bool { return result.Parts[i].PartNumber < result.Parts[j].PartNumber })
+
+	writeXML(w, http.StatusOK, result)
+}
+
+func (server *Server) completeMultipartUpload(w http.ResponseWriter, req *http.Request, objects map[string]*object, uploadID string) {
+	up, ok := server.uploads[uploadID]
+	if !ok {
+		writeError(w, req, http.StatusNotFound, "NoSuchUpload", "the specified upload does not exist")
+		return
+	}
+
+	var completion struct {
+		Parts []struct {
+			PartNumber int
+			ETag       string
+		} `xml:"Part"`
+	}
+	if err := xml.NewDecoder(req.Body).Decode(&completion); err != nil {
+		writeError(w, req, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+
+	var (
+		data      []byte
+		checksums []byte
+	)
+	for _, completed := range completion.Parts {
+		part, ok := up.parts[completed.PartNumber]
+		if !ok || part.etag != completed.ETag {
+			writeError(w, req, http.StatusBadRequest, "InvalidPart", "one or more of the specified parts could not be found")
+			return
+		}
+		data = append(data, part.data...)
+		checksum, _ := hex.DecodeString(strings.Trim(part.etag, `"`))
+		checksums = append(checksums, checksum...)
+	}
+
+	obj := newObject(data, up.header)
+	checksum := md5.Sum(checksums)
+	obj.etag = fmt.Sprintf(`"%x-%d"`, checksum, len(completion.Parts))
+	objects[up.key] = obj
+	delete(server.uploads, uploadID)
+
+	writeXML(w, http.StatusOK, struct {
+		XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+		Location string
+		Bucket   string
+		Key      string
+		ETag     string
+	}{Location: server.URL + "/" + up.bucket + "/" + up.key, Bucket: up.bucket, Key: up.key, ETag: obj.etag})
+}
+
+type listContent struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int
+	StorageClass string
+}
+
+type listPrefix struct {
+	Prefix string
+}
+
+func (server *Server) listObjects(w http.ResponseWriter, req *http.Request, bucket string) {
+	objects, ok := server.buckets[bucket]
+	if !ok {
+		writeError(w, req, http.StatusNotFound, "NoSuchBucket", "the specified bucket does not exist")
+		return
+	}
+
+	var (
+		query     = req.URL.Query()
+		prefix    = query.Get("prefix")
+		delimiter = query.Get("delimiter")
+		marker    = query.Get("start-after")
+		maxKeys   = 1000
+		keys      []string
+		result    struct {
+			XMLName               xml.Name `xml:"ListBucketResult"`
+			Name                  string
+			Prefix                string
+			Delimiter             string `xml:",omitempty"`
+			MaxKeys               int
+			KeyCount              int
+			IsTruncated           bool
+			ContinuationToken     string        `xml:",omitempty"`
+			NextContinuationToken string        `xml:",omitempty"`
+			StartAfter            string        `xml:",omitempty"`
+			Contents              []listContent `xml:"Contents"`
+			CommonPrefixes        []listPrefix  `xml:"CommonPrefixes"`
+		}
+	)
+
+	if value := query.Get("max-keys"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 && n < maxKeys {
+			maxKeys = n
+		}
+	}
+	if token := query.Get("continuation-token"); token > marker {
+		marker = token
+	}
+
+	for key := range objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	result.Name, result.Prefix, result.Delimiter, result.MaxKeys = bucket, prefix, delimiter, maxKeys
+	result.ContinuationToken, result.StartAfter = query.Get("continuation-token"), query.Get("start-after")
+
+	var last string
+	for _, key := range keys {
+		entry := key
+		if delimiter != "" {
+			if idx := strings.Index(key[len(prefix):], delimiter); idx >= 0 {
+				entry = key[:len(prefix)+idx+len(delimiter)]
+			}
+		}
+
+		if entry <= marker || entry == last {
+			continue
+		}
+
+		if result.KeyCount == maxKeys {
+			result.IsTruncated = true
+			result.NextContinuationToken = last
+			break
+		}
+
+		if entry != key {
+			result.CommonPrefixes = append(result.CommonPrefixes, listPrefix{Prefix: entry})
+		} else {
+			obj := objects[key]
+			result.Contents = append(result.Contents, listContent{
+				Key:          key,
+				LastModified: obj.lastModified.Format(time.RFC3339),
+				ETag:         obj.etag,
+				Size:         len(obj.data),
+				StorageClass: "STANDARD",
+			})
+		}
+		result.KeyCount++
+		last = entry
+	}
+
+	writeXML(w, http.StatusOK, result)
+}
+
+func writeXML(w http.ResponseWriter, status int, value interface{}) {
+	data, err := xml.Marshal(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, req *http.Request, status int, code, message string) {
+	if req.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+
+	writeXML(w, status, struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: message})
+}
@@ -0,0 +1,310 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/MayCMF/ofs"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// UploadStagingPrefix prefix of objects that keep the data of resumable uploads that is too small for a multipart part yet
+const UploadStagingPrefix = "/.ofs-uploads/"
+
+// isStaged report whether key is a staged tail of a resumable upload, they are left out of listings unless UploadStagingPrefix itself is listed
+func isStaged(key, listed string) bool {
+	return strings.HasPrefix("/"+strings.TrimPrefix(key, "/"), UploadStagingPrefix) && !strings.HasPrefix(ofs.DirPrefix(listed), UploadStagingPrefix)
+}
+
+// partSize size of parts of resumable uploads, S3 rejects parts smaller than 5MB except the last one
+func (client Client) partSize() int64 {
+	if client.Config.UploadPartSize > s3manager.MinUploadPartSize {
+		return client.Config.UploadPartSize
+	}
+	return s3manager.MinUploadPartSize
+}
+
+// tailOffsetMetadata metadata of staged tails that keeps their offset in the upload, tails that don't start right after
+// the uploaded parts have been uploaded as part already, e.g. if removing them failed, and are ignored
+const tailOffsetMetadata = "Ofs-Tail-Offset"
+
+// tailKey key of the object that stages data of upload uploadID that doesn't fill a part
+func tailKey(key, uploadID string) string {
+	checksum := md5.Sum([]byte(key + "\n" + uploadID))
+	return UploadStagingPrefix + hex.EncodeToString(checksum[:])
+}
+
+// CreateUpload start a resumable upload of path backed by a multipart upload,
+// options.CreateOnly is only checked here, so concurrent writers could still overwrite each other
+func (client Client) CreateUpload(ctx context.Context, urlPath string, options *ofs.PutOptions) (string, error) {
+	if options == nil {
+		options = &ofs.PutOptions{}
+	}
+
+	key := client.ToRelativePath(urlPath)
+	if options.CreateOnly {
+		if _, err := client.headObject(ctx, key); err == nil {
+			return "", ofs.NewError("create upload", key, ofs.ErrExists, nil)
+		} else if err = wrapError(ctx, "create upload", key, err); !errors.Is(err, ofs.ErrNotFound) {
+			return "", err
+		}
+	}
+
+	input := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(client.Config.Bucket),
+		Key:    aws.String(key),
+		ACL:    aws.String(client.Config.ACL),
+	}
+	if options.ACL != "" {
+		input.ACL = aws.String(options.ACL)
+	}
+	if contentType := options.ContentType; contentType != "" {
+		input.ContentType = aws.String(contentType)
+	} else if contentType = mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+	if options.CacheControl != "" {
+		input.CacheControl = aws.String(options.CacheControl)
+	} else if client.Config.CacheControl != "" {
+		input.CacheControl = aws.String(client.Config.CacheControl)
+	}
+	if options.ContentDisposition != "" {
+		input.ContentDisposition = aws.String(options.ContentDisposition)
+	}
+	if options.ContentEncoding != "" {
+		input.ContentEncoding = aws.String(options.ContentEncoding)
+	}
+	if metadata := options.NormalizedMetadata(); metadata != nil {
+		input.Metadata = aws.StringMap(metadata)
+	}
+
+	upload, err := client.S3.CreateMultipartUploadWithContext(ctx, input)
+	if err != nil {
+		return "", wrapError(ctx, "create upload", key, err)
+	}
+	return aws.StringValue(upload.UploadId), nil
+}
+
+// uploadState uploaded parts and the size of the staged tail of an upload
+func (client Client) uploadState(ctx context.Context, key, uploadID string) (parts []*s3.Part, partsSize, tailSize int64, err error) {
+	err = client.S3.ListPartsPagesWithContext(ctx, &s3.ListPartsInput{
+		Bucket:   aws.String(client.Config.Bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	}, func(page *s3.ListPartsOutput, lastPage bool) bool {
+		parts = append(parts, page.Parts...)
+		return true
+	})
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return aws.Int64Value(parts[i].PartNumber) < aws.Int64Value(parts[j].PartNumber) })
+	for _, part := range parts {
+		partsSize += aws.Int64Value(part.Size)
+	}
+
+	tail, err := client.headObject(ctx, tailKey(key, uploadID))
+	if err != nil {
+		if errors.Is(wrapError(ctx, "", key, err), ofs.ErrNotFound) {
+			return parts, partsSize, 0, nil
+		}
+		return nil, 0, 0, err
+	}
+	for name, value := range tail.Metadata {
+		if strings.EqualFold(name, tailOffsetMetadata) && aws.StringValue(value) != strconv.FormatInt(partsSize, 10) {
+			return parts, partsSize, 0, nil
+		}
+	}
+	return parts, partsSize, aws.Int64Value(tail.ContentLength), nil
+}
+
+// UploadOffset return the size of uploaded parts and the staged tail
+func (client Client) UploadOffset(ctx context.Context, urlPath, uploadID string) (int64, error) {
+	key := client.ToRelativePath(urlPath)
+	_, partsSize, tailSize, err := client.uploadState(ctx, key, uploadID)
+	if err != nil {
+		return 0, wrapError(ctx, "upload offset", key, err)
+	}
+	return partsSize + tailSize, nil
+}
+
+// WriteUpload append reader to the upload, full parts are uploaded as multipart parts,
+// the remaining data is staged as an object under UploadStagingPrefix until more data arrives
+func (client Client) WriteUpload(ctx context.Context, urlPath, uploadID string, offset int64, reader io.Reader) (int64, error) {
+	key := client.ToRelativePath(urlPath)
+	parts, partsSize, tailSize, err := client.uploadState(ctx, key, uploadID)
+	if err != nil {
+		return 0, wrapError(ctx, "write upload", key, err)
+	}
+	if partsSize+tailSize != offset {
+		return 0, ofs.NewError("write upload", key, ofs.ErrOffsetMismatch, nil)
+	}
+
+	body := ofs.ContextReader(ctx, reader)
+	if tailSize > 0 {
+		tail, err := client.S3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(client.Config.Bucket),
+			Key:    aws.String(tailKey(key, uploadID)),
+		})
+		if err != nil {
+			return 0, wrapError(ctx, "write upload", key, err)
+		}
+		defer tail.Body.Close()
+		body = io.MultiReader(tail.Body, body)
+	}
+
+	var (
+		buffer     = make([]byte, client.partSize())
+		partNumber = int64(len(parts)) + 1
+		uploaded   int64
+		staged     = tailSize
+	)
+
+	// written bytes of reader only, the previously staged tail was counted in offset already
+	written := func() int64 {
+		if n := partsSize + uploaded + staged - offset; n > 0 {
+			return n
+		}
+		return 0
+	}
+
+	for {
+		n, err := io.ReadFull(body, buffer)
+		if err != nil {
+			// keep what has been received, even if reading failed
+			if n > 0 {
+				if _, stageErr := client.stageTail(ctx, key, uploadID, partsSize+uploaded, buffer[:n]); stageErr != nil {
+					return written(), wrapError(ctx, "write upload", key, stageErr)
+				}
+				staged = int64(n)
+			} else if staged == 0 {
+				// remove a tail that has been uploaded as part already, it is ignored anyway if that fails
+				client.stageTail(ctx, key, uploadID, 0, nil)
+			}
+
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				return written(), wrapError(ctx, "write upload", key, err)
+			}
+			return written(), nil
+		}
+
+		if _, err = client.S3.UploadPartWithContext(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(client.Config.Bucket),
+			Key:        aws.String(key),
+			UploadId:   aws.String(uploadID),
+			PartNumber: aws.Int64(partNumber),
+			Body:       bytes.NewReader(buffer[:n]),
+		}); err != nil {
+			return written(), wrapError(ctx, "write upload", key, err)
+		}
+		partNumber++
+		uploaded += int64(n)
+
+		// the staged tail is part of the uploaded part now, it is ignored by its offset even if it can't be removed
+		if staged > 0 {
+			client.stageTail(ctx, key, uploadID, 0, nil)
+			staged = 0
+		}
+	}
+}
+
+// stageTail replace the staged tail of the upload with data starting at offset, or remove it if data is empty, return the size of the new tail
+func (client Client) stageTail(ctx context.Context, key, uploadID string, offset int64, data []byte) (int64, error) {
+	if len(data) == 0 {
+		_, err := client.S3.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(client.Config.Bucket),
+			Key:    aws.String(tailKey(key, uploadID)),
+		})
+		return 0, err
+	}
+
+	_, err := client.S3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:   aws.String(client.Config.Bucket),
+		Key:      aws.String(tailKey(key, uploadID)),
+		ACL:      aws.String(s3.ObjectCannedACLPrivate),
+		Metadata: map[string]*string{tailOffsetMetadata: aws.String(strconv.FormatInt(offset, 10))},
+		Body:     bytes.NewReader(data),
+	})
+	return int64(len(data)), err
+}
+
+// CompleteUpload copy the staged tail into the last part server side, and complete the multipart upload
+func (client Client) CompleteUpload(ctx context.Context, urlPath, uploadID string) (*ofs.Object, error) {
+	key := client.ToRelativePath(urlPath)
+	parts, _, tailSize, err := client.uploadState(ctx, key, uploadID)
+	if err != nil {
+		return nil, wrapError(ctx, "complete upload", key, err)
+	}
+
+	completed := make([]*s3.CompletedPart, 0, len(parts)+1)
+	for _, part := range parts {
+		completed = append(completed, &s3.CompletedPart{ETag: part.ETag, PartNumber: part.PartNumber})
+	}
+
+	partNumber := aws.Int64(int64(len(parts)) + 1)
+	if tailSize > 0 {
+		output, err := client.S3.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:     aws.String(client.Config.Bucket),
+			Key:        aws.String(key),
+			UploadId:   aws.String(uploadID),
+			PartNumber: partNumber,
+			CopySource: aws.String(escapeCopySource(client.Config.Bucket + tailKey(key, uploadID))),
+		})
+		if err != nil {
+			return nil, wrapError(ctx, "complete upload", key, err)
+		}
+		completed = append(completed, &s3.CompletedPart{ETag: output.CopyPartResult.ETag, PartNumber: partNumber})
+	} else if len(parts) == 0 {
+		// empty objects still need one part
+		output, err := client.S3.UploadPartWithContext(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(client.Config.Bucket),
+			Key:        aws.String(key),
+			UploadId:   aws.String(uploadID),
+			PartNumber: partNumber,
+			Body:       bytes.NewReader(nil),
+		})
+		if err != nil {
+			return nil, wrapError(ctx, "complete upload", key, err)
+		}
+		completed = append(completed, &s3.CompletedPart{ETag: output.ETag, PartNumber: partNumber})
+	}
+
+	if _, err = client.S3.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(client.Config.Bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	}); err != nil {
+		return nil, wrapError(ctx, "complete upload", key, err)
+	}
+
+	client.stageTail(ctx, key, uploadID, 0, nil)
+	return client.StatWithContext(ctx, key)
+}
+
+// AbortUpload abort the multipart upload and remove its staged tail
+func (client Client) AbortUpload(ctx context.Context, urlPath, uploadID string) error {
+	key := client.ToRelativePath(urlPath)
+	if _, err := client.stageTail(ctx, key, uploadID, 0, nil); err != nil {
+		return wrapError(ctx, "abort upload", key, err)
+	}
+
+	_, err := client.S3.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(client.Config.Bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	return wrapError(ctx, "abort upload", key, err)
+}
@@ -0,0 +1,153 @@
+package ofs
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// WithContext return storage as StorageWithContext, storages that don't support context natively are wrapped,
+// the wrapper checks the context before every call, but can't interrupt a call that is already running
+func WithContext(storage StorageInterface) StorageWithContext {
+	if s, ok := storage.(StorageWithContext); ok {
+		return s
+	}
+	if s, ok := storage.(withoutContext); ok {
+		return s.StorageWithContext
+	}
+	return withContext{StorageInterface: storage}
+}
+
+// WithoutContext return storage as StorageInterface, so existing callers could keep using it, calls are made with context.Background()
+func WithoutContext(storage StorageWithContext) StorageInterface {
+	if s, ok := storage.(StorageInterface); ok {
+		return s
+	}
+	if s, ok := storage.(withContext); ok {
+		return s.StorageInterface
+	}
+	return withoutContext{StorageWithContext: storage}
+}
+
+type withContext struct {
+	StorageInterface
+}
+
+func (storage withContext) GetWithContext(ctx context.Context, path string) (*os.File, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return storage.Get(path)
+}
+
+func (storage withContext) GetStreamWithContext(ctx context.Context, path string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return storage.GetStream(path)
+}
+
+func (storage withContext) PutWithContext(ctx context.Context, path string, reader io.Reader) (*Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		seeker.Seek(0, 0)
+	}
+	return storage.Put(path, ContextReader(ctx, reader))
+}
+
+func (storage withContext) DeleteWithContext(ctx context.Context, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return storage.Delete(path)
+}
+
+func (storage withContext) ListWithContext(ctx context.Context, path string) ([]*Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return storage.List(path)
+}
+
+func (storage withContext) StatWithContext(ctx context.Context, path string) (*Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return storage.Stat(path)
+}
+
+func (storage withContext) GetURLWithContext(ctx context.Context, path string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return storage.GetURL(path)
+}
+
+type withoutContext struct {
+	StorageWithContext
+}
+
+func (storage withoutContext) Get(path string) (*os.File, error) {
+	return storage.GetWithContext(context.Background(), path)
+}
+
+func (storage withoutContext) GetStream(path string) (io.ReadCloser, error) {
+	return storage.GetStreamWithContext(context.Background(), path)
+}
+
+func (storage withoutContext) Put(path string, reader io.Reader) (*Object, error) {
+	object, err := storage.PutWithContext(context.Background(), path, reader)
+	return storage.own(object), err
+}
+
+func (storage withoutContext) Delete(path string) error {
+	return storage.DeleteWithContext(context.Background(), path)
+}
+
+func (storage withoutContext) List(path string) ([]*Object, error) {
+	objects, err := storage.ListWithContext(context.Background(), path)
+	for _, object := range objects {
+		storage.own(object)
+	}
+	return objects, err
+}
+
+func (storage withoutContext) Stat(path string) (*Object, error) {
+	object, err := storage.StatWithContext(context.Background(), path)
+	return storage.own(object), err
+}
+
+func (storage withoutContext) GetURL(path string) (string, error) {
+	return storage.GetURLWithContext(context.Background(), path)
+}
+
+// own point objects without a storage to the wrapper, so object.Get keeps working
+func (storage withoutContext) own(object *Object) *Object {
+	if object != nil && object.StorageInterface == nil {
+		object.StorageInterface = storage
+	}
+	return object
+}
+
+// ContextReader return a reader that stops with the context's error once ctx is done,
+// useful to make plain io.Copy calls cancelable
+func ContextReader(ctx context.Context, reader io.Reader) io.Reader {
+	if ctx.Done() == nil {
+		return reader
+	}
+	return &contextReader{ctx: ctx, reader: reader}
+}
+
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
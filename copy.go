@@ -0,0 +1,44 @@
+package ofs
+
+import (
+	"context"
+)
+
+// Copier implemented by storages that could copy and move objects inside the storage without downloading them, metadata is preserved
+type Copier interface {
+	Copy(src, dst string) (*Object, error)
+	Move(src, dst string) (*Object, error)
+}
+
+// Copy copy object src to dst, storages that don't implement Copier are copied by streaming the object into Put with its metadata
+func Copy(storage StorageInterface, src, dst string) (*Object, error) {
+	if copier, ok := storage.(Copier); ok {
+		return copier.Copy(src, dst)
+	}
+
+	object, err := storage.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := storage.GetStream(src)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	return putCopy(context.Background(), storage, dst, stream, object)
+}
+
+// Move move object src to dst, storages that don't implement Copier are moved with Copy then Delete
+func Move(storage StorageInterface, src, dst string) (*Object, error) {
+	if copier, ok := storage.(Copier); ok {
+		return copier.Move(src, dst)
+	}
+
+	object, err := Copy(storage, src, dst)
+	if err != nil {
+		return nil, err
+	}
+	return object, storage.Delete(src)
+}
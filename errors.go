@@ -0,0 +1,72 @@
+package ofs
+
+import (
+	"context"
+	"errors"
+	iofs "io/fs"
+	"net/http"
+)
+
+// Common errors returned by storages, check them with errors.Is
+var (
+	// ErrNotFound returned when the requested object doesn't exist in the storage
+	ErrNotFound = errors.New("ofs: object not found")
+	// ErrPermission returned when the storage denied access to the object
+	ErrPermission = errors.New("ofs: permission denied")
+	// ErrExists returned when the object already exists
+	ErrExists = errors.New("ofs: object already exists")
+	// ErrInvalidPath returned when the path isn't acceptable for the storage
+	ErrInvalidPath = errors.New("ofs: invalid path")
+	// ErrUnsupported returned when the storage doesn't support the operation
+	ErrUnsupported = errors.New("ofs: operation not supported")
+)
+
+// Error records a failed storage operation, Kind is one of the common errors (or nil if the failure couldn't be classified),
+// Err is the backend's native error, it stays reachable with errors.As
+type Error struct {
+	Op   string
+	Path string
+	Kind error
+	Err  error
+}
+
+// NewError wrap backend's native error err as a *Error of kind
+func NewError(op, path string, kind, err error) error {
+	return &Error{Op: op, Path: path, Kind: kind, Err: err}
+}
+
+func (e *Error) Error() string {
+	err := e.Err
+	if err == nil {
+		err = e.Kind
+	}
+	if e.Path == "" {
+		return "ofs: " + e.Op + ": " + err.Error()
+	}
+	return "ofs: " + e.Op + " " + e.Path + ": " + err.Error()
+}
+
+// Unwrap return the backend's native error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is report whether the error is of kind target
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+// HTTPStatus HTTP status of a storage error, e.g. 404 for ErrNotFound, 503 for canceled requests, 500 for unclassified errors
+func HTTPStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, iofs.ErrNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, ErrPermission), errors.Is(err, ErrInvalidPath):
+		return http.StatusForbidden
+	case errors.Is(err, ErrExists), errors.Is(err, ErrOffsetMismatch):
+		return http.StatusConflict
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
@@ -1,18 +1,29 @@
 package fs
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 
-	"github.com/MyCMF/ofs"
+	"github.com/MayCMF/ofs"
 )
 
-// FileSystem file system storage
+// FileSystem file system storage, options of objects are kept in sidecar files named after them with MetadataSuffix,
+// e.g. `image.png.ofsmeta`, and writes use temporary files prefixed with `.ofs-tmp-`, so those names are reserved:
+// they are hidden from listings, and writing them fails with ofs.ErrInvalidPath
 type FileSystem struct {
 	Base string
+	// Endpoint public base URL that Base is served from, e.g. `/uploads` or `https://cdn.example.com`, GetURL returns paths relative to / if it is empty
+	Endpoint string
+	// SigningKeys HMAC keys of signed URLs, see GetSignedURL
+	SigningKeys []SigningKey
 }
 
 // New initialize FileSystem storage
@@ -24,76 +35,271 @@ func New(base string) *FileSystem {
 	return &FileSystem{Base: absbase}
 }
 
-// GetFullPath get full path from absolute/relative path
-func (fileSystem FileSystem) GetFullPath(path string) string {
-	fullpath := path
-	if !strings.HasPrefix(path, fileSystem.Base) {
-		fullpath, _ = filepath.Abs(filepath.Join(fileSystem.Base, path))
+// GetFullPath get full path from absolute/relative path, returns ofs.ErrInvalidPath if the path resolves outside of Base,
+// by `..` elements or through symlinks, and ofs.ErrNotFound for reserved names of sidecar and temporary files
+func (fileSystem FileSystem) GetFullPath(path string) (string, error) {
+	if strings.IndexByte(path, 0) >= 0 {
+		return "", ofs.NewError("resolve", path, ofs.ErrInvalidPath, errors.New("path contains NUL byte"))
 	}
-	return fullpath
+
+	relpath := filepath.FromSlash(path)
+	if relpath == fileSystem.Base || strings.HasPrefix(relpath, fileSystem.Base+string(filepath.Separator)) {
+		relpath = strings.TrimPrefix(relpath, fileSystem.Base)
+	}
+
+	fullpath := filepath.Join(fileSystem.Base, relpath)
+	if !isWithin(fileSystem.Base, fullpath) {
+		return "", ofs.NewError("resolve", path, ofs.ErrInvalidPath, errOutsideBase)
+	}
+
+	if !isWithin(resolveExisting(fileSystem.Base), resolveExisting(fullpath)) {
+		return "", ofs.NewError("resolve", path, ofs.ErrInvalidPath, errOutsideBase)
+	}
+
+	// sidecar and temporary files aren't objects, so they are never served
+	if fullpath != fileSystem.Base && isInternalFile(fullpath) {
+		return "", ofs.NewError("resolve", path, ofs.ErrNotFound, errReservedName)
+	}
+	return fullpath, nil
 }
 
 // Get receive file with given path
 func (fileSystem FileSystem) Get(path string) (*os.File, error) {
-	return os.Open(fileSystem.GetFullPath(path))
+	return fileSystem.GetWithContext(context.Background(), path)
+}
+
+// GetWithContext receive file with given path
+func (fileSystem FileSystem) GetWithContext(ctx context.Context, path string) (*os.File, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	fullpath, err := fileSystem.GetFullPath(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(fullpath)
+	return file, wrapError("get", path, err)
 }
 
 // GetStream get file as stream
-func (fileSystem FileSystem) GetStream(path string) {
-	return ReadStream(fileSystem.GetFullPath(path))
+func (fileSystem FileSystem) GetStream(path string) (io.ReadCloser, error) {
+	return fileSystem.GetStreamWithContext(context.Background(), path)
+}
+
+// GetStreamWithContext get file as stream
+func (fileSystem FileSystem) GetStreamWithContext(ctx context.Context, path string) (io.ReadCloser, error) {
+	return fileSystem.GetWithContext(ctx, path)
 }
 
 // Put store a reader into given path
 func (fileSystem FileSystem) Put(path string, reader io.Reader) (*ofs.Object, error) {
-	var (
-		fullpath = fileSystem.GetFullPath(path)
-		err = CheckDir(filepath.Dir(fullpath))
-	)
+	return fileSystem.PutWithContext(context.Background(), path, reader)
+}
+
+// PutWithContext store a reader into given path, stop copying once ctx is done
+func (fileSystem FileSystem) PutWithContext(ctx context.Context, path string, reader io.Reader) (*ofs.Object, error) {
+	return fileSystem.PutWithOptions(ctx, path, reader, nil)
+}
+
+// PutWithOptions store a reader into given path atomically, see OpenWriter, options are saved into a sidecar file and returned by Stat
+func (fileSystem FileSystem) PutWithOptions(ctx context.Context, path string, reader io.Reader, options *ofs.PutOptions) (*ofs.Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
+	writer, err := fileSystem.OpenWriter(path, options)
 	if err != nil {
 		return nil, err
 	}
 
-	dst, err := CheckFile(fullpath)
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		seeker.Seek(0, 0)
+	}
 
-	if err == nil {
-		if seeker, ok := reader.(io.ReadSeeker); ok {
-			seeker.Seek(0, 0)
-		}
-		_, err = Copy(dst, reader)
+	if _, err = io.Copy(writer, ofs.ContextReader(ctx, reader)); err != nil {
+		writer.Abort()
+	} else {
+		err = writer.Close()
 	}
 
-	return &ofs.Object{Path: path, Name: filepath.Base(path), StorageInterface: fileSystem}, err
+	object := &ofs.Object{Path: path, Name: filepath.Base(path), StorageInterface: fileSystem}
+	if options != nil {
+		object.ContentType = options.ContentType
+		object.ContentDisposition = options.ContentDisposition
+		object.ContentEncoding = options.ContentEncoding
+		object.CacheControl = options.CacheControl
+		object.Metadata = options.NormalizedMetadata()
+	}
+	return object, wrapError("put", path, err)
 }
 
 // Delete delete file
 func (fileSystem FileSystem) Delete(path string) error {
-	return Remove(fileSystem.GetFullPath(path))
+	return fileSystem.DeleteWithContext(context.Background(), path)
+}
+
+// DeleteWithContext delete file
+func (fileSystem FileSystem) DeleteWithContext(ctx context.Context, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fullpath, err := fileSystem.GetFullPath(path)
+	if err != nil {
+		return err
+	}
+	if fullpath == fileSystem.Base {
+		return ofs.NewError("delete", path, ofs.ErrInvalidPath, errors.New("can't delete the base directory"))
+	}
+	if err := Remove(fullpath + MetadataSuffix); err != nil {
+		return wrapError("delete", path, err)
+	}
+	return wrapError("delete", path, Remove(fullpath))
 }
 
 // List of all objects under current path
 func (fileSystem FileSystem) List(path string) ([]*ofs.Object, error) {
-	var (
-		objects  []*ofs.Object
-		fullpath = fileSystem.GetFullPath(path)
-	)
+	return fileSystem.ListWithContext(context.Background(), path)
+}
+
+// ListWithContext list all objects under current path, stop walking once ctx is done
+func (fileSystem FileSystem) ListWithContext(ctx context.Context, path string) ([]*ofs.Object, error) {
+	var objects []*ofs.Object
+
+	fullpath, err := fileSystem.GetFullPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.Walk(fullpath, func(path string, info os.FileInfo, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
 
-	filepath.Walk(fullpath, func(path string, info os.FileInfo, err error) error {
 		if path == fullpath {
 			return nil
 		}
 
-		if err == nil && !info.IsDir() {
+		if err == nil && !info.IsDir() && !isInternalFile(path) {
 			modTime := info.ModTime()
 			objects = append(objects, &ofs.Object{
 				Path:             strings.TrimPrefix(path, fileSystem.Base),
 				Name:             info.Name(),
 				LastModified:     &modTime,
+				Size:             info.Size(),
 				StorageInterface: fileSystem,
 			})
 		}
 		return nil
 	})
 
-	return objects, nil
+	return objects, err
+}
+
+// Stat get object's metadata without reading its content
+func (fileSystem FileSystem) Stat(path string) (*ofs.Object, error) {
+	return fileSystem.StatWithContext(context.Background(), path)
+}
+
+// StatWithContext get object's metadata without reading its content
+func (fileSystem FileSystem) StatWithContext(ctx context.Context, path string) (*ofs.Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	fullpath, err := fileSystem.GetFullPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(fullpath)
+	if err != nil {
+		return nil, wrapError("stat", path, err)
+	}
+
+	if info.IsDir() {
+		return nil, ofs.NewError("stat", path, ofs.ErrNotFound, errors.New("is a directory"))
+	}
+
+	meta, err := readMetadata(fullpath)
+	if err != nil {
+		return nil, wrapError("stat", path, err)
+	}
+
+	modTime := info.ModTime()
+	object := &ofs.Object{
+		Path:             filepath.ToSlash(strings.TrimPrefix(fullpath, fileSystem.Base)),
+		Name:             info.Name(),
+		LastModified:     &modTime,
+		Size:             info.Size(),
+		ETag:             fmt.Sprintf("%x-%x", modTime.UnixNano(), info.Size()),
+		StorageInterface: fileSystem,
+	}
+	meta.apply(object)
+	if object.ContentType == "" {
+		object.ContentType = detectContentType(fullpath)
+	}
+	return object, nil
+}
+
+// detectContentType get content type from file's extension, or sniff it from the first 512 bytes
+func detectContentType(fullpath string) string {
+	if contentType := mime.TypeByExtension(filepath.Ext(fullpath)); contentType != "" {
+		return contentType
+	}
+
+	file, err := os.Open(fullpath)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	buffer := make([]byte, 512)
+	n, _ := io.ReadFull(file, buffer)
+	return http.DetectContentType(buffer[:n])
+}
+
+// GetURL get public accessible URL, the escaped path prefixed with Endpoint
+func (fileSystem FileSystem) GetURL(path string) (string, error) {
+	return fileSystem.GetURLWithContext(context.Background(), path)
+}
+
+// GetURLWithContext get public accessible URL, the escaped path prefixed with Endpoint
+func (fileSystem FileSystem) GetURLWithContext(ctx context.Context, path string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	objectPath, err := fileSystem.objectPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	urlPath := (&url.URL{Path: objectPath}).EscapedPath()
+	return strings.TrimSuffix(fileSystem.Endpoint, "/") + urlPath, nil
+}
+
+// objectPath get the canonical slash separated path of path relative to Base, e.g. `/a/b.png`
+func (fileSystem FileSystem) objectPath(path string) (string, error) {
+	fullpath, err := fileSystem.GetFullPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	relpath, err := filepath.Rel(fileSystem.Base, fullpath)
+	if err != nil {
+		return "", wrapError("resolve", path, err)
+	}
+
+	if relpath == "." {
+		relpath = ""
+	}
+	return "/" + filepath.ToSlash(relpath), nil
+}
+
+// GetEndpoint get endpoint, the public base URL of Base, / if Endpoint isn't set
+func (fileSystem FileSystem) GetEndpoint() string {
+	if fileSystem.Endpoint != "" {
+		return fileSystem.Endpoint
+	}
+	return "/"
 }
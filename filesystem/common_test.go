@@ -0,0 +1,260 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MayCMF/ofs"
+	"github.com/MayCMF/ofs/ofstest"
+)
+
+// Put and Get with a live context
+func Test_PutWithContext(t *testing.T) {
+	var (
+		storage = New(t.TempDir())
+		content = "Hello MayCMF"
+	)
+
+	if _, err := storage.PutWithContext(context.Background(), "/nested/put_test.file", strings.NewReader(content)); err != nil {
+		t.Errorf("Put with context fail %v", err)
+		return
+	}
+
+	file, err := storage.GetWithContext(context.Background(), "/nested/put_test.file")
+	if err != nil {
+		t.Errorf("Get with context fail %v", err)
+		return
+	}
+	defer file.Close()
+
+	if data, _ := ioutil.ReadAll(file); string(data) != content {
+		t.Errorf("Content should be %v, but got %v", content, string(data))
+	}
+}
+
+// Canceled context should stop operations
+func Test_PutWithCanceledContext(t *testing.T) {
+	var (
+		storage     = New(t.TempDir())
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	cancel()
+
+	if _, err := storage.PutWithContext(ctx, "/canceled.file", strings.NewReader("Hello")); err != context.Canceled {
+		t.Errorf("Put with canceled context should fail with context.Canceled, but got %v", err)
+	}
+
+	if _, err := ofs.WithContext(storage).ListWithContext(ctx, "/"); err != context.Canceled {
+		t.Errorf("List with canceled context should fail with context.Canceled, but got %v", err)
+	}
+}
+
+// Stat existing and missing objects
+func Test_Stat_Object(t *testing.T) {
+	var (
+		storage = New(t.TempDir())
+		content = "Hello MayCMF"
+	)
+
+	if _, err := storage.Put("/stat_test.txt", strings.NewReader(content)); err != nil {
+		t.Errorf("Put fail %v", err)
+		return
+	}
+
+	object, err := storage.Stat("/stat_test.txt")
+	if err != nil {
+		t.Errorf("Stat fail %v", err)
+		return
+	}
+
+	if object.Path != "/stat_test.txt" || object.Size != int64(len(content)) || object.LastModified == nil || object.ETag == "" {
+		t.Errorf("Stat returned wrong object %+v", object)
+	}
+
+	if !strings.HasPrefix(object.ContentType, "text/plain") {
+		t.Errorf("Content type should be text/plain, but got %v", object.ContentType)
+	}
+
+	if _, err := storage.Stat("/missing.txt"); !errors.Is(err, ofs.ErrNotFound) {
+		t.Errorf("Stat missing object should return ErrNotFound, but got %v", err)
+	}
+}
+
+// Errors should be classified while keeping the os error reachable
+func Test_GetMissingError(t *testing.T) {
+	storage := New(t.TempDir())
+
+	_, err := storage.Get("/missing.txt")
+	if !errors.Is(err, ofs.ErrNotFound) {
+		t.Errorf("Get missing object should return ErrNotFound, but got %v", err)
+	}
+
+	var pathErr *os.PathError
+	if !errors.As(err, &pathErr) {
+		t.Errorf("Get missing object should keep *os.PathError, but got %#v", err)
+	}
+}
+
+// Put options should round trip through Stat
+func Test_PutWithOptions(t *testing.T) {
+	storage := New(t.TempDir())
+	options := &ofs.PutOptions{
+		ContentType:        "application/x-custom",
+		ContentDisposition: "attachment",
+		CacheControl:       "max-age=60",
+		Metadata:           map[string]string{"Author": "MayCMF"},
+	}
+
+	if _, err := storage.PutWithOptions(context.Background(), "/options.txt", strings.NewReader("Hello"), options); err != nil {
+		t.Errorf("Put with options fail %v", err)
+		return
+	}
+
+	object, err := storage.Stat("/options.txt")
+	if err != nil {
+		t.Errorf("Stat fail %v", err)
+		return
+	}
+
+	if object.ContentType != options.ContentType || object.ContentDisposition != options.ContentDisposition ||
+		object.CacheControl != options.CacheControl || object.Metadata["author"] != "MayCMF" {
+		t.Errorf("Stat should return put options, but got %+v", object)
+	}
+
+	if objects, _ := storage.List("/"); len(objects) != 1 {
+		t.Errorf("Sidecar files should be hidden from List, but got %v objects", len(objects))
+	}
+
+	if err := storage.Delete("/options.txt"); err != nil || PathExists(fullPath(storage, "/options.txt")+MetadataSuffix) {
+		t.Errorf("Delete should remove sidecar file, %v", err)
+	}
+}
+
+// Sidecar and temporary files shouldn't be readable
+func Test_ReservedNames(t *testing.T) {
+	storage := New(t.TempDir())
+	options := &ofs.PutOptions{Metadata: map[string]string{"secret": "x"}}
+	if _, err := storage.PutWithOptions(context.Background(), "/secret.txt", strings.NewReader("Hello"), options); err != nil {
+		t.Fatalf("Put with options fail %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(storage.Base, tempPrefix+"staging"), []byte("staging"), 0644); err != nil {
+		t.Fatalf("Write fail %v", err)
+	}
+
+	for _, path := range []string{"/secret.txt" + MetadataSuffix, "/" + tempPrefix + "staging"} {
+		if _, err := storage.Get(path); !errors.Is(err, ofs.ErrNotFound) {
+			t.Errorf("Get %v should fail with ofs.ErrNotFound, but got %v", path, err)
+		}
+		if _, err := storage.GetStream(path); !errors.Is(err, ofs.ErrNotFound) {
+			t.Errorf("GetStream %v should fail with ofs.ErrNotFound, but got %v", path, err)
+		}
+		if _, err := storage.Stat(path); !errors.Is(err, ofs.ErrNotFound) {
+			t.Errorf("Stat %v should fail with ofs.ErrNotFound, but got %v", path, err)
+		}
+		if _, err := storage.GetRange(path, 0, 1); !errors.Is(err, ofs.ErrNotFound) {
+			t.Errorf("GetRange %v should fail with ofs.ErrNotFound, but got %v", path, err)
+		}
+		if _, err := storage.OpenReaderAt(path); !errors.Is(err, ofs.ErrNotFound) {
+			t.Errorf("OpenReaderAt %v should fail with ofs.ErrNotFound, but got %v", path, err)
+		}
+	}
+}
+
+// failingReader returns some data, then an error
+type failingReader struct {
+	done bool
+}
+
+func (reader *failingReader) Read(p []byte) (int, error) {
+	if reader.done {
+		return 0, errors.New("broken reader")
+	}
+	reader.done = true
+	return copy(p, "partial"), nil
+}
+
+// Failed Put should keep the existing file and leave no temporary files
+func Test_PutAtomic(t *testing.T) {
+	storage := New(t.TempDir())
+
+	if _, err := storage.Put("/atomic.txt", strings.NewReader("Hello MayCMF")); err != nil {
+		t.Errorf("Put fail %v", err)
+		return
+	}
+
+	if _, err := storage.Put("/atomic.txt", &failingReader{}); err == nil {
+		t.Errorf("Put with failing reader should fail")
+	}
+
+	if data, _ := ioutil.ReadFile(fullPath(storage, "/atomic.txt")); string(data) != "Hello MayCMF" {
+		t.Errorf("Failed Put shouldn't change existing file, but got %q", data)
+	}
+
+	if infos, _ := ioutil.ReadDir(storage.Base); len(infos) != 1 {
+		t.Errorf("Failed Put shouldn't leave temporary files, but got %v files", len(infos))
+	}
+
+	if _, err := storage.PutWithOptions(context.Background(), "/atomic.txt", strings.NewReader("new"), &ofs.PutOptions{CreateOnly: true, ContentType: "text/x-new"}); !errors.Is(err, ofs.ErrExists) {
+		t.Errorf("Put with CreateOnly should fail with ofs.ErrExists, but got %v", err)
+	}
+
+	if infos, _ := ioutil.ReadDir(storage.Base); len(infos) != 1 {
+		t.Errorf("CreateOnly Put shouldn't leave temporary or sidecar files, but got %v files", len(infos))
+	}
+	if object, _ := storage.Stat("/atomic.txt"); object == nil || object.ContentType == "text/x-new" {
+		t.Errorf("failed CreateOnly Put shouldn't change metadata of the existing file, but got %+v", object)
+	}
+}
+
+// GetURL should escape paths and prefix them with Endpoint
+func Test_GetURL(t *testing.T) {
+	storage := New(t.TempDir())
+
+	urls := map[string]map[string]string{
+		"": {
+			"/a/b.png":         "/a/b.png",
+			"a/../b c.png":     "/b%20c.png",
+			"/.hidden/100%.md": "/.hidden/100%25.md",
+		},
+		"/uploads": {
+			"/a/b.png":  "/uploads/a/b.png",
+			"/ü/#1.png": "/uploads/%C3%BC/%231.png",
+		},
+		"https://cdn.example.com/assets/": {
+			"/a/b.png":                 "https://cdn.example.com/assets/a/b.png",
+			storage.Base + "/c/d?.png": "https://cdn.example.com/assets/c/d%3F.png",
+		},
+	}
+
+	for endpoint, paths := range urls {
+		storage.Endpoint = endpoint
+		for path, expected := range paths {
+			if url, err := storage.GetURL(path); err != nil || url != expected {
+				t.Errorf("URL of %q with endpoint %q should be %v, but got %v, %v", path, endpoint, expected, url, err)
+			}
+		}
+	}
+
+	if _, err := storage.GetURL("/../secret.txt"); !errors.Is(err, ofs.ErrInvalidPath) {
+		t.Errorf("GetURL of path outside of Base should fail with ofs.ErrInvalidPath, but got %v", err)
+	}
+
+	storage.Endpoint = "https://cdn.example.com/assets/"
+	if storage.GetEndpoint() != "https://cdn.example.com/assets/" {
+		t.Errorf("GetEndpoint should return Endpoint, but got %v", storage.GetEndpoint())
+	}
+
+	if New(t.TempDir()).GetEndpoint() != "/" {
+		t.Errorf("GetEndpoint should default to /")
+	}
+}
+
+// FileSystem should pass the conformance tests
+func Test_Conformance(t *testing.T) {
+	ofstest.TestAll(New(t.TempDir()), t)
+}
@@ -0,0 +1,134 @@
+package fs
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/MayCMF/ofs"
+)
+
+// Copy copy file src to dst with its metadata, dst is replaced atomically
+func (fileSystem FileSystem) Copy(src, dst string) (*ofs.Object, error) {
+	return fileSystem.copyFrom(fileSystem, src, dst)
+}
+
+// CopyFrom copy file srcPath of another FileSystem into dstPath with its metadata, other storages are unsupported
+func (fileSystem FileSystem) CopyFrom(ctx context.Context, src ofs.StorageInterface, srcPath, dstPath string) (*ofs.Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	switch storage := src.(type) {
+	case FileSystem:
+		return fileSystem.copyFrom(storage, srcPath, dstPath)
+	case *FileSystem:
+		return fileSystem.copyFrom(*storage, srcPath, dstPath)
+	}
+	return nil, ofs.NewError("copy", srcPath, ofs.ErrUnsupported, nil)
+}
+
+func (fileSystem FileSystem) copyFrom(srcFileSystem FileSystem, src, dst string) (*ofs.Object, error) {
+	srcpath, err := srcFileSystem.GetFullPath(src)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(srcpath)
+	if err != nil {
+		return nil, wrapError("copy", src, err)
+	}
+	defer file.Close()
+
+	if info, err := file.Stat(); err != nil || info.IsDir() {
+		return nil, ofs.NewError("copy", src, ofs.ErrNotFound, err)
+	}
+
+	meta, err := readMetadata(srcpath)
+	if err != nil {
+		return nil, wrapError("copy", src, err)
+	}
+
+	writer, err := fileSystem.OpenWriter(dst, meta.options())
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = io.Copy(writer, file); err != nil {
+		writer.Abort()
+		return nil, wrapError("copy", dst, err)
+	}
+
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+	return fileSystem.Stat(dst)
+}
+
+// Move move file src to dst with its metadata, it is a rename if both are on the same device, and a copy and delete otherwise,
+// the sidecar file is moved along, so dst never keeps metadata of the object it replaced
+func (fileSystem FileSystem) Move(src, dst string) (*ofs.Object, error) {
+	if isInternalFile(dst) {
+		return nil, ofs.NewError("move", dst, ofs.ErrInvalidPath, nil)
+	}
+
+	srcpath, err := fileSystem.GetFullPath(src)
+	if err != nil {
+		return nil, err
+	}
+
+	dstpath, err := fileSystem.GetFullPath(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	if info, err := os.Stat(srcpath); err != nil || info.IsDir() {
+		if err == nil {
+			return nil, ofs.NewError("move", src, ofs.ErrNotFound, nil)
+		}
+		return nil, wrapError("move", src, err)
+	}
+
+	if err := CheckDir(filepath.Dir(dstpath)); err != nil {
+		return nil, wrapError("move", dst, err)
+	}
+
+	// the sidecar is moved aside first, so it follows the object once that has been renamed, or is put back otherwise
+	staged := &stagedMetadata{fullpath: dstpath}
+	if _, err := os.Stat(srcpath + MetadataSuffix); err == nil {
+		file, err := ioutil.TempFile(filepath.Dir(srcpath), tempPrefix+"*")
+		if err != nil {
+			return nil, wrapError("move", src, err)
+		}
+		file.Close()
+
+		if err = os.Rename(srcpath+MetadataSuffix, file.Name()); err != nil {
+			os.Remove(file.Name())
+			return nil, wrapError("move", src, err)
+		}
+		staged.tempPath = file.Name()
+	} else if !os.IsNotExist(err) {
+		return nil, wrapError("move", src, err)
+	}
+
+	if err := os.Rename(srcpath, dstpath); err != nil {
+		if staged.tempPath != "" {
+			os.Rename(staged.tempPath, srcpath+MetadataSuffix)
+		}
+		if !isCrossDevice(err) {
+			return nil, wrapError("move", src, err)
+		}
+
+		// src and dst are on different devices, fall back to copy and delete
+		object, err := fileSystem.Copy(src, dst)
+		if err != nil {
+			return nil, err
+		}
+		return object, fileSystem.Delete(src)
+	}
+
+	staged.commit()
+	return fileSystem.Stat(dst)
+}
@@ -0,0 +1,91 @@
+package fs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/MayCMF/ofs"
+)
+
+// Copy and move objects with their metadata
+func Test_CopyMoveObject(t *testing.T) {
+	storage := New(t.TempDir())
+	options := &ofs.PutOptions{ContentType: "text/x-custom", Metadata: map[string]string{"owner": "MayCMF"}}
+
+	if _, err := storage.PutWithOptions(context.Background(), "/src.txt", strings.NewReader("Hello MayCMF"), options); err != nil {
+		t.Errorf("Put fail %v", err)
+		return
+	}
+
+	copied, err := storage.Copy("/src.txt", "/copy/dst.txt")
+	if err != nil {
+		t.Errorf("Copy fail %v", err)
+		return
+	}
+
+	if copied.ContentType != "text/x-custom" || copied.Metadata["owner"] != "MayCMF" {
+		t.Errorf("Copy should preserve metadata, but got %+v", copied)
+	}
+
+	moved, err := storage.Move("/copy/dst.txt", "/moved.txt")
+	if err != nil {
+		t.Errorf("Move fail %v", err)
+		return
+	}
+
+	if moved.Metadata["owner"] != "MayCMF" {
+		t.Errorf("Move should preserve metadata, but got %+v", moved)
+	}
+
+	if PathExists(fullPath(storage, "/copy/dst.txt")) || PathExists(fullPath(storage, "/copy/dst.txt")+MetadataSuffix) {
+		t.Errorf("Moved file should be removed")
+	}
+
+	if data, _ := ioutil.ReadFile(fullPath(storage, "/moved.txt")); string(data) != "Hello MayCMF" {
+		t.Errorf("Moved content should be Hello MayCMF, but got %v", string(data))
+	}
+
+	if _, err := storage.Put("/plain.txt", strings.NewReader("plain")); err != nil {
+		t.Errorf("Put fail %v", err)
+		return
+	}
+	if moved, err = storage.Move("/plain.txt", "/moved.txt"); err != nil || moved.Metadata["owner"] != "" {
+		t.Errorf("Move should replace metadata of the replaced object, but got %+v, %v", moved, err)
+	}
+	if PathExists(fullPath(storage, "/moved.txt") + MetadataSuffix) {
+		t.Errorf("Move should remove the sidecar file of the replaced object")
+	}
+	if infos, _ := ioutil.ReadDir(storage.Base); len(infos) != 4 {
+		t.Errorf("Move shouldn't leave temporary files, but got %v files", len(infos))
+	}
+
+	if err := os.MkdirAll(fullPath(storage, "/dir/nested"), 0755); err != nil {
+		t.Fatalf("MkdirAll fail %v", err)
+	}
+	if _, err := storage.Move("/src.txt", "/dir"); err == nil {
+		t.Errorf("Move onto a directory should fail")
+	}
+	if object, err := storage.Stat("/src.txt"); err != nil || object.Metadata["owner"] != "MayCMF" {
+		t.Errorf("failed Move should keep the source with its metadata, but got %+v, %v", object, err)
+	}
+
+	if _, err := storage.Copy("/missing.txt", "/dst.txt"); err == nil {
+		t.Errorf("Copy missing file should fail")
+	}
+}
+
+// Only renames across devices should fall back to copies
+func Test_IsCrossDevice(t *testing.T) {
+	if !isCrossDevice(&os.LinkError{Op: "rename", Err: syscall.EXDEV}) {
+		t.Errorf("EXDEV should be a cross device rename")
+	}
+	for _, err := range []error{syscall.EACCES, syscall.ENOSPC, syscall.ENOTDIR} {
+		if isCrossDevice(&os.LinkError{Op: "rename", Err: err}) {
+			t.Errorf("%v shouldn't be a cross device rename", err)
+		}
+	}
+}
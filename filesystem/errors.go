@@ -0,0 +1,30 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"github.com/MayCMF/ofs"
+)
+
+// wrapError classify os errors as ofs errors, the original *os.PathError stays reachable with errors.As
+func wrapError(op, path string, err error) error {
+	var ofsErr *ofs.Error
+	if err == nil || errors.As(err, &ofsErr) {
+		return err
+	}
+
+	var kind error
+	switch {
+	case errors.Is(err, os.ErrNotExist), errors.Is(err, syscall.ENOTDIR):
+		kind = ofs.ErrNotFound
+	case errors.Is(err, os.ErrPermission):
+		kind = ofs.ErrPermission
+	case errors.Is(err, os.ErrExist):
+		kind = ofs.ErrExists
+	case errors.Is(err, syscall.ENAMETOOLONG), errors.Is(err, syscall.EINVAL):
+		kind = ofs.ErrInvalidPath
+	}
+	return ofs.NewError(op, path, kind, err)
+}
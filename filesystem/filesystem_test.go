@@ -83,9 +83,17 @@ func Test_CheckDirIfParentDirNotExist(t *testing.T) {
 
 // Read Directory testing
 func Test_ReadDir(t *testing.T) {
-	var (
-		distDir = path.Join("./")
-	)
+	distDir, err := ioutil.TempDir("", "ofs_readdir_test")
+	if err != nil {
+		t.Fatalf("Create temp dir fail %v", err)
+	}
+	defer os.RemoveAll(distDir)
+
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err = ioutil.WriteFile(path.Join(distDir, name), []byte(name), os.ModePerm); err != nil {
+			t.Fatalf("Write file fail %v", err)
+		}
+	}
 
 	if files, err := ReadDir(distDir); err != nil {
 		t.Error("ReadDir Fail.")
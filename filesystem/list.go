@@ -0,0 +1,118 @@
+package fs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/MayCMF/ofs"
+)
+
+// ListPage list one page of entries under path in path order, reading only the directories needed for the page,
+// the continuation token is the path of the page's last entry
+func (fileSystem FileSystem) ListPage(ctx context.Context, path string, options ofs.ListOptions) (*ofs.ListResult, error) {
+	var (
+		result     = &ofs.ListResult{}
+		prefix     = ofs.DirPrefix(path)
+		startAfter = options.StartAfter
+		maxKeys    = options.MaxKeys
+	)
+
+	if options.ContinuationToken > startAfter {
+		startAfter = options.ContinuationToken
+	}
+
+	if maxKeys <= 0 {
+		maxKeys = ofs.DefaultMaxKeys
+	}
+
+	// collect one more entry than needed to know whether there is a next page
+	_, err := fileSystem.listDir(ctx, prefix, options.Recursive, startAfter, func(object *ofs.Object) bool {
+		result.Objects = append(result.Objects, object)
+		return len(result.Objects) <= maxKeys
+	})
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, nil
+		}
+		return nil, wrapError("list", path, err)
+	}
+
+	if len(result.Objects) > maxKeys {
+		result.Objects = result.Objects[:maxKeys]
+		result.NextContinuationToken = result.Objects[maxKeys-1].Path
+	}
+	return result, nil
+}
+
+// listDir call fn for entries of directory prefix sorted by path, skipping entries not after startAfter,
+// stop and return false once fn returns false
+func (fileSystem FileSystem) listDir(ctx context.Context, prefix string, recursive bool, startAfter string, fn func(*ofs.Object) bool) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	fullpath, err := fileSystem.GetFullPath(prefix)
+	if err != nil {
+		return false, err
+	}
+
+	infos, err := ioutil.ReadDir(fullpath)
+	if err != nil {
+		return false, err
+	}
+
+	type entry struct {
+		key  string
+		info os.FileInfo
+	}
+
+	entries := make([]entry, 0, len(infos))
+	for _, info := range infos {
+		if isInternalFile(info.Name()) {
+			continue
+		}
+
+		key := prefix + info.Name()
+		if info.IsDir() {
+			key += "/"
+		}
+		entries = append(entries, entry{key: key, info: info})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+	for _, e := range entries {
+		if e.info.IsDir() {
+			// skip directories that only contain entries before startAfter
+			if e.key <= startAfter && !strings.HasPrefix(startAfter, e.key) {
+				continue
+			}
+
+			if recursive {
+				if more, err := fileSystem.listDir(ctx, e.key, recursive, startAfter, fn); !more || err != nil {
+					return more, err
+				}
+				continue
+			}
+		}
+
+		if e.key <= startAfter {
+			continue
+		}
+
+		object := &ofs.Object{Path: e.key, Name: e.info.Name(), IsDir: e.info.IsDir(), StorageInterface: fileSystem}
+		if !e.info.IsDir() {
+			modTime := e.info.ModTime()
+			object.LastModified = &modTime
+			object.Size = e.info.Size()
+		}
+
+		if !fn(object) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,52 @@
+package fs
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/MayCMF/ofs"
+)
+
+func listPaths(t *testing.T, storage *FileSystem, path string, options ofs.ListOptions) (paths []string) {
+	err := ofs.Walk(context.Background(), storage, path, options, func(object *ofs.Object) error {
+		paths = append(paths, object.Path)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Walk fail %v", err)
+	}
+	return
+}
+
+// List page by page, recursively and one level
+func Test_ListPage(t *testing.T) {
+	storage := New(t.TempDir())
+	for _, path := range []string{"/a.txt", "/a/b.txt", "/a/c/d.txt", "/a0.txt", "/z.txt"} {
+		if _, err := storage.Put(path, strings.NewReader(path)); err != nil {
+			t.Errorf("Put %v fail %v", path, err)
+			return
+		}
+	}
+
+	recursive := listPaths(t, storage, "/", ofs.ListOptions{Recursive: true, MaxKeys: 2})
+	if expected := []string{"/a.txt", "/a/b.txt", "/a/c/d.txt", "/a0.txt", "/z.txt"}; !reflect.DeepEqual(recursive, expected) {
+		t.Errorf("Recursive list should be %v, but got %v", expected, recursive)
+	}
+
+	oneLevel := listPaths(t, storage, "/", ofs.ListOptions{MaxKeys: 1})
+	if expected := []string{"/a.txt", "/a/", "/a0.txt", "/z.txt"}; !reflect.DeepEqual(oneLevel, expected) {
+		t.Errorf("One level list should be %v, but got %v", expected, oneLevel)
+	}
+
+	startAfter := listPaths(t, storage, "/a", ofs.ListOptions{Recursive: true, StartAfter: "/a/b.txt"})
+	if expected := []string{"/a/c/d.txt"}; !reflect.DeepEqual(startAfter, expected) {
+		t.Errorf("List after /a/b.txt should be %v, but got %v", expected, startAfter)
+	}
+
+	result, err := storage.ListPage(context.Background(), "/", ofs.ListOptions{Recursive: true, MaxKeys: 3})
+	if err != nil || len(result.Objects) != 3 || result.NextContinuationToken != "/a/c/d.txt" {
+		t.Errorf("First page should have 3 objects and a continuation token, but got %+v, %v", result, err)
+	}
+}
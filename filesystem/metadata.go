@@ -0,0 +1,140 @@
+package fs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MayCMF/ofs"
+)
+
+// MetadataSuffix suffix of sidecar files that keep objects' PutOptions, e.g. `image.png.ofsmeta`, they are hidden from listings
+const MetadataSuffix = ".ofsmeta"
+
+// metadata content of a sidecar file
+type metadata struct {
+	ContentType        string            `json:"content_type,omitempty"`
+	ContentDisposition string            `json:"content_disposition,omitempty"`
+	ContentEncoding    string            `json:"content_encoding,omitempty"`
+	CacheControl       string            `json:"cache_control,omitempty"`
+	ACL                string            `json:"acl,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+}
+
+func (meta metadata) isZero() bool {
+	return meta.ContentType == "" && meta.ContentDisposition == "" && meta.ContentEncoding == "" &&
+		meta.CacheControl == "" && meta.ACL == "" && len(meta.Metadata) == 0
+}
+
+func isMetadataFile(path string) bool {
+	return strings.HasSuffix(path, MetadataSuffix)
+}
+
+// stagedMetadata sidecar file written next to its object before the object is committed, so committing it can't fail halfway
+type stagedMetadata struct {
+	fullpath string
+	// tempPath synced temporary file with the sidecar's content, empty if the object has no options, a stale sidecar is removed then
+	tempPath string
+}
+
+// stageMetadata save options into a temporary sidecar file of fullpath, commit it once the object is committed, discard it otherwise
+func stageMetadata(fullpath string, options *ofs.PutOptions) (*stagedMetadata, error) {
+	if options == nil {
+		options = &ofs.PutOptions{}
+	}
+
+	meta := metadata{
+		ContentType:        options.ContentType,
+		ContentDisposition: options.ContentDisposition,
+		ContentEncoding:    options.ContentEncoding,
+		CacheControl:       options.CacheControl,
+		ACL:                options.ACL,
+		Metadata:           options.NormalizedMetadata(),
+	}
+
+	staged := &stagedMetadata{fullpath: fullpath}
+	if meta.isZero() {
+		return staged, nil
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(fullpath), tempPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	staged.tempPath = file.Name()
+	return staged, nil
+}
+
+// commit move the staged sidecar into place, errors aren't returned as the object has been committed already,
+// if it can't be moved the stale sidecar is removed, so the object falls back to default metadata instead of the previous one
+func (staged *stagedMetadata) commit() {
+	sidecar := staged.fullpath + MetadataSuffix
+	if staged.tempPath == "" || os.Rename(staged.tempPath, sidecar) != nil {
+		staged.discard()
+		os.Remove(sidecar)
+	}
+	syncDir(filepath.Dir(staged.fullpath))
+}
+
+// discard remove the staged sidecar
+func (staged *stagedMetadata) discard() {
+	if staged.tempPath != "" {
+		os.Remove(staged.tempPath)
+	}
+}
+
+// readMetadata read the sidecar file of fullpath, return empty metadata if there is none
+func readMetadata(fullpath string) (meta metadata, err error) {
+	data, err := ioutil.ReadFile(fullpath + MetadataSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return meta, nil
+		}
+		return meta, err
+	}
+	err = json.Unmarshal(data, &meta)
+	return meta, err
+}
+
+// apply copy metadata into object
+func (meta metadata) apply(object *ofs.Object) {
+	if meta.ContentType != "" {
+		object.ContentType = meta.ContentType
+	}
+	object.ContentDisposition = meta.ContentDisposition
+	object.ContentEncoding = meta.ContentEncoding
+	object.CacheControl = meta.CacheControl
+	object.Metadata = meta.Metadata
+}
+
+// options return metadata as PutOptions
+func (meta metadata) options() *ofs.PutOptions {
+	return &ofs.PutOptions{
+		ContentType:        meta.ContentType,
+		ContentDisposition: meta.ContentDisposition,
+		ContentEncoding:    meta.ContentEncoding,
+		CacheControl:       meta.CacheControl,
+		ACL:                meta.ACL,
+		Metadata:           meta.Metadata,
+	}
+}
@@ -0,0 +1,40 @@
+package fs
+
+import (
+	"errors"
+	"net/url"
+
+	"github.com/MayCMF/ofs"
+)
+
+func init() {
+	ofs.Register("file", Open)
+}
+
+// Open initialize FileSystem storage from a URL like `file:///var/uploads?endpoint=/uploads`, it is registered as scheme `file` of ofs.Open,
+// relative bases are written as `file:uploads`, parameters:
+//
+//	endpoint  Endpoint
+func Open(u *url.URL) (ofs.StorageInterface, error) {
+	if u.Host != "" && u.Host != "localhost" {
+		return nil, errors.New("remote host " + u.Host + " isn't supported, use file:///path")
+	}
+
+	base := u.Path
+	if u.Opaque != "" {
+		base = u.Opaque
+	}
+	if base == "" {
+		return nil, errors.New("missing directory, e.g. file:///var/uploads")
+	}
+
+	params := ofs.NewURLParams(u)
+	endpoint := params.String("endpoint")
+	if err := params.Err(); err != nil {
+		return nil, err
+	}
+
+	fileSystem := New(base)
+	fileSystem.Endpoint = endpoint
+	return fileSystem, nil
+}
@@ -0,0 +1,33 @@
+package fs
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/MayCMF/ofs"
+)
+
+func Test_Open(t *testing.T) {
+	dir := t.TempDir()
+
+	storage, err := ofs.Open("file://" + filepath.ToSlash(dir) + "?endpoint=/uploads")
+	if err != nil {
+		t.Fatalf("Open fail %v", err)
+	}
+	if fileSystem, ok := storage.(*FileSystem); !ok || fileSystem.Base != dir || fileSystem.Endpoint != "/uploads" {
+		t.Errorf("Open should initialize FileSystem, but got %#v", storage)
+	}
+
+	if storage, err := ofs.Open("file:uploads"); err != nil {
+		t.Errorf("Open fail %v", err)
+	} else if abs, _ := filepath.Abs("uploads"); storage.(*FileSystem).Base != abs {
+		t.Errorf("relative base should be resolved, but got %v", storage.(*FileSystem).Base)
+	}
+
+	for _, rawURL := range []string{"file://server/share", "file://", "file:///tmp?acl=private"} {
+		if _, err := ofs.Open(rawURL); !errors.Is(err, ofs.ErrInvalidConfig) {
+			t.Errorf("Open(%q) should fail with ErrInvalidConfig, but got %v", rawURL, err)
+		}
+	}
+}
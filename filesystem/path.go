@@ -0,0 +1,35 @@
+package fs
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	errOutsideBase  = errors.New("path resolves outside of the storage's base directory")
+	errReservedName = errors.New("reserved file name")
+)
+
+// resolveExisting evaluate symlinks of the deepest resolvable ancestor of fullpath, keeping the missing tail as it is
+func resolveExisting(fullpath string) string {
+	var tail []string
+	for {
+		resolved, err := filepath.EvalSymlinks(fullpath)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, tail...)...)
+		}
+		parent := filepath.Dir(fullpath)
+		if parent == fullpath {
+			return filepath.Join(append([]string{fullpath}, tail...)...)
+		}
+		tail = append([]string{filepath.Base(fullpath)}, tail...)
+		fullpath = parent
+	}
+}
+
+// isWithin report whether target is base or inside of it
+func isWithin(base, target string) bool {
+	rel, err := filepath.Rel(base, target)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
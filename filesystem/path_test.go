@@ -0,0 +1,98 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MayCMF/ofs"
+)
+
+// fullPath get full path of a path that is known to be inside of the storage
+func fullPath(storage *FileSystem, path string) string {
+	fullpath, _ := storage.GetFullPath(path)
+	return fullpath
+}
+
+// Paths escaping Base should be rejected
+func Test_GetFullPathEscape(t *testing.T) {
+	var (
+		dir     = t.TempDir()
+		storage = New(filepath.Join(dir, "base"))
+	)
+
+	if err := os.MkdirAll(storage.Base, os.ModePerm); err != nil {
+		t.Fatalf("MkdirAll fail %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatalf("WriteFile fail %v", err)
+	}
+	if err := os.Symlink(dir, filepath.Join(storage.Base, "link")); err != nil {
+		t.Skipf("Symlink isn't supported %v", err)
+	}
+
+	for _, path := range []string{
+		"../secret.txt",
+		"../../../../etc/passwd",
+		"/a/../../secret.txt",
+		"a/b/../../../secret.txt",
+		"/../secret.txt",
+		storage.Base + "/../secret.txt",
+		"/link/secret.txt",
+		"/link/new/file.txt",
+		"/file\x00.txt",
+	} {
+		if _, err := storage.GetFullPath(path); !errors.Is(err, ofs.ErrInvalidPath) {
+			t.Errorf("%q should be an invalid path, but got %v", path, err)
+		}
+
+		if _, err := storage.Put(path, strings.NewReader("evil")); !errors.Is(err, ofs.ErrInvalidPath) {
+			t.Errorf("Put %q should be rejected, but got %v", path, err)
+		}
+
+		if _, err := storage.Stat(path); !errors.Is(err, ofs.ErrInvalidPath) {
+			t.Errorf("Stat %q should be rejected, but got %v", path, err)
+		}
+
+		if err := storage.Delete(path); !errors.Is(err, ofs.ErrInvalidPath) {
+			t.Errorf("Delete %q should be rejected, but got %v", path, err)
+		}
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(dir, "secret.txt")); string(data) != "secret" {
+		t.Errorf("file outside of Base shouldn't be touched, but got %q", data)
+	}
+}
+
+// Paths inside Base should be resolved, paths only sharing Base as string prefix stay inside of Base
+func Test_GetFullPathInside(t *testing.T) {
+	storage := New(t.TempDir())
+
+	paths := map[string]string{
+		"/a/b.txt":                    filepath.Join(storage.Base, "a", "b.txt"),
+		"a/../b.txt":                  filepath.Join(storage.Base, "b.txt"),
+		storage.Base + "/c/d.txt":     filepath.Join(storage.Base, "c", "d.txt"),
+		storage.Base + "-evil/e.txt":  filepath.Join(storage.Base, storage.Base+"-evil", "e.txt"),
+		storage.Base + "/c/../../x/y": "",
+	}
+
+	for path, expected := range paths {
+		fullpath, err := storage.GetFullPath(path)
+		if expected == "" {
+			if err == nil {
+				t.Errorf("%q should be rejected, but got %v", path, fullpath)
+			}
+			continue
+		}
+
+		if err != nil || fullpath != expected {
+			t.Errorf("%q should be resolved to %v, but got %v, %v", path, expected, fullpath, err)
+		}
+	}
+
+	if err := storage.Delete("/"); !errors.Is(err, ofs.ErrInvalidPath) {
+		t.Errorf("deleting the base directory should be rejected, but got %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package fs
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/MayCMF/ofs"
+)
+
+// GetRange get length bytes of the file starting at offset, or till the end if length is negative
+func (fileSystem FileSystem) GetRange(path string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 {
+		return nil, ofs.NewError("get range", path, ofs.ErrInvalidPath, fmt.Errorf("negative offset %d", offset))
+	}
+	fullpath, err := fileSystem.GetFullPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(fullpath)
+	if err != nil {
+		return nil, wrapError("get range", path, err)
+	}
+
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, wrapError("get range", path, err)
+	}
+	return ofs.LimitReadCloser(file, length), nil
+}
+
+// OpenReaderAt open the file for random access
+func (fileSystem FileSystem) OpenReaderAt(path string) (ofs.ObjectReader, error) {
+	fullpath, err := fileSystem.GetFullPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(fullpath)
+	if err != nil {
+		return nil, wrapError("open reader", path, err)
+	}
+
+	reader, err := ofs.NewFileReader(file)
+	return reader, wrapError("open reader", path, err)
+}
@@ -0,0 +1,52 @@
+package fs
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// Read part of a file
+func Test_GetRange(t *testing.T) {
+	storage := New(t.TempDir())
+	storage.Put("/range.txt", strings.NewReader("Hello MayCMF"))
+
+	reader, err := storage.GetRange("/range.txt", 6, 3)
+	if err != nil {
+		t.Errorf("Get range fail %v", err)
+		return
+	}
+	defer reader.Close()
+
+	if data, _ := ioutil.ReadAll(reader); string(data) != "May" {
+		t.Errorf("Range should be May, but got %v", string(data))
+	}
+}
+
+// Random access to a file
+func Test_OpenReaderAt(t *testing.T) {
+	storage := New(t.TempDir())
+	storage.Put("/reader_at.txt", strings.NewReader("Hello MayCMF"))
+
+	reader, err := storage.OpenReaderAt("/reader_at.txt")
+	if err != nil {
+		t.Errorf("Open reader fail %v", err)
+		return
+	}
+	defer reader.Close()
+
+	if reader.Size() != 12 {
+		t.Errorf("Size should be 12, but got %v", reader.Size())
+	}
+
+	buffer := make([]byte, 3)
+	if _, err := reader.ReadAt(buffer, 9); err != nil || string(buffer) != "CMF" {
+		t.Errorf("ReadAt should read CMF, but got %q, %v", buffer, err)
+	}
+
+	reader.Seek(-6, io.SeekEnd)
+	if data, _ := ioutil.ReadAll(reader); string(data) != "MayCMF" {
+		t.Errorf("Read after seek should be MayCMF, but got %v", string(data))
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !plan9
+
+package fs
+
+import (
+	"errors"
+	"runtime"
+	"syscall"
+)
+
+// errNotSameDevice ERROR_NOT_SAME_DEVICE returned by renames across volumes on Windows
+const errNotSameDevice = syscall.Errno(17)
+
+// isCrossDevice report whether a rename failed because source and destination are on different devices
+func isCrossDevice(err error) bool {
+	var errno syscall.Errno
+	if runtime.GOOS == "windows" && errors.As(err, &errno) && errno == errNotSameDevice {
+		return true
+	}
+	return errors.Is(err, syscall.EXDEV)
+}
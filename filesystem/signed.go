@@ -0,0 +1,162 @@
+package fs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MayCMF/ofs"
+)
+
+// SigningKey HMAC key of signed URLs, the ID is embedded into signed URLs, so keys could be rotated:
+// put the new key first to sign new URLs with it, and keep old keys until their URLs expired
+type SigningKey struct {
+	ID     string
+	Secret []byte
+}
+
+// SignOptions options of GetSignedURL
+type SignOptions struct {
+	// ContentDisposition Content-Disposition header of the response, e.g. `attachment; filename="report.pdf"`
+	ContentDisposition string
+}
+
+// query parameters of signed URLs
+const (
+	signedExpiresParam     = "expires"
+	signedKeyParam         = "key"
+	signedDispositionParam = "disposition"
+	signedSignatureParam   = "signature"
+)
+
+var (
+	errNoSigningKey     = errors.New("no signing key")
+	errInvalidSignature = errors.New("invalid signature")
+	errURLExpired       = errors.New("signed URL expired")
+)
+
+// GetSignedURL get URL of path that expires after expiry, signed with the first of SigningKeys, serve it with SignedHandler
+func (fileSystem FileSystem) GetSignedURL(path string, expiry time.Duration, options *SignOptions) (string, error) {
+	if len(fileSystem.SigningKeys) == 0 {
+		return "", ofs.NewError("sign url", path, nil, errNoSigningKey)
+	}
+
+	objectPath, err := fileSystem.objectPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	if options == nil {
+		options = &SignOptions{}
+	}
+
+	var (
+		key     = fileSystem.SigningKeys[0]
+		expires = strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+		query   = url.Values{}
+	)
+
+	query.Set(signedExpiresParam, expires)
+	query.Set(signedKeyParam, key.ID)
+	if options.ContentDisposition != "" {
+		query.Set(signedDispositionParam, options.ContentDisposition)
+	}
+	query.Set(signedSignatureParam, sign(key, objectPath, expires, options.ContentDisposition))
+
+	urlPath := (&url.URL{Path: objectPath}).EscapedPath()
+	return strings.TrimSuffix(fileSystem.Endpoint, "/") + urlPath + "?" + query.Encode(), nil
+}
+
+// VerifySignedURL verify the signature and expiry of a signed URL, path is relative to Endpoint,
+// returns an error of kind ofs.ErrPermission if the URL isn't valid
+func (fileSystem FileSystem) VerifySignedURL(path string, query url.Values) (*SignOptions, error) {
+	objectPath, err := fileSystem.objectPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		expires     = query.Get(signedExpiresParam)
+		keyID       = query.Get(signedKeyParam)
+		disposition = query.Get(signedDispositionParam)
+		signature   = query.Get(signedSignatureParam)
+		valid       bool
+	)
+
+	for _, key := range fileSystem.SigningKeys {
+		if key.ID == keyID {
+			valid = hmac.Equal([]byte(signature), []byte(sign(key, objectPath, expires, disposition)))
+			break
+		}
+	}
+
+	if !valid {
+		return nil, ofs.NewError("verify url", path, ofs.ErrPermission, errInvalidSignature)
+	}
+
+	if unix, err := strconv.ParseInt(expires, 10, 64); err != nil || time.Now().Unix() > unix {
+		return nil, ofs.NewError("verify url", path, ofs.ErrPermission, errURLExpired)
+	}
+	return &SignOptions{ContentDisposition: disposition}, nil
+}
+
+// sign HMAC-SHA256 signature of a signed URL's fields
+func sign(key SigningKey, objectPath, expires, disposition string) string {
+	mac := hmac.New(sha256.New, key.Secret)
+	mac.Write([]byte(strings.Join([]string{objectPath, expires, key.ID, disposition}, "\n")))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignedHandler serve files of signed URLs, requests with invalid or expired signatures are forbidden,
+// mount it under Endpoint with http.StripPrefix, e.g. `http.Handle("/private/", http.StripPrefix("/private", storage.SignedHandler()))`
+func (fileSystem FileSystem) SignedHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		options, err := fileSystem.VerifySignedURL(req.URL.Path, req.URL.Query())
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		object, err := fileSystem.Stat(req.URL.Path)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+
+		file, err := fileSystem.Get(req.URL.Path)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		defer file.Close()
+
+		if object.ContentType != "" {
+			w.Header().Set("Content-Type", object.ContentType)
+		}
+		if options.ContentDisposition != "" {
+			w.Header().Set("Content-Disposition", options.ContentDisposition)
+		} else if object.ContentDisposition != "" {
+			w.Header().Set("Content-Disposition", object.ContentDisposition)
+		}
+		w.Header().Set("Cache-Control", "private")
+		http.ServeContent(w, req, object.Name, *object.LastModified, file)
+	})
+}
+
+// serveError reply with the status code of err
+func serveError(w http.ResponseWriter, err error) {
+	status := ofs.HTTPStatus(err)
+	http.Error(w, http.StatusText(status), status)
+}
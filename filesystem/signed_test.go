@@ -0,0 +1,92 @@
+package fs
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MayCMF/ofs"
+)
+
+// Signed URLs should be served until they expire, and tampered URLs should be forbidden
+func Test_SignedURL(t *testing.T) {
+	storage := New(t.TempDir())
+	storage.Endpoint = "/private"
+	storage.SigningKeys = []SigningKey{{ID: "2024", Secret: []byte("new secret")}, {ID: "2023", Secret: []byte("old secret")}}
+
+	if _, err := storage.Put("/docs/report 1.txt", strings.NewReader("Hello MayCMF")); err != nil {
+		t.Fatalf("Put fail %v", err)
+	}
+
+	server := httptest.NewServer(http.StripPrefix("/private", storage.SignedHandler()))
+	defer server.Close()
+
+	get := func(signedURL string) (*http.Response, string) {
+		resp, err := http.Get(server.URL + signedURL)
+		if err != nil {
+			t.Fatalf("Get %v fail %v", signedURL, err)
+		}
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		return resp, string(data)
+	}
+
+	signedURL, err := storage.GetSignedURL("/docs/report 1.txt", time.Minute, &SignOptions{ContentDisposition: `attachment; filename="report.txt"`})
+	if err != nil || !strings.HasPrefix(signedURL, "/private/docs/report%201.txt?") {
+		t.Fatalf("GetSignedURL should return URL under Endpoint, but got %v, %v", signedURL, err)
+	}
+
+	if resp, body := get(signedURL); resp.StatusCode != http.StatusOK || body != "Hello MayCMF" || resp.Header.Get("Content-Disposition") != `attachment; filename="report.txt"` {
+		t.Errorf("signed URL should serve the file, but got %v %q %v", resp.StatusCode, body, resp.Header)
+	}
+
+	u, _ := url.Parse(signedURL)
+	tampered := map[string]func(url.Values){
+		"disposition": func(query url.Values) { query.Set("disposition", "inline") },
+		"expires":     func(query url.Values) { query.Set("expires", "99999999999") },
+		"key":         func(query url.Values) { query.Set("key", "2023") },
+		"signature":   func(query url.Values) { query.Del("signature") },
+	}
+	for name, tamper := range tampered {
+		query := u.Query()
+		tamper(query)
+		if resp, _ := get(u.Path + "?" + query.Encode()); resp.StatusCode != http.StatusForbidden {
+			t.Errorf("URL with tampered %v should be forbidden, but got %v", name, resp.StatusCode)
+		}
+	}
+
+	if resp, _ := get(strings.Replace(signedURL, "report%201.txt", "other.txt", 1)); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("signature shouldn't be valid for other paths, but got %v", resp.StatusCode)
+	}
+
+	expiredURL, _ := storage.GetSignedURL("/docs/report 1.txt", -time.Minute, nil)
+	if resp, _ := get(expiredURL); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expired URL should be forbidden, but got %v", resp.StatusCode)
+	}
+
+	// URLs signed with a retired key stay valid while the key is kept
+	oldStorage := *storage
+	oldStorage.SigningKeys = storage.SigningKeys[1:]
+	oldURL, _ := oldStorage.GetSignedURL("/docs/report 1.txt", time.Minute, nil)
+	if resp, _ := get(oldURL); resp.StatusCode != http.StatusOK {
+		t.Errorf("URL signed with an old key should be valid, but got %v", resp.StatusCode)
+	}
+
+	missingURL, _ := storage.GetSignedURL("/docs/missing.txt", time.Minute, nil)
+	if resp, _ := get(missingURL); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("signed URL of missing file should be not found, but got %v", resp.StatusCode)
+	}
+
+	if _, err := storage.VerifySignedURL("/docs/report 1.txt", url.Values{}); !errors.Is(err, ofs.ErrPermission) {
+		t.Errorf("unsigned URL should fail with ofs.ErrPermission, but got %v", err)
+	}
+
+	if _, err := New(t.TempDir()).GetSignedURL("/docs/report 1.txt", time.Minute, nil); err == nil {
+		t.Errorf("GetSignedURL without signing keys should fail")
+	}
+}
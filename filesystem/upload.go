@@ -0,0 +1,206 @@
+package fs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/MayCMF/ofs"
+)
+
+// uploadMetadata options of a resumable upload, kept in the sidecar file of its staging file
+type uploadMetadata struct {
+	metadata
+	CreateOnly bool `json:"create_only,omitempty"`
+}
+
+// stagingPath get the staging file of upload id of path, it is a hidden temporary file next to path
+func (fileSystem FileSystem) stagingPath(op, path, uploadID string) (string, error) {
+	if id, err := hex.DecodeString(uploadID); err != nil || len(id) != 16 {
+		return "", ofs.NewError(op, path, ofs.ErrNotFound, errors.New("invalid upload id"))
+	}
+
+	fullpath, err := fileSystem.GetFullPath(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(fullpath), tempPrefix+"upload-"+uploadID), nil
+}
+
+// CreateUpload start a resumable upload of path, data is appended to a temporary file next to path,
+// which is renamed to path on CompleteUpload
+func (fileSystem FileSystem) CreateUpload(ctx context.Context, path string, options *ofs.PutOptions) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if isInternalFile(path) {
+		return "", ofs.NewError("create upload", path, ofs.ErrInvalidPath, errReservedName)
+	}
+
+	if options == nil {
+		options = &ofs.PutOptions{}
+	}
+
+	fullpath, err := fileSystem.GetFullPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	if options.CreateOnly && PathExists(fullpath) {
+		return "", ofs.NewError("create upload", path, ofs.ErrExists, nil)
+	}
+
+	if err := CheckDir(filepath.Dir(fullpath)); err != nil {
+		return "", wrapError("create upload", path, err)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", ofs.NewError("create upload", path, nil, err)
+	}
+	uploadID := hex.EncodeToString(id)
+
+	staging, err := fileSystem.stagingPath("create upload", path, uploadID)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.OpenFile(staging, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", wrapError("create upload", path, err)
+	}
+	file.Close()
+
+	data, err := json.Marshal(uploadMetadata{
+		metadata: metadata{
+			ContentType:        options.ContentType,
+			ContentDisposition: options.ContentDisposition,
+			ContentEncoding:    options.ContentEncoding,
+			CacheControl:       options.CacheControl,
+			ACL:                options.ACL,
+			Metadata:           options.NormalizedMetadata(),
+		},
+		CreateOnly: options.CreateOnly,
+	})
+	if err == nil {
+		err = ioutil.WriteFile(staging+MetadataSuffix, data, 0644)
+	}
+	if err != nil {
+		os.Remove(staging)
+		return "", wrapError("create upload", path, err)
+	}
+	return uploadID, nil
+}
+
+// UploadOffset return the size of the staging file
+func (fileSystem FileSystem) UploadOffset(ctx context.Context, path, uploadID string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	staging, err := fileSystem.stagingPath("upload offset", path, uploadID)
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := os.Stat(staging)
+	if err != nil {
+		return 0, wrapError("upload offset", path, err)
+	}
+	return info.Size(), nil
+}
+
+// WriteUpload append reader to the staging file, written data is synced to disk before returning
+func (fileSystem FileSystem) WriteUpload(ctx context.Context, path, uploadID string, offset int64, reader io.Reader) (int64, error) {
+	staging, err := fileSystem.stagingPath("write upload", path, uploadID)
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := os.OpenFile(staging, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return 0, wrapError("write upload", path, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, wrapError("write upload", path, err)
+	}
+	if info.Size() != offset {
+		return 0, ofs.NewError("write upload", path, ofs.ErrOffsetMismatch, nil)
+	}
+
+	n, err := io.Copy(file, ofs.ContextReader(ctx, reader))
+	if syncErr := file.Sync(); err == nil {
+		err = syncErr
+	}
+	if err != nil {
+		return n, wrapError("write upload", path, err)
+	}
+	return n, nil
+}
+
+// CompleteUpload move the staging file to path, with options given to CreateUpload
+func (fileSystem FileSystem) CompleteUpload(ctx context.Context, path, uploadID string) (*ofs.Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	staging, err := fileSystem.stagingPath("complete upload", path, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	fullpath, err := fileSystem.GetFullPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var meta uploadMetadata
+	data, err := ioutil.ReadFile(staging + MetadataSuffix)
+	if err == nil {
+		err = json.Unmarshal(data, &meta)
+	}
+	if err != nil {
+		return nil, wrapError("complete upload", path, err)
+	}
+
+	file, err := os.Open(staging)
+	if err != nil {
+		return nil, wrapError("complete upload", path, err)
+	}
+
+	staged, err := stageMetadata(fullpath, meta.options())
+	if err != nil {
+		file.Close()
+		return nil, wrapError("complete upload", path, err)
+	}
+
+	if err = commitFile(file, fullpath, meta.CreateOnly); err != nil {
+		staged.discard()
+		return nil, wrapError("complete upload", path, err)
+	}
+
+	staged.commit()
+	os.Remove(staging + MetadataSuffix)
+	return fileSystem.StatWithContext(ctx, path)
+}
+
+// AbortUpload remove the staging file
+func (fileSystem FileSystem) AbortUpload(ctx context.Context, path, uploadID string) error {
+	staging, err := fileSystem.stagingPath("abort upload", path, uploadID)
+	if err != nil {
+		return err
+	}
+
+	os.Remove(staging + MetadataSuffix)
+	return wrapError("abort upload", path, os.Remove(staging))
+}
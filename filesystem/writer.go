@@ -0,0 +1,166 @@
+package fs
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/MayCMF/ofs"
+)
+
+// tempPrefix prefix of temporary files written next to their destination, they are hidden from listings
+const tempPrefix = ".ofs-tmp-"
+
+// isInternalFile report whether path is a sidecar or temporary file managed by FileSystem
+func isInternalFile(path string) bool {
+	return isMetadataFile(path) || strings.HasPrefix(filepath.Base(path), tempPrefix)
+}
+
+// OpenWriter open a writer to store an object into given path, data is written into a temporary file in the same directory,
+// which is synced and renamed to path on Close, so readers never see partial objects, even after a crash.
+// The sidecar file keeping options is written before and moved into place right after the object,
+// so Close doesn't fail once the object has been committed.
+// With options.CreateOnly Close fails with ofs.ErrExists if path already exists
+func (fileSystem FileSystem) OpenWriter(path string, options *ofs.PutOptions) (ofs.Writer, error) {
+	if isInternalFile(path) {
+		return nil, ofs.NewError("open writer", path, ofs.ErrInvalidPath, errReservedName)
+	}
+
+	fullpath, err := fileSystem.GetFullPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CheckDir(filepath.Dir(fullpath)); err != nil {
+		return nil, wrapError("open writer", path, err)
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(fullpath), tempPrefix+"*")
+	if err != nil {
+		return nil, wrapError("open writer", path, err)
+	}
+
+	return &fileWriter{File: file, path: path, fullpath: fullpath, options: options}, nil
+}
+
+// fileWriter writes into a temporary file, and moves it to the destination on Close
+type fileWriter struct {
+	*os.File
+	path     string
+	fullpath string
+	options  *ofs.PutOptions
+	done     bool
+}
+
+// Close commit the written file
+func (w *fileWriter) Close() error {
+	if w.done {
+		return wrapError("close writer", w.path, os.ErrClosed)
+	}
+	w.done = true
+
+	staged, err := stageMetadata(w.fullpath, w.options)
+	if err == nil {
+		if err = w.File.Chmod(0644); err == nil {
+			err = commitFile(w.File, w.fullpath, w.options != nil && w.options.CreateOnly)
+		}
+		if err != nil {
+			staged.discard()
+		}
+	}
+	if err != nil {
+		w.File.Close()
+		os.Remove(w.File.Name())
+		return wrapError("close writer", w.path, err)
+	}
+
+	staged.commit()
+	return nil
+}
+
+// Abort discard the written data
+func (w *fileWriter) Abort() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+
+	w.File.Close()
+	return wrapError("abort writer", w.path, os.Remove(w.File.Name()))
+}
+
+// commitFile sync and close the temporary file, move it to fullpath and sync the parent directory, so the new content survives crashes.
+// If createOnly, fullpath is hard linked instead of renamed, which fails atomically if fullpath exists,
+// file systems without hard links fall back to createFile
+func commitFile(file *os.File, fullpath string, createOnly bool) error {
+	err := file.Sync()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if createOnly {
+		if err = os.Link(file.Name(), fullpath); isLinkUnsupported(err) {
+			err = createFile(file.Name(), fullpath)
+		}
+		if err != nil {
+			return err
+		}
+		os.Remove(file.Name())
+	} else if err = os.Rename(file.Name(), fullpath); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(fullpath))
+}
+
+// isLinkUnsupported report whether os.Link failed because the file system doesn't support hard links
+func isLinkUnsupported(err error) bool {
+	return errors.Is(err, syscall.EPERM) || errors.Is(err, errors.ErrUnsupported)
+}
+
+// createFile copy temporary file tempPath into a new file fullpath, which fails if fullpath exists,
+// unlike renames readers could see the partial file while it is copied
+func createFile(tempPath, fullpath string) error {
+	src, err := os.Open(tempPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(fullpath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, src)
+	if err == nil {
+		err = dst.Sync()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(fullpath)
+	}
+	return err
+}
+
+// syncDir sync directory entries of dir, platforms that can't sync directories are ignored
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err = file.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) && !errors.Is(err, os.ErrPermission) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Written file should only appear after Close
+func Test_OpenWriter(t *testing.T) {
+	storage := New(t.TempDir())
+
+	writer, err := storage.OpenWriter("/writer/test.txt", nil)
+	if err != nil {
+		t.Errorf("Open writer fail %v", err)
+		return
+	}
+
+	if _, err = writer.Write([]byte("Hello MayCMF")); err != nil {
+		t.Errorf("Write fail %v", err)
+	}
+
+	if PathExists(fullPath(storage, "/writer/test.txt")) {
+		t.Errorf("File shouldn't exist before Close")
+	}
+
+	if objects, _ := storage.List("/writer"); len(objects) != 0 {
+		t.Errorf("Temporary file should be hidden from List, but got %v objects", len(objects))
+	}
+
+	if err = writer.Close(); err != nil {
+		t.Errorf("Close fail %v", err)
+	}
+
+	if data, err := ioutil.ReadFile(fullPath(storage, "/writer/test.txt")); err != nil || string(data) != "Hello MayCMF" {
+		t.Errorf("File should be written after Close, but got %q, %v", data, err)
+	}
+}
+
+// Aborted writes should leave nothing behind
+func Test_OpenWriterAbort(t *testing.T) {
+	storage := New(t.TempDir())
+
+	writer, err := storage.OpenWriter("/aborted.txt", nil)
+	if err != nil {
+		t.Errorf("Open writer fail %v", err)
+		return
+	}
+
+	writer.Write([]byte("Hello"))
+	if err = writer.Abort(); err != nil {
+		t.Errorf("Abort fail %v", err)
+	}
+
+	if files, _ := ReadDir(storage.Base); len(files) != 0 {
+		t.Errorf("Aborted write should leave nothing behind, but got %v", files)
+	}
+}
+
+// Files created without hard links should fail if they exist
+func Test_CreateFile(t *testing.T) {
+	storage := New(t.TempDir())
+	tempPath := filepath.Join(storage.Base, tempPrefix+"create")
+	if err := ioutil.WriteFile(tempPath, []byte("Hello MayCMF"), 0644); err != nil {
+		t.Fatalf("Write fail %v", err)
+	}
+
+	if err := createFile(tempPath, fullPath(storage, "/created.txt")); err != nil {
+		t.Errorf("createFile fail %v", err)
+	}
+	if data, _ := ioutil.ReadFile(fullPath(storage, "/created.txt")); string(data) != "Hello MayCMF" {
+		t.Errorf("created file should be a copy, but got %q", data)
+	}
+
+	if err := createFile(tempPath, fullPath(storage, "/created.txt")); !os.IsExist(err) {
+		t.Errorf("createFile should fail if the file exists, but got %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+package ofs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// FSStorage read-only storage of an io/fs.FS, e.g. an embed.FS, writes return ErrPermission wrapping ErrReadOnly
+type FSStorage struct {
+	FS iofs.FS
+	// Endpoint base of URLs returned by GetURL
+	Endpoint string
+}
+
+// FromFS return fsys as a read-only storage
+func FromFS(fsys iofs.FS) *FSStorage {
+	return &FSStorage{FS: fsys}
+}
+
+// name convert storage path into fs.FS name, e.g. `/a/b.txt` into `a/b.txt`
+func (storage *FSStorage) name(op, p string) (string, error) {
+	name := strings.Trim(path.Clean("/"+p), "/")
+	if name == "" {
+		name = "."
+	}
+	if !iofs.ValidPath(name) {
+		return "", NewError(op, p, ErrInvalidPath, nil)
+	}
+	return name, nil
+}
+
+// fsError classify fs errors as storage errors
+func fsError(op, p string, err error) error {
+	var kind error
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, iofs.ErrNotExist):
+		kind = ErrNotFound
+	case errors.Is(err, iofs.ErrPermission):
+		kind = ErrPermission
+	case errors.Is(err, iofs.ErrInvalid):
+		kind = ErrInvalidPath
+	}
+	return NewError(op, p, kind, err)
+}
+
+// open open the regular file of path
+func (storage *FSStorage) open(op, p string) (iofs.File, iofs.FileInfo, error) {
+	name, err := storage.name(op, p)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := storage.FS.Open(name)
+	if err != nil {
+		return nil, nil, fsError(op, p, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, fsError(op, p, err)
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, nil, NewError(op, p, ErrNotFound, errors.New("is a directory"))
+	}
+	return file, info, nil
+}
+
+// Get receive object with given path as a temporary file, it is removed once closed, see TempFile
+func (storage *FSStorage) Get(p string) (*os.File, error) {
+	stream, err := storage.GetStream(p)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	return TempFile(stream, "ofs-fs-*"+path.Ext(p))
+}
+
+// GetStream get object as stream
+func (storage *FSStorage) GetStream(p string) (io.ReadCloser, error) {
+	file, _, err := storage.open("get", p)
+	return file, err
+}
+
+// Put return ErrPermission, FSStorage is read-only
+func (storage *FSStorage) Put(p string, reader io.Reader) (*Object, error) {
+	return nil, NewError("put", p, ErrPermission, ErrReadOnly)
+}
+
+// Delete return ErrPermission, FSStorage is read-only
+func (storage *FSStorage) Delete(p string) error {
+	return NewError("delete", p, ErrPermission, ErrReadOnly)
+}
+
+// List list all objects under path
+func (storage *FSStorage) List(p string) ([]*Object, error) {
+	name, err := storage.name("list", p)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []*Object
+	err = iofs.WalkDir(storage.FS, name, func(name string, entry iofs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, storage.toObject(objectPath(name), info))
+		return nil
+	})
+
+	if errors.Is(err, iofs.ErrNotExist) {
+		return nil, nil
+	}
+	return objects, fsError("list", p, err)
+}
+
+// ListPage list one page of entries under path
+func (storage *FSStorage) ListPage(ctx context.Context, p string, options ListOptions) (*ListResult, error) {
+	objects, err := storage.List(p)
+	if err != nil {
+		return nil, err
+	}
+	return Paginate(objects, p, options), nil
+}
+
+// Stat get object's metadata, the content type is detected from the extension or sniffed from the content
+func (storage *FSStorage) Stat(p string) (*Object, error) {
+	file, info, err := storage.open("stat", p)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	object := storage.toObject(path.Clean("/"+p), info)
+	if object.ContentType == "" {
+		buffer := make([]byte, 512)
+		n, _ := io.ReadFull(file, buffer)
+		object.ContentType = http.DetectContentType(buffer[:n])
+	}
+	return object, nil
+}
+
+func (storage *FSStorage) toObject(p string, info iofs.FileInfo) *Object {
+	object := &Object{
+		Path:             p,
+		Name:             info.Name(),
+		Size:             info.Size(),
+		ContentType:      mime.TypeByExtension(path.Ext(p)),
+		StorageInterface: storage,
+	}
+
+	// files of embed.FS have no modification time
+	if modTime := info.ModTime(); !modTime.IsZero() {
+		object.LastModified = &modTime
+		object.ETag = fmt.Sprintf("%x-%x", modTime.UnixNano(), info.Size())
+	}
+	return object
+}
+
+// GetURL get URL of the object, prefixed with Endpoint
+func (storage *FSStorage) GetURL(p string) (string, error) {
+	return strings.TrimSuffix(storage.Endpoint, "/") + (&url.URL{Path: path.Clean("/" + p)}).EscapedPath(), nil
+}
+
+// GetEndpoint get endpoint, / if Endpoint isn't set
+func (storage *FSStorage) GetEndpoint() string {
+	if storage.Endpoint != "" {
+		return storage.Endpoint
+	}
+	return "/"
+}
+
+// GetRange get length bytes of the object starting at offset, or till the end if length is negative
+func (storage *FSStorage) GetRange(p string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 {
+		return nil, NewError("get range", p, ErrInvalidPath, fmt.Errorf("negative offset %d", offset))
+	}
+	file, _, err := storage.open("get range", p)
+	if err != nil {
+		return nil, err
+	}
+
+	if seeker, ok := file.(io.Seeker); ok {
+		_, err = seeker.Seek(offset, io.SeekStart)
+	} else {
+		_, err = io.CopyN(ioutil.Discard, file, offset)
+	}
+	if err != nil && err != io.EOF {
+		file.Close()
+		return nil, fsError("get range", p, err)
+	}
+	return LimitReadCloser(file, length), nil
+}
+
+// OpenReaderAt open a random access reader of the object, files that can't seek are read into a temporary file
+func (storage *FSStorage) OpenReaderAt(p string) (ObjectReader, error) {
+	file, info, err := storage.open("open reader", p)
+	if err != nil {
+		return nil, err
+	}
+
+	if reader, ok := file.(interface {
+		io.ReaderAt
+		io.Seeker
+	}); ok {
+		return &fsFileReader{File: file, ReaderAt: reader, Seeker: reader, size: info.Size()}, nil
+	}
+	file.Close()
+
+	tempFile, err := storage.Get(p)
+	if err != nil {
+		return nil, err
+	}
+	return NewFileReader(tempFile)
+}
+
+type fsFileReader struct {
+	iofs.File
+	io.ReaderAt
+	io.Seeker
+	size int64
+}
+
+func (reader *fsFileReader) Size() int64 {
+	return reader.size
+}
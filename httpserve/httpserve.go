@@ -0,0 +1,263 @@
+// Package httpserve serves objects of any ofs storage over HTTP
+package httpserve
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MayCMF/ofs"
+)
+
+// Handler http.Handler that serves objects of Storage by request path, mount it with http.StripPrefix to serve a sub path,
+// storages implementing ofs.RangeReader serve Range requests, others are always read in full
+type Handler struct {
+	Storage ofs.StorageInterface
+	// ListDirectories list entries of directories as HTML, paths ending with / are directories, otherwise they aren't found
+	ListDirectories bool
+	// ShowHidden list entries whose names start with a dot, e.g. staged uploads of tus.DefaultUploadDir, they are left out otherwise
+	ShowHidden bool
+	// CacheControl Cache-Control header of objects that don't have their own
+	CacheControl string
+}
+
+// New initialize a Handler of storage
+func New(storage ofs.StorageInterface) *Handler {
+	return &Handler{Storage: storage}
+}
+
+// ServeHTTP serve the object or directory of req's path
+func (handler *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	urlPath := req.URL.Path
+	if !strings.HasPrefix(urlPath, "/") {
+		urlPath = "/" + urlPath
+	}
+
+	if strings.HasSuffix(urlPath, "/") {
+		handler.serveDirectory(w, req, urlPath)
+		return
+	}
+
+	object, err := ofs.WithContext(handler.Storage).StatWithContext(req.Context(), urlPath)
+	if err != nil {
+		// redirect directories requested without trailing slash, the relative location keeps working under http.StripPrefix
+		if errors.Is(err, ofs.ErrNotFound) && handler.ListDirectories && handler.hasEntries(req.Context(), urlPath) {
+			w.Header().Set("Location", (&url.URL{Path: path.Base(urlPath) + "/"}).EscapedPath())
+			w.WriteHeader(http.StatusMovedPermanently)
+			return
+		}
+		serveError(w, err)
+		return
+	}
+
+	handler.serveObject(w, req, urlPath, object)
+}
+
+// serveObject write object's headers and content, handling conditional and Range requests
+func (handler *Handler) serveObject(w http.ResponseWriter, req *http.Request, urlPath string, object *ofs.Object) {
+	var (
+		header  = w.Header()
+		modTime time.Time
+	)
+
+	if object.LastModified != nil {
+		modTime = *object.LastModified
+		header.Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+	if object.ETag != "" {
+		header.Set("ETag", quoteETag(object.ETag))
+	}
+	if object.ContentType != "" {
+		header.Set("Content-Type", object.ContentType)
+	} else {
+		header.Set("Content-Type", "application/octet-stream")
+	}
+	if object.ContentDisposition != "" {
+		header.Set("Content-Disposition", object.ContentDisposition)
+	}
+	if object.ContentEncoding != "" {
+		header.Set("Content-Encoding", object.ContentEncoding)
+	}
+	if object.CacheControl != "" {
+		header.Set("Cache-Control", object.CacheControl)
+	} else if handler.CacheControl != "" {
+		header.Set("Cache-Control", handler.CacheControl)
+	}
+
+	if notModified(req, header.Get("ETag"), modTime) {
+		for _, key := range []string{"Content-Type", "Content-Disposition", "Content-Encoding"} {
+			header.Del(key)
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if _, ok := handler.Storage.(ofs.RangeReader); ok {
+		reader, err := ofs.OpenReaderAt(handler.Storage, urlPath)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		defer reader.Close()
+
+		// ServeContent handles Range and If-Range, conditional headers have been checked already
+		http.ServeContent(w, req, "", modTime, reader)
+		return
+	}
+
+	// storages without ranged reads always serve the whole object
+	header.Set("Accept-Ranges", "none")
+	if object.Size >= 0 {
+		header.Set("Content-Length", strconv.FormatInt(object.Size, 10))
+	}
+
+	if req.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	stream, err := ofs.WithContext(handler.Storage).GetStreamWithContext(req.Context(), urlPath)
+	if err != nil {
+		header.Del("Content-Length")
+		serveError(w, err)
+		return
+	}
+	defer stream.Close()
+
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, stream)
+}
+
+// notModified evaluate If-None-Match, or If-Modified-Since if there is no If-None-Match
+func notModified(req *http.Request, etag string, modTime time.Time) bool {
+	if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ifModifiedSince := req.Header.Get("If-Modified-Since"); ifModifiedSince != "" && !modTime.IsZero() {
+		if since, err := http.ParseTime(ifModifiedSince); err == nil {
+			return !modTime.Truncate(time.Second).After(since)
+		}
+	}
+	return false
+}
+
+// quoteETag quote etag as required by HTTP, unless it is quoted already
+func quoteETag(etag string) string {
+	if strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
+
+// hasEntries report whether there are entries under directory dir
+func (handler *Handler) hasEntries(ctx context.Context, dir string) bool {
+	found := false
+	ofs.Walk(ctx, handler.Storage, dir, ofs.ListOptions{MaxKeys: 1}, func(*ofs.Object) error {
+		found = true
+		return ofs.SkipAll
+	})
+	return found
+}
+
+var directoryTemplate = template.Must(template.New("directory").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Index of {{.Path}}</title></head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<ul>
+{{- if ne .Path "/"}}
+<li><a href="../">../</a></li>
+{{- end}}
+{{- range .Entries}}
+<li><a href="{{.URL}}">{{.Name}}</a></li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+
+type directoryEntry struct {
+	Name string
+	URL  string
+}
+
+// serveDirectory list entries of directory dir as HTML
+func (handler *Handler) serveDirectory(w http.ResponseWriter, req *http.Request, dir string) {
+	if !handler.ListDirectories {
+		http.NotFound(w, req)
+		return
+	}
+
+	var (
+		prefix  = ofs.DirPrefix(dir)
+		entries []directoryEntry
+	)
+
+	err := ofs.Walk(req.Context(), handler.Storage, dir, ofs.ListOptions{}, func(object *ofs.Object) error {
+		name := strings.TrimSuffix(strings.TrimPrefix("/"+strings.TrimPrefix(object.Path, "/"), prefix), "/")
+		if name == "" || (strings.HasPrefix(name, ".") && !handler.ShowHidden) {
+			return nil
+		}
+
+		entry := directoryEntry{Name: name, URL: (&url.URL{Path: name}).EscapedPath()}
+		if object.IsDir {
+			entry.Name += "/"
+			entry.URL += "/"
+		}
+		// keep names like `a:b` from being parsed as URL schemes
+		if strings.Contains(name, ":") {
+			entry.URL = "./" + entry.URL
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	if len(entries) == 0 && prefix != "/" {
+		http.NotFound(w, req)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if req.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	directoryTemplate.Execute(w, struct {
+		Path    string
+		Entries []directoryEntry
+	}{Path: prefix, Entries: entries})
+}
+
+// serveError reply with the status code of err
+func serveError(w http.ResponseWriter, err error) {
+	status := ofs.HTTPStatus(err)
+	http.Error(w, http.StatusText(status), status)
+}
@@ -0,0 +1,149 @@
+package httpserve_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MayCMF/ofs"
+	"github.com/MayCMF/ofs/httpserve"
+	"github.com/MayCMF/ofs/memory"
+)
+
+// plainStorage hides optional capabilities of the wrapped storage, e.g. ofs.RangeReader
+type plainStorage struct {
+	ofs.StorageInterface
+}
+
+func newStorage(t *testing.T) *memory.Storage {
+	storage := memory.New()
+	if _, err := ofs.PutWithOptions(context.Background(), storage, "/docs/readme.txt", strings.NewReader("0123456789"), &ofs.PutOptions{ContentType: "text/x-readme", CacheControl: "max-age=60"}); err != nil {
+		t.Fatalf("Put fail %v", err)
+	}
+	if _, err := storage.Put("/docs/nested/a b.txt", strings.NewReader("nested")); err != nil {
+		t.Fatalf("Put fail %v", err)
+	}
+	return storage
+}
+
+func request(handler http.Handler, method, path string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestServeObject(t *testing.T) {
+	storage := newStorage(t)
+
+	for name, handler := range map[string]http.Handler{
+		"range reader": httpserve.New(storage),
+		"plain":        httpserve.New(plainStorage{storage}),
+	} {
+		resp := request(handler, http.MethodGet, "/docs/readme.txt", nil)
+		if resp.Code != http.StatusOK || resp.Body.String() != "0123456789" {
+			t.Errorf("%v: GET should serve the object, but got %v %q", name, resp.Code, resp.Body.String())
+		}
+
+		if resp.Header().Get("Content-Type") != "text/x-readme" || resp.Header().Get("Cache-Control") != "max-age=60" {
+			t.Errorf("%v: headers should come from stored metadata, but got %v", name, resp.Header())
+		}
+
+		etag, lastModified := resp.Header().Get("ETag"), resp.Header().Get("Last-Modified")
+		if !strings.HasPrefix(etag, `"`) || lastModified == "" {
+			t.Errorf("%v: ETag and Last-Modified should be set, but got %q, %q", name, etag, lastModified)
+		}
+
+		if resp := request(handler, http.MethodHead, "/docs/readme.txt", nil); resp.Code != http.StatusOK || resp.Body.Len() != 0 || resp.Header().Get("Content-Length") != "10" {
+			t.Errorf("%v: HEAD should only send headers, but got %v %q %v", name, resp.Code, resp.Body.String(), resp.Header())
+		}
+
+		if resp := request(handler, http.MethodGet, "/docs/readme.txt", map[string]string{"If-None-Match": etag}); resp.Code != http.StatusNotModified {
+			t.Errorf("%v: matching If-None-Match should be not modified, but got %v", name, resp.Code)
+		}
+
+		if resp := request(handler, http.MethodGet, "/docs/readme.txt", map[string]string{"If-None-Match": `"other"`}); resp.Code != http.StatusOK {
+			t.Errorf("%v: other If-None-Match should be served, but got %v", name, resp.Code)
+		}
+
+		if resp := request(handler, http.MethodGet, "/docs/readme.txt", map[string]string{"If-Modified-Since": lastModified}); resp.Code != http.StatusNotModified {
+			t.Errorf("%v: If-Modified-Since of Last-Modified should be not modified, but got %v", name, resp.Code)
+		}
+
+		past := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+		if resp := request(handler, http.MethodGet, "/docs/readme.txt", map[string]string{"If-Modified-Since": past}); resp.Code != http.StatusOK {
+			t.Errorf("%v: object modified since should be served, but got %v", name, resp.Code)
+		}
+
+		if resp := request(handler, http.MethodGet, "/docs/missing.txt", nil); resp.Code != http.StatusNotFound {
+			t.Errorf("%v: missing object should be not found, but got %v", name, resp.Code)
+		}
+
+		if resp := request(handler, http.MethodPost, "/docs/readme.txt", nil); resp.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%v: POST should not be allowed, but got %v", name, resp.Code)
+		}
+	}
+}
+
+func TestServeRange(t *testing.T) {
+	storage := newStorage(t)
+
+	resp := request(httpserve.New(storage), http.MethodGet, "/docs/readme.txt", map[string]string{"Range": "bytes=2-5"})
+	if resp.Code != http.StatusPartialContent || resp.Body.String() != "2345" || resp.Header().Get("Content-Range") != "bytes 2-5/10" {
+		t.Errorf("Range should be served partially, but got %v %q %v", resp.Code, resp.Body.String(), resp.Header())
+	}
+
+	resp = request(httpserve.New(plainStorage{storage}), http.MethodGet, "/docs/readme.txt", map[string]string{"Range": "bytes=2-5"})
+	if resp.Code != http.StatusOK || resp.Body.String() != "0123456789" || resp.Header().Get("Accept-Ranges") != "none" {
+		t.Errorf("storage without ranged reads should serve the whole object, but got %v %q", resp.Code, resp.Body.String())
+	}
+}
+
+func TestServeDirectory(t *testing.T) {
+	storage := newStorage(t)
+	if _, err := storage.Put("/docs/.uploads/state.json", strings.NewReader("{}")); err != nil {
+		t.Fatalf("Put fail %v", err)
+	}
+
+	if resp := request(httpserve.New(storage), http.MethodGet, "/docs/", nil); resp.Code != http.StatusNotFound {
+		t.Errorf("directories shouldn't be listed by default, but got %v", resp.Code)
+	}
+
+	handler := httpserve.New(storage)
+	handler.ListDirectories = true
+
+	resp := request(handler, http.MethodGet, "/docs/", nil)
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.Code != http.StatusOK || !strings.Contains(string(body), `<a href="readme.txt">readme.txt</a>`) || !strings.Contains(string(body), `<a href="nested/">nested/</a>`) {
+		t.Errorf("directory should list its entries, but got %v %s", resp.Code, body)
+	}
+
+	if strings.Contains(string(body), ".uploads") {
+		t.Errorf("hidden entries shouldn't be listed, but got %s", body)
+	}
+
+	handler.ShowHidden = true
+	if body := request(handler, http.MethodGet, "/docs/", nil).Body.String(); !strings.Contains(body, `<a href=".uploads/">.uploads/</a>`) {
+		t.Errorf("hidden entries should be listed with ShowHidden, but got %s", body)
+	}
+
+	resp = request(handler, http.MethodGet, "/docs/nested/", nil)
+	if body := resp.Body.String(); !strings.Contains(body, `<a href="a%20b.txt">a b.txt</a>`) {
+		t.Errorf("entry URLs should be escaped, but got %s", body)
+	}
+
+	if resp := request(handler, http.MethodGet, "/docs", nil); resp.Code != http.StatusMovedPermanently || resp.Header().Get("Location") != "docs/" {
+		t.Errorf("directory without trailing slash should be redirected, but got %v %v", resp.Code, resp.Header())
+	}
+
+	if resp := request(handler, http.MethodGet, "/missing/", nil); resp.Code != http.StatusNotFound {
+		t.Errorf("missing directory should be not found, but got %v", resp.Code)
+	}
+}
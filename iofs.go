@@ -0,0 +1,224 @@
+package ofs
+
+import (
+	"context"
+	"errors"
+	"io"
+	iofs "io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FS exposes a storage as io/fs.FS, e.g. for http.FS, template.ParseFS or fs.WalkDir, it also implements fs.ReadDirFS and fs.StatFS,
+// directories are synthesized from path prefixes of objects, so storages without real directories like S3 could be walked too
+type FS struct {
+	storage StorageInterface
+	ctx     context.Context
+}
+
+// NewFS return storage as io/fs.FS
+func NewFS(storage StorageInterface) *FS {
+	return &FS{storage: storage, ctx: context.Background()}
+}
+
+// WithContext return a copy of fsys whose storage operations are bound to ctx
+func (fsys *FS) WithContext(ctx context.Context) *FS {
+	return &FS{storage: fsys.storage, ctx: ctx}
+}
+
+// objectPath convert fs.FS name into storage path, e.g. `a/b.txt` into `/a/b.txt`
+func objectPath(name string) string {
+	if name == "." {
+		return "/"
+	}
+	return "/" + name
+}
+
+// pathError convert storage error into *fs.PathError, classified with fs errors
+func pathError(op, name string, err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		err = iofs.ErrNotExist
+	case errors.Is(err, ErrPermission):
+		err = iofs.ErrPermission
+	case errors.Is(err, ErrInvalidPath):
+		err = iofs.ErrInvalid
+	case errors.Is(err, ErrExists):
+		err = iofs.ErrExist
+	}
+	return &iofs.PathError{Op: op, Path: name, Err: err}
+}
+
+// Open open file or directory name
+func (fsys *FS) Open(name string) (iofs.File, error) {
+	info, err := fsys.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		entries, err := fsys.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &dirFile{info: info, entries: entries}, nil
+	}
+
+	reader, err := OpenReaderAt(fsys.storage, objectPath(name))
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	return &file{ObjectReader: reader, info: info}, nil
+}
+
+// Stat get file info of name
+func (fsys *FS) Stat(name string) (iofs.FileInfo, error) {
+	return fsys.stat("stat", name)
+}
+
+func (fsys *FS) stat(op, name string) (iofs.FileInfo, error) {
+	if !iofs.ValidPath(name) {
+		return nil, &iofs.PathError{Op: op, Path: name, Err: iofs.ErrInvalid}
+	}
+
+	if name == "." {
+		return &fileInfo{name: ".", dir: true}, nil
+	}
+
+	object, err := WithContext(fsys.storage).StatWithContext(fsys.ctx, objectPath(name))
+	if err == nil {
+		return newFileInfo(object), nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, pathError(op, name, err)
+	}
+
+	// objects under name make it a directory
+	result, err := ListPage(fsys.ctx, fsys.storage, objectPath(name), ListOptions{MaxKeys: 1})
+	if err != nil {
+		return nil, pathError(op, name, err)
+	}
+	if len(result.Objects) == 0 {
+		return nil, &iofs.PathError{Op: op, Path: name, Err: iofs.ErrNotExist}
+	}
+	return &fileInfo{name: path.Base(name), dir: true}, nil
+}
+
+// ReadDir list entries of directory name sorted by name
+func (fsys *FS) ReadDir(name string) ([]iofs.DirEntry, error) {
+	info, err := fsys.stat("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &iofs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	var entries []iofs.DirEntry
+	err = Walk(fsys.ctx, fsys.storage, objectPath(name), ListOptions{}, func(object *Object) error {
+		if info := newFileInfo(object); info.name != "" {
+			entries = append(entries, iofs.FileInfoToDirEntry(info))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// fileInfo fs.FileInfo of an object or a synthesized directory
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+	object  *Object
+}
+
+func newFileInfo(object *Object) *fileInfo {
+	info := &fileInfo{
+		name:   path.Base("/" + strings.Trim(object.Path, "/")),
+		size:   object.Size,
+		dir:    object.IsDir,
+		object: object,
+	}
+	if info.name == "/" {
+		info.name = ""
+	}
+	if object.LastModified != nil {
+		info.modTime = *object.LastModified
+	}
+	return info
+}
+
+func (info *fileInfo) Name() string       { return info.name }
+func (info *fileInfo) Size() int64        { return info.size }
+func (info *fileInfo) ModTime() time.Time { return info.modTime }
+func (info *fileInfo) IsDir() bool        { return info.dir }
+
+func (info *fileInfo) Mode() iofs.FileMode {
+	if info.dir {
+		return iofs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// Sys return the *Object of files, nil for synthesized directories
+func (info *fileInfo) Sys() interface{} {
+	if info.object == nil {
+		return nil
+	}
+	return info.object
+}
+
+// file opened object, it is seekable, so it could be served with http.FS
+type file struct {
+	ObjectReader
+	info iofs.FileInfo
+}
+
+func (f *file) Stat() (iofs.FileInfo, error) {
+	return f.info, nil
+}
+
+// dirFile opened directory
+type dirFile struct {
+	info    iofs.FileInfo
+	entries []iofs.DirEntry
+	offset  int
+}
+
+func (d *dirFile) Stat() (iofs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &iofs.PathError{Op: "read", Path: d.info.Name(), Err: errors.New("is a directory")}
+}
+
+func (d *dirFile) Close() error {
+	return nil
+}
+
+// ReadDir return the next n entries, or all remaining entries if n <= 0
+func (d *dirFile) ReadDir(n int) ([]iofs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	d.offset += n
+	return remaining[:n], nil
+}
@@ -0,0 +1,132 @@
+package ofs_test
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	iofs "io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/MayCMF/ofs"
+	"github.com/MayCMF/ofs/memory"
+)
+
+func TestFS(t *testing.T) {
+	storage := memory.New()
+	for path, content := range map[string]string{
+		"/index.html":            "<p>{{.}}</p>",
+		"/docs/readme.txt":       "readme",
+		"/docs/nested/a b.txt":   "nested",
+		"/docs/nested/deep/c.md": "deep",
+	} {
+		if _, err := storage.Put(path, strings.NewReader(content)); err != nil {
+			t.Fatalf("Put fail %v", err)
+		}
+	}
+
+	fsys := ofs.NewFS(storage)
+	if err := fstest.TestFS(fsys, "index.html", "docs/readme.txt", "docs/nested/a b.txt", "docs/nested/deep/c.md"); err != nil {
+		t.Errorf("storage should be a valid fs.FS, but got %v", err)
+	}
+
+	if info, err := fsys.Stat("docs/nested"); err != nil || !info.IsDir() {
+		t.Errorf("directories should be synthesized from path prefixes, but got %v, %v", info, err)
+	}
+
+	if _, err := fsys.Open("docs/missing.txt"); !errors.Is(err, iofs.ErrNotExist) {
+		t.Errorf("missing file should return fs.ErrNotExist, but got %v", err)
+	}
+
+	if _, err := fsys.Open("/docs/readme.txt"); !errors.Is(err, iofs.ErrInvalid) {
+		t.Errorf("invalid name should return fs.ErrInvalid, but got %v", err)
+	}
+
+	tmpl, err := template.ParseFS(fsys, "*.html")
+	if err != nil || tmpl.Lookup("index.html") == nil {
+		t.Errorf("templates should be parsed from storage, but got %v", err)
+	}
+
+	server := httptest.NewServer(http.FileServer(http.FS(fsys)))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/docs/readme.txt", nil)
+	req.Header.Set("Range", "bytes=1-3")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Get fail %v", err)
+	}
+	defer resp.Body.Close()
+
+	if data, _ := ioutil.ReadAll(resp.Body); resp.StatusCode != http.StatusPartialContent || string(data) != "ead" {
+		t.Errorf("http.FS should serve ranges of storage objects, but got %v %q", resp.StatusCode, data)
+	}
+}
+
+func TestFromFS(t *testing.T) {
+	modTime := time.Now()
+	mapFS := fstest.MapFS{
+		"index.html":       {Data: []byte("<p>index</p>"), ModTime: modTime},
+		"docs/readme":      {Data: []byte("readme content"), ModTime: modTime},
+		"docs/nested/a.md": {Data: []byte("nested")},
+	}
+	storage := ofs.FromFS(mapFS)
+
+	stream, err := storage.GetStream("/docs/readme")
+	if err != nil {
+		t.Fatalf("GetStream fail %v", err)
+	}
+	if data, _ := ioutil.ReadAll(stream); string(data) != "readme content" {
+		t.Errorf("content should be read from fs.FS, but got %q", data)
+	}
+	stream.Close()
+
+	object, err := storage.Stat("/docs/readme")
+	if err != nil || object.Size != 14 || !strings.HasPrefix(object.ContentType, "text/plain") || object.ETag == "" {
+		t.Errorf("Stat should describe the file, but got %+v, %v", object, err)
+	}
+
+	if _, err := storage.Stat("/docs"); !errors.Is(err, ofs.ErrNotFound) {
+		t.Errorf("directories aren't objects, but got %v", err)
+	}
+
+	if _, err := storage.GetStream("/docs"); !errors.Is(err, ofs.ErrNotFound) || strings.Count(err.Error(), "/docs") != 1 {
+		t.Errorf("directories can't be read, but got %v", err)
+	}
+
+	file, err := storage.Get("/docs/readme")
+	if err != nil {
+		t.Fatalf("Get fail %v", err)
+	}
+	if _, err := os.Stat(file.Name()); !os.IsNotExist(err) {
+		t.Errorf("temporary file of Get should be removed once closed, but got %v", err)
+	}
+	file.Close()
+
+	if objects, err := storage.List("/docs"); err != nil || len(objects) != 2 {
+		t.Errorf("List should return files under path, but got %v, %v", objects, err)
+	}
+
+	result, err := ofs.ListPage(context.Background(), storage, "/docs", ofs.ListOptions{})
+	if err != nil || len(result.Objects) != 2 || !result.Objects[0].IsDir || result.Objects[1].Path != "/docs/readme" {
+		t.Errorf("ListPage should group nested files into directories, but got %+v, %v", result, err)
+	}
+
+	if _, err := storage.Put("/new.txt", strings.NewReader("new")); !errors.Is(err, ofs.ErrPermission) {
+		t.Errorf("Put should fail with ofs.ErrPermission, but got %v", err)
+	}
+
+	if err := storage.Delete("/index.html"); !errors.Is(err, ofs.ErrPermission) {
+		t.Errorf("Delete should fail with ofs.ErrPermission, but got %v", err)
+	}
+
+	if err := fstest.TestFS(ofs.NewFS(storage), "index.html", "docs/readme", "docs/nested/a.md"); err != nil {
+		t.Errorf("round trip through storage should be a valid fs.FS, but got %v", err)
+	}
+}
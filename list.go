@@ -0,0 +1,139 @@
+package ofs
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sort"
+	"strings"
+)
+
+// DefaultMaxKeys default page size of ListPage
+const DefaultMaxKeys = 1000
+
+// SkipAll returned from a Walk callback to stop walking, Walk itself returns nil then
+var SkipAll = errors.New("ofs: skip everything and stop the walk")
+
+// ListOptions options of paginated listing
+type ListOptions struct {
+	// Recursive list objects in nested directories too, otherwise nested objects are grouped into directory entries (common prefixes)
+	Recursive bool
+	// MaxKeys maximum number of entries of one page, DefaultMaxKeys if zero
+	MaxKeys int
+	// StartAfter only list entries whose path sorts after it
+	StartAfter string
+	// ContinuationToken continue listing from NextContinuationToken of the previous page
+	ContinuationToken string
+}
+
+// ListResult a page of listed entries sorted by path
+type ListResult struct {
+	Objects []*Object
+	// NextContinuationToken token to fetch the next page, empty for the last page
+	NextContinuationToken string
+}
+
+// PageLister implemented by storages that could list objects page by page
+type PageLister interface {
+	ListPage(ctx context.Context, path string, options ListOptions) (*ListResult, error)
+}
+
+// ListPage list one page of entries under path, storages that don't implement PageLister are listed with List,
+// and directory entries are synthesized from the listed objects' paths
+func ListPage(ctx context.Context, storage StorageInterface, path string, options ListOptions) (*ListResult, error) {
+	if lister, ok := storage.(PageLister); ok {
+		return lister.ListPage(ctx, path, options)
+	}
+
+	objects, err := WithContext(storage).ListWithContext(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return Paginate(objects, path, options), nil
+}
+
+// Walk call fn for each entry under path, fetching pages lazily, return SkipAll from fn to stop walking
+func Walk(ctx context.Context, storage StorageInterface, path string, options ListOptions, fn func(object *Object) error) error {
+	for {
+		result, err := ListPage(ctx, storage, path, options)
+		if err != nil {
+			return err
+		}
+
+		for _, object := range result.Objects {
+			if err := fn(object); err != nil {
+				if err == SkipAll {
+					return nil
+				}
+				return err
+			}
+		}
+
+		if result.NextContinuationToken == "" {
+			return nil
+		}
+		options.ContinuationToken = result.NextContinuationToken
+	}
+}
+
+// Paginate build a page from an in-memory list of objects, it is used by storages that can't list page by page natively,
+// the continuation token is the path of the last entry of the page
+func Paginate(objects []*Object, dir string, options ListOptions) *ListResult {
+	var (
+		result     = &ListResult{}
+		prefix     = DirPrefix(dir)
+		startAfter = options.StartAfter
+		maxKeys    = options.MaxKeys
+		entries    = map[string]*Object{}
+	)
+
+	if options.ContinuationToken > startAfter {
+		startAfter = options.ContinuationToken
+	}
+
+	if maxKeys <= 0 {
+		maxKeys = DefaultMaxKeys
+	}
+
+	for _, object := range objects {
+		objectPath := "/" + strings.TrimPrefix(object.Path, "/")
+		if !strings.HasPrefix(objectPath, prefix) || objectPath == prefix {
+			continue
+		}
+
+		if !options.Recursive {
+			if idx := strings.Index(objectPath[len(prefix):], "/"); idx >= 0 {
+				dirPath := objectPath[:len(prefix)+idx+1]
+				entries[dirPath] = &Object{Path: dirPath, Name: path.Base(dirPath), IsDir: true, StorageInterface: object.StorageInterface}
+				continue
+			}
+		}
+		entries[objectPath] = object
+	}
+
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		if key > startAfter {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	if len(keys) > maxKeys {
+		keys = keys[:maxKeys]
+		result.NextContinuationToken = keys[maxKeys-1]
+	}
+
+	for _, key := range keys {
+		result.Objects = append(result.Objects, entries[key])
+	}
+	return result
+}
+
+// DirPrefix return the path prefix of objects under dir, with leading and trailing slashes, e.g. "/a/b/", or "/" for the root
+func DirPrefix(dir string) string {
+	if dir = strings.Trim(dir, "/"); dir == "" {
+		return "/"
+	}
+	return "/" + dir + "/"
+}
@@ -0,0 +1,360 @@
+// Package memory implements an in-memory storage, mainly for tests
+package memory
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MayCMF/ofs"
+)
+
+// Storage in-memory storage, safe for concurrent use
+type Storage struct {
+	// Endpoint base of URLs returned by GetURL
+	Endpoint string
+	// Latency simulated delay of every operation
+	Latency time.Duration
+
+	mutex   sync.RWMutex
+	objects map[string]*entry
+}
+
+type entry struct {
+	data   []byte
+	object ofs.Object
+}
+
+// New initialize in-memory storage
+func New() *Storage {
+	return &Storage{Endpoint: "memory://", objects: map[string]*entry{}}
+}
+
+func init() {
+	ofs.Register("memory", Open)
+}
+
+// Open initialize an empty in-memory storage from a URL like `memory://?latency=10ms`, it is registered as scheme `memory` of ofs.Open, parameters:
+//
+//	endpoint  Endpoint
+//	latency   Latency
+func Open(u *url.URL) (ofs.StorageInterface, error) {
+	params := ofs.NewURLParams(u)
+	storage := New()
+	if endpoint := params.String("endpoint"); endpoint != "" {
+		storage.Endpoint = endpoint
+	}
+	storage.Latency = params.Duration("latency")
+	if err := params.Err(); err != nil {
+		return nil, err
+	}
+	return storage, nil
+}
+
+// cleanPath normalize path into the key of objects
+func cleanPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// wait simulate latency, return early once ctx is done
+func (storage *Storage) wait(ctx context.Context) error {
+	if storage.Latency > 0 {
+		timer := time.NewTimer(storage.Latency)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+	}
+	return ctx.Err()
+}
+
+// load get the entry of path
+func (storage *Storage) load(ctx context.Context, op, p string) (*entry, error) {
+	if err := storage.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	storage.mutex.RLock()
+	e, ok := storage.objects[cleanPath(p)]
+	storage.mutex.RUnlock()
+
+	if !ok {
+		return nil, ofs.NewError(op, p, ofs.ErrNotFound, nil)
+	}
+	return e, nil
+}
+
+// toObject return a copy of the entry's object
+func (storage *Storage) toObject(e *entry) *ofs.Object {
+	object := e.object
+	if object.LastModified != nil {
+		modTime := *object.LastModified
+		object.LastModified = &modTime
+	}
+	if object.Metadata != nil {
+		object.Metadata = make(map[string]string, len(e.object.Metadata))
+		for key, value := range e.object.Metadata {
+			object.Metadata[key] = value
+		}
+	}
+	object.StorageInterface = storage
+	return &object
+}
+
+// Get receive object with given path as a temporary file, see ofs.TempFile
+func (storage *Storage) Get(path string) (*os.File, error) {
+	return storage.GetWithContext(context.Background(), path)
+}
+
+// GetWithContext receive object with given path as a temporary file, it is removed once closed, see ofs.TempFile
+func (storage *Storage) GetWithContext(ctx context.Context, path string) (*os.File, error) {
+	e, err := storage.load(ctx, "get", path)
+	if err != nil {
+		return nil, err
+	}
+	return ofs.TempFile(bytes.NewReader(e.data), "ofs-memory-*"+filepath.Ext(path))
+}
+
+// GetStream get object as stream
+func (storage *Storage) GetStream(path string) (io.ReadCloser, error) {
+	return storage.GetStreamWithContext(context.Background(), path)
+}
+
+// GetStreamWithContext get object as stream
+func (storage *Storage) GetStreamWithContext(ctx context.Context, path string) (io.ReadCloser, error) {
+	e, err := storage.load(ctx, "get", path)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(e.data)), nil
+}
+
+// Put store a reader into given path
+func (storage *Storage) Put(path string, reader io.Reader) (*ofs.Object, error) {
+	return storage.PutWithContext(context.Background(), path, reader)
+}
+
+// PutWithContext store a reader into given path
+func (storage *Storage) PutWithContext(ctx context.Context, path string, reader io.Reader) (*ofs.Object, error) {
+	return storage.PutWithOptions(ctx, path, reader, nil)
+}
+
+// PutWithOptions store a reader into given path with options
+func (storage *Storage) PutWithOptions(ctx context.Context, path string, reader io.Reader, options *ofs.PutOptions) (*ofs.Object, error) {
+	if err := storage.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		seeker.Seek(0, io.SeekStart)
+	}
+
+	data, err := ioutil.ReadAll(ofs.ContextReader(ctx, reader))
+	if err != nil {
+		return nil, ofs.NewError("put", path, nil, err)
+	}
+
+	if options == nil {
+		options = &ofs.PutOptions{}
+	}
+
+	var (
+		key      = cleanPath(path)
+		now      = time.Now()
+		checksum = md5.Sum(data)
+		e        = &entry{data: data, object: ofs.Object{
+			Path:               key,
+			Name:               filepath.Base(key),
+			LastModified:       &now,
+			Size:               int64(len(data)),
+			ContentType:        options.ContentType,
+			ContentDisposition: options.ContentDisposition,
+			ContentEncoding:    options.ContentEncoding,
+			CacheControl:       options.CacheControl,
+			ETag:               hex.EncodeToString(checksum[:]),
+			Metadata:           options.NormalizedMetadata(),
+		}}
+	)
+
+	if e.object.ContentType == "" {
+		e.object.ContentType = mime.TypeByExtension(filepath.Ext(key))
+	}
+	if e.object.ContentType == "" {
+		e.object.ContentType = http.DetectContentType(data)
+	}
+
+	storage.mutex.Lock()
+	if storage.objects == nil {
+		storage.objects = map[string]*entry{}
+	}
+	if _, ok := storage.objects[key]; ok && options.CreateOnly {
+		storage.mutex.Unlock()
+		return nil, ofs.NewError("put", path, ofs.ErrExists, nil)
+	}
+	storage.objects[key] = e
+	storage.mutex.Unlock()
+
+	return storage.toObject(e), nil
+}
+
+// Delete delete object, deleting missing objects succeeds
+func (storage *Storage) Delete(path string) error {
+	return storage.DeleteWithContext(context.Background(), path)
+}
+
+// DeleteWithContext delete object, deleting missing objects succeeds
+func (storage *Storage) DeleteWithContext(ctx context.Context, path string) error {
+	if err := storage.wait(ctx); err != nil {
+		return err
+	}
+
+	storage.mutex.Lock()
+	delete(storage.objects, cleanPath(path))
+	storage.mutex.Unlock()
+	return nil
+}
+
+// List list all objects under current path
+func (storage *Storage) List(path string) ([]*ofs.Object, error) {
+	return storage.ListWithContext(context.Background(), path)
+}
+
+// ListWithContext list all objects under current path
+func (storage *Storage) ListWithContext(ctx context.Context, path string) ([]*ofs.Object, error) {
+	if err := storage.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	var (
+		objects []*ofs.Object
+		prefix  = ofs.DirPrefix(path)
+	)
+
+	storage.mutex.RLock()
+	for key, e := range storage.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, storage.toObject(e))
+		}
+	}
+	storage.mutex.RUnlock()
+
+	return objects, nil
+}
+
+// ListPage list one page of entries under path
+func (storage *Storage) ListPage(ctx context.Context, path string, options ofs.ListOptions) (*ofs.ListResult, error) {
+	objects, err := storage.ListWithContext(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return ofs.Paginate(objects, path, options), nil
+}
+
+// Stat get object's metadata
+func (storage *Storage) Stat(path string) (*ofs.Object, error) {
+	return storage.StatWithContext(context.Background(), path)
+}
+
+// StatWithContext get object's metadata
+func (storage *Storage) StatWithContext(ctx context.Context, path string) (*ofs.Object, error) {
+	e, err := storage.load(ctx, "stat", path)
+	if err != nil {
+		return nil, err
+	}
+	return storage.toObject(e), nil
+}
+
+// GetURL get a fake URL of the object, prefixed with Endpoint
+func (storage *Storage) GetURL(path string) (string, error) {
+	return storage.GetURLWithContext(context.Background(), path)
+}
+
+// GetURLWithContext get a fake URL of the object, prefixed with Endpoint
+func (storage *Storage) GetURLWithContext(ctx context.Context, path string) (string, error) {
+	if err := storage.wait(ctx); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(storage.Endpoint, "/") + (&url.URL{Path: cleanPath(path)}).EscapedPath(), nil
+}
+
+// GetEndpoint get endpoint
+func (storage *Storage) GetEndpoint() string {
+	return storage.Endpoint
+}
+
+// Copy copy object src to dst with its metadata
+func (storage *Storage) Copy(src, dst string) (*ofs.Object, error) {
+	e, err := storage.load(context.Background(), "copy", src)
+	if err != nil {
+		return nil, err
+	}
+	return storage.PutWithOptions(context.Background(), dst, bytes.NewReader(e.data), storage.toObject(e).PutOptions())
+}
+
+// Move move object src to dst with its metadata
+func (storage *Storage) Move(src, dst string) (*ofs.Object, error) {
+	object, err := storage.Copy(src, dst)
+	if err != nil {
+		return nil, err
+	}
+	if cleanPath(src) != cleanPath(dst) {
+		err = storage.Delete(src)
+	}
+	return object, err
+}
+
+// GetRange get length bytes of the object starting at offset, or till the end if length is negative
+func (storage *Storage) GetRange(path string, offset, length int64) (io.ReadCloser, error) {
+	e, err := storage.load(context.Background(), "get range", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if offset < 0 {
+		return nil, ofs.NewError("get range", path, ofs.ErrInvalidPath, fmt.Errorf("negative offset %d", offset))
+	}
+	if offset > int64(len(e.data)) {
+		return nil, ofs.NewError("get range", path, nil, fmt.Errorf("offset %d beyond size %d", offset, len(e.data)))
+	}
+	return ofs.LimitReadCloser(ioutil.NopCloser(bytes.NewReader(e.data[offset:])), length), nil
+}
+
+// OpenReaderAt open a random access reader of the object
+func (storage *Storage) OpenReaderAt(path string) (ofs.ObjectReader, error) {
+	e, err := storage.load(context.Background(), "open reader", path)
+	if err != nil {
+		return nil, err
+	}
+	return objectReader{bytes.NewReader(e.data)}, nil
+}
+
+type objectReader struct {
+	*bytes.Reader
+}
+
+func (reader objectReader) Close() error {
+	return nil
+}
+
+// OpenWriter open a writer to store an object into given path, the object is stored on Close
+func (storage *Storage) OpenWriter(path string, options *ofs.PutOptions) (ofs.Writer, error) {
+	return ofs.NewPipeWriter(context.Background(), func(ctx context.Context, reader io.Reader) error {
+		_, err := storage.PutWithOptions(ctx, path, reader, options)
+		return err
+	}), nil
+}
@@ -0,0 +1,83 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MayCMF/ofs"
+	"github.com/MayCMF/ofs/memory"
+	"github.com/MayCMF/ofs/ofstest"
+)
+
+func TestAll(t *testing.T) {
+	ofstest.TestAll(memory.New(), t)
+}
+
+func TestLatency(t *testing.T) {
+	storage := memory.New()
+	storage.Latency = 50 * time.Millisecond
+
+	start := time.Now()
+	if _, err := storage.Put("/latency.txt", strings.NewReader("slow")); err != nil {
+		t.Errorf("Put fail %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < storage.Latency {
+		t.Errorf("Put should take at least %v, but took %v", storage.Latency, elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := storage.StatWithContext(ctx, "/latency.txt"); err != context.DeadlineExceeded {
+		t.Errorf("Stat should time out, but got %v", err)
+	}
+}
+
+func TestGetURL(t *testing.T) {
+	storage := memory.New()
+	storage.Endpoint = "https://cdn.example.com/"
+
+	if url, _ := storage.GetURL("dir/file name.txt"); url != "https://cdn.example.com/dir/file%20name.txt" {
+		t.Errorf("URL should be escaped and prefixed with endpoint, but got %v", url)
+	}
+}
+
+func TestGetRange(t *testing.T) {
+	storage := memory.New()
+	storage.Put("/range.txt", strings.NewReader("0123456789"))
+
+	if _, err := storage.GetRange("/range.txt", -1, 2); !errors.Is(err, ofs.ErrInvalidPath) {
+		t.Errorf("negative offset should be refused, but got %v", err)
+	}
+
+	stream, err := storage.GetRange("/range.txt", 2, 3)
+	if err != nil {
+		t.Fatalf("GetRange fail %v", err)
+	}
+	defer stream.Close()
+	if data, _ := ioutil.ReadAll(stream); string(data) != "234" {
+		t.Errorf("GetRange should read the range, but got %q", data)
+	}
+}
+
+func TestGetRemovesTempFile(t *testing.T) {
+	storage := memory.New()
+	storage.Put("/temp.txt", strings.NewReader("temporary"))
+
+	file, err := storage.Get("/temp.txt")
+	if err != nil {
+		t.Fatalf("Get fail %v", err)
+	}
+	defer file.Close()
+
+	if data, _ := ioutil.ReadAll(file); string(data) != "temporary" {
+		t.Errorf("Get should return the content, but got %q", data)
+	}
+	if _, err := os.Stat(file.Name()); !os.IsNotExist(err) {
+		t.Errorf("temporary file shouldn't be left in the file system, but got %v", err)
+	}
+}
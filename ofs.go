@@ -1,6 +1,7 @@
 package ofs
 
 import (
+	"context"
 	"io"
 	"os"
 	"time"
@@ -13,16 +14,37 @@ type StorageInterface interface {
 	Put(path string, reader io.Reader) (*Object, error)
 	Delete(path string) error
 	List(path string) ([]*Object, error)
+	Stat(path string) (*Object, error)
 	GetURL(path string) (string, error)
 	GetEndpoint() string
 }
 
+// StorageWithContext context-first variant of StorageInterface, the context's cancellation and deadline are propagated to the storage backend
+type StorageWithContext interface {
+	GetWithContext(ctx context.Context, path string) (*os.File, error)
+	GetStreamWithContext(ctx context.Context, path string) (io.ReadCloser, error)
+	PutWithContext(ctx context.Context, path string, reader io.Reader) (*Object, error)
+	DeleteWithContext(ctx context.Context, path string) error
+	ListWithContext(ctx context.Context, path string) ([]*Object, error)
+	StatWithContext(ctx context.Context, path string) (*Object, error)
+	GetURLWithContext(ctx context.Context, path string) (string, error)
+	GetEndpoint() string
+}
+
 // Object content object
 type Object struct {
-	Path             string
-	Name             string
-	LastModified     *time.Time
-	StorageInterface StorageInterface
+	Path               string
+	Name               string
+	LastModified       *time.Time
+	Size               int64
+	ContentType        string
+	ContentDisposition string
+	ContentEncoding    string
+	CacheControl       string
+	ETag               string
+	Metadata           map[string]string
+	IsDir              bool
+	StorageInterface   StorageInterface
 }
 
 // Get retrieve object's content
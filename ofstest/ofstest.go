@@ -0,0 +1,570 @@
+// Package ofstest implements a conformance test suite for implementations of ofs.StorageInterface
+package ofstest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MayCMF/ofs"
+)
+
+// TestAll run all conformance tests against storage, objects are created under a unique prefix that is cleaned up afterwards,
+// tests of optional capabilities (PutWithOptions, Copy, ranged reads, writers) are skipped if the storage doesn't implement them
+func TestAll(storage ofs.StorageInterface, t *testing.T) {
+	prefix := fmt.Sprintf("/ofstest-%d", time.Now().UnixNano())
+	defer cleanup(storage, prefix, t)
+
+	tests := []struct {
+		name string
+		test func(storage ofs.StorageInterface, prefix string, t *testing.T)
+	}{
+		{"PutGet", testPutGet},
+		{"NestedPath", testNestedPath},
+		{"SpecialNames", testSpecialNames},
+		{"EmptyObject", testEmptyObject},
+		{"Overwrite", testOverwrite},
+		{"Stat", testStat},
+		{"List", testList},
+		{"ListPage", testListPage},
+		{"Delete", testDelete},
+		{"GetURL", testGetURL},
+		{"ConcurrentWriters", testConcurrentWriters},
+		{"PutWithOptions", testPutWithOptions},
+		{"CreateOnly", testCreateOnly},
+		{"CopyMove", testCopyMove},
+		{"GetRange", testGetRange},
+		{"OpenWriter", testOpenWriter},
+		{"ResumableUpload", testResumableUpload},
+	}
+
+	for i, test := range tests {
+		test := test
+		dir := fmt.Sprintf("%v/%02d", prefix, i)
+		t.Run(test.name, func(t *testing.T) {
+			test.test(storage, dir, t)
+		})
+	}
+}
+
+func cleanup(storage ofs.StorageInterface, prefix string, t *testing.T) {
+	objects, err := storage.List(prefix)
+	if err != nil {
+		t.Errorf("failed to list %v for cleanup, got %v", prefix, err)
+		return
+	}
+	for _, object := range objects {
+		storage.Delete(object.Path)
+	}
+}
+
+// put store content into path, failing the test on error
+func put(storage ofs.StorageInterface, path string, content []byte, t *testing.T) *ofs.Object {
+	t.Helper()
+	object, err := storage.Put(path, bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("failed to put %v, got %v", path, err)
+	}
+	return object
+}
+
+// checkContent check content of path with both Get and GetStream
+func checkContent(storage ofs.StorageInterface, path string, content []byte, t *testing.T) {
+	t.Helper()
+
+	file, err := storage.Get(path)
+	if err != nil {
+		t.Errorf("failed to get %v, got %v", path, err)
+		return
+	}
+	data, err := ioutil.ReadAll(file)
+	file.Close()
+	if err != nil || !bytes.Equal(data, content) {
+		t.Errorf("content of %v got from Get should be %q, but got %q, %v", path, content, data, err)
+	}
+
+	stream, err := storage.GetStream(path)
+	if err != nil {
+		t.Errorf("failed to get stream of %v, got %v", path, err)
+		return
+	}
+	data, err = ioutil.ReadAll(stream)
+	stream.Close()
+	if err != nil || !bytes.Equal(data, content) {
+		t.Errorf("content of %v got from GetStream should be %q, but got %q, %v", path, content, data, err)
+	}
+}
+
+func listPaths(storage ofs.StorageInterface, dir string, t *testing.T) []string {
+	t.Helper()
+	objects, err := storage.List(dir)
+	if err != nil {
+		t.Errorf("failed to list %v, got %v", dir, err)
+	}
+
+	var paths []string
+	for _, object := range objects {
+		paths = append(paths, "/"+strings.TrimPrefix(object.Path, "/"))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func testPutGet(storage ofs.StorageInterface, dir string, t *testing.T) {
+	var (
+		filePath = dir + "/sample.txt"
+		content  = []byte("Hello MayCMF OFS")
+	)
+
+	object := put(storage, filePath, content, t)
+	if object == nil || object.Name != "sample.txt" {
+		t.Errorf("Put should return object named sample.txt, but got %+v", object)
+	}
+
+	checkContent(storage, filePath, content, t)
+
+	if object != nil && object.StorageInterface != nil {
+		file, err := object.Get()
+		if err != nil {
+			t.Errorf("failed to get content from object, got %v", err)
+			return
+		}
+		file.Close()
+	}
+}
+
+func testNestedPath(storage ofs.StorageInterface, dir string, t *testing.T) {
+	filePath := dir + "/a/b/c/d/nested.txt"
+	put(storage, filePath, []byte("nested"), t)
+	checkContent(storage, filePath, []byte("nested"), t)
+}
+
+func testSpecialNames(storage ofs.StorageInterface, dir string, t *testing.T) {
+	for _, name := range []string{"with space.txt", "ünïcödé.txt", "文件.txt", "plus+sign&more=chars.txt", "dir with space/file name.txt"} {
+		filePath := dir + "/" + name
+		put(storage, filePath, []byte(name), t)
+		checkContent(storage, filePath, []byte(name), t)
+
+		if object, err := storage.Stat(filePath); err != nil || object.Size != int64(len(name)) {
+			t.Errorf("failed to stat %v, got %+v, %v", filePath, object, err)
+		}
+	}
+
+	paths := listPaths(storage, dir, t)
+	if len(paths) != 5 {
+		t.Errorf("list should return 5 objects, but got %v", paths)
+	}
+}
+
+func testEmptyObject(storage ofs.StorageInterface, dir string, t *testing.T) {
+	filePath := dir + "/empty.txt"
+	put(storage, filePath, []byte{}, t)
+	checkContent(storage, filePath, []byte{}, t)
+
+	if object, err := storage.Stat(filePath); err != nil || object.Size != 0 {
+		t.Errorf("empty object should have size 0, but got %+v, %v", object, err)
+	}
+}
+
+func testOverwrite(storage ofs.StorageInterface, dir string, t *testing.T) {
+	filePath := dir + "/overwrite.txt"
+	put(storage, filePath, []byte("a long original content"), t)
+	put(storage, filePath, []byte("short"), t)
+	checkContent(storage, filePath, []byte("short"), t)
+}
+
+func testStat(storage ofs.StorageInterface, dir string, t *testing.T) {
+	var (
+		filePath = dir + "/stat.txt"
+		content  = []byte("Hello Stat")
+	)
+	put(storage, filePath, content, t)
+
+	object, err := storage.Stat(filePath)
+	if err != nil {
+		t.Errorf("failed to stat %v, got %v", filePath, err)
+		return
+	}
+
+	if object.Size != int64(len(content)) {
+		t.Errorf("size should be %v, but got %v", len(content), object.Size)
+	}
+	if object.Name != "stat.txt" {
+		t.Errorf("name should be stat.txt, but got %v", object.Name)
+	}
+	if object.LastModified == nil || object.LastModified.IsZero() {
+		t.Errorf("last modified should be set, but got %v", object.LastModified)
+	}
+	if "/"+strings.TrimPrefix(object.Path, "/") != filePath {
+		t.Errorf("path should be %v, but got %v", filePath, object.Path)
+	}
+
+	if _, err := storage.Stat(dir + "/missing.txt"); !errors.Is(err, ofs.ErrNotFound) {
+		t.Errorf("stat missing object should return ofs.ErrNotFound, but got %v", err)
+	}
+}
+
+func testList(storage ofs.StorageInterface, dir string, t *testing.T) {
+	expected := []string{dir + "/a.txt", dir + "/b/b.txt", dir + "/b/c/c.txt"}
+	for _, filePath := range expected {
+		put(storage, filePath, []byte(filePath), t)
+	}
+	put(storage, dir+"-sibling/a.txt", []byte("sibling"), t)
+	defer storage.Delete(dir + "-sibling/a.txt")
+
+	if paths := listPaths(storage, dir, t); strings.Join(paths, ",") != strings.Join(expected, ",") {
+		t.Errorf("list should return %v, but got %v", expected, paths)
+	}
+
+	if paths := listPaths(storage, dir+"/b", t); len(paths) != 2 {
+		t.Errorf("list of sub directory should return 2 objects, but got %v", paths)
+	}
+
+	if paths := listPaths(storage, dir+"/missing", t); len(paths) != 0 {
+		t.Errorf("list of missing directory should be empty, but got %v", paths)
+	}
+}
+
+func testListPage(storage ofs.StorageInterface, dir string, t *testing.T) {
+	for _, filePath := range []string{"/a.txt", "/b/b.txt", "/b/c/c.txt", "/d.txt", "/e.txt"} {
+		put(storage, dir+filePath, []byte(filePath), t)
+	}
+
+	walk := func(options ofs.ListOptions) (paths []string) {
+		err := ofs.Walk(context.Background(), storage, dir, options, func(object *ofs.Object) error {
+			paths = append(paths, strings.TrimPrefix("/"+strings.TrimPrefix(object.Path, "/"), dir))
+			return nil
+		})
+		if err != nil {
+			t.Errorf("failed to walk %v, got %v", dir, err)
+		}
+		return
+	}
+
+	if paths := walk(ofs.ListOptions{Recursive: true, MaxKeys: 2}); strings.Join(paths, ",") != "/a.txt,/b/b.txt,/b/c/c.txt,/d.txt,/e.txt" {
+		t.Errorf("recursive walk returned wrong paths %v", paths)
+	}
+
+	if paths := walk(ofs.ListOptions{MaxKeys: 2}); strings.Join(paths, ",") != "/a.txt,/b/,/d.txt,/e.txt" {
+		t.Errorf("one level walk returned wrong paths %v", paths)
+	}
+
+	if paths := walk(ofs.ListOptions{Recursive: true, StartAfter: dir + "/b/b.txt"}); strings.Join(paths, ",") != "/b/c/c.txt,/d.txt,/e.txt" {
+		t.Errorf("walk with start after returned wrong paths %v", paths)
+	}
+
+	result, err := ofs.ListPage(context.Background(), storage, dir, ofs.ListOptions{Recursive: true, MaxKeys: 3})
+	if err != nil || len(result.Objects) != 3 || result.NextContinuationToken == "" {
+		t.Errorf("first page should have 3 objects and a continuation token, but got %+v, %v", result, err)
+	}
+}
+
+func testDelete(storage ofs.StorageInterface, dir string, t *testing.T) {
+	filePath := dir + "/delete.txt"
+	put(storage, filePath, []byte("delete me"), t)
+
+	if err := storage.Delete(filePath); err != nil {
+		t.Errorf("failed to delete %v, got %v", filePath, err)
+	}
+
+	if _, err := storage.Get(filePath); !errors.Is(err, ofs.ErrNotFound) {
+		t.Errorf("get deleted object should return ofs.ErrNotFound, but got %v", err)
+	}
+
+	if _, err := storage.Stat(filePath); !errors.Is(err, ofs.ErrNotFound) {
+		t.Errorf("stat deleted object should return ofs.ErrNotFound, but got %v", err)
+	}
+
+	if err := storage.Delete(dir + "/missing.txt"); err != nil {
+		t.Errorf("delete missing object should succeed, but got %v", err)
+	}
+}
+
+func testGetURL(storage ofs.StorageInterface, dir string, t *testing.T) {
+	filePath := dir + "/url.txt"
+	put(storage, filePath, []byte("url"), t)
+
+	if url, err := storage.GetURL(filePath); err != nil || url == "" {
+		t.Errorf("failed to get URL of %v, got %q, %v", filePath, url, err)
+	}
+}
+
+func testConcurrentWriters(storage ofs.StorageInterface, dir string, t *testing.T) {
+	var (
+		wg       sync.WaitGroup
+		shared   = dir + "/shared.txt"
+		contents = map[string]bool{}
+	)
+
+	for i := 0; i < 8; i++ {
+		content := strings.Repeat(fmt.Sprintf("writer %d;", i), 1024)
+		contents[content] = true
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := storage.Put(fmt.Sprintf("%v/own-%d.txt", dir, i), strings.NewReader(content)); err != nil {
+				t.Errorf("concurrent put fail %v", err)
+			}
+			if _, err := storage.Put(shared, strings.NewReader(content)); err != nil {
+				t.Errorf("concurrent put of shared object fail %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 8; i++ {
+		checkContent(storage, fmt.Sprintf("%v/own-%d.txt", dir, i), []byte(strings.Repeat(fmt.Sprintf("writer %d;", i), 1024)), t)
+	}
+
+	stream, err := storage.GetStream(shared)
+	if err != nil {
+		t.Errorf("failed to get shared object, got %v", err)
+		return
+	}
+	defer stream.Close()
+
+	if data, _ := ioutil.ReadAll(stream); !contents[string(data)] {
+		t.Errorf("shared object should hold content of exactly one writer, but got %d bytes", len(data))
+	}
+}
+
+func testPutWithOptions(storage ofs.StorageInterface, dir string, t *testing.T) {
+	if _, ok := storage.(ofs.OptionsPutter); !ok {
+		t.Skip("storage doesn't implement ofs.OptionsPutter")
+	}
+
+	var (
+		filePath = dir + "/options.bin"
+		options  = &ofs.PutOptions{
+			ContentType:        "application/x-ofstest",
+			ContentDisposition: `attachment; filename="options.bin"`,
+			CacheControl:       "max-age=60",
+			Metadata:           map[string]string{"Owner": "ofstest"},
+		}
+	)
+
+	if _, err := ofs.PutWithOptions(context.Background(), storage, filePath, strings.NewReader("options"), options); err != nil {
+		t.Errorf("failed to put with options, got %v", err)
+		return
+	}
+
+	object, err := storage.Stat(filePath)
+	if err != nil {
+		t.Errorf("failed to stat %v, got %v", filePath, err)
+		return
+	}
+
+	if object.ContentType != options.ContentType || object.ContentDisposition != options.ContentDisposition ||
+		object.CacheControl != options.CacheControl || object.Metadata["owner"] != "ofstest" {
+		t.Errorf("options should round trip through Stat, but got %+v", object)
+	}
+}
+
+func testCreateOnly(storage ofs.StorageInterface, dir string, t *testing.T) {
+	if _, ok := storage.(ofs.OptionsPutter); !ok {
+		t.Skip("storage doesn't implement ofs.OptionsPutter")
+	}
+
+	var (
+		filePath = dir + "/create-only.txt"
+		options  = &ofs.PutOptions{CreateOnly: true}
+	)
+
+	if _, err := ofs.PutWithOptions(context.Background(), storage, filePath, strings.NewReader("first"), options); err != nil {
+		t.Errorf("failed to create %v, got %v", filePath, err)
+		return
+	}
+
+	if _, err := ofs.PutWithOptions(context.Background(), storage, filePath, strings.NewReader("second"), options); !errors.Is(err, ofs.ErrExists) {
+		t.Errorf("creating an existing object should return ofs.ErrExists, but got %v", err)
+	}
+	checkContent(storage, filePath, []byte("first"), t)
+}
+
+func testCopyMove(storage ofs.StorageInterface, dir string, t *testing.T) {
+	if _, ok := storage.(ofs.Copier); !ok {
+		t.Skip("storage doesn't implement ofs.Copier")
+	}
+
+	content := []byte("copy me")
+	put(storage, dir+"/src.txt", content, t)
+
+	if _, err := ofs.Copy(storage, dir+"/src.txt", dir+"/copy.txt"); err != nil {
+		t.Errorf("failed to copy, got %v", err)
+	}
+	checkContent(storage, dir+"/src.txt", content, t)
+	checkContent(storage, dir+"/copy.txt", content, t)
+
+	if _, err := ofs.Move(storage, dir+"/copy.txt", dir+"/moved/moved.txt"); err != nil {
+		t.Errorf("failed to move, got %v", err)
+	}
+	checkContent(storage, dir+"/moved/moved.txt", content, t)
+
+	if _, err := storage.Stat(dir + "/copy.txt"); !errors.Is(err, ofs.ErrNotFound) {
+		t.Errorf("moved object should be removed, but got %v", err)
+	}
+
+	if _, err := ofs.Copy(storage, dir+"/missing.txt", dir+"/copy.txt"); !errors.Is(err, ofs.ErrNotFound) {
+		t.Errorf("copy missing object should return ofs.ErrNotFound, but got %v", err)
+	}
+}
+
+func testGetRange(storage ofs.StorageInterface, dir string, t *testing.T) {
+	if _, ok := storage.(ofs.RangeReader); !ok {
+		t.Skip("storage doesn't implement ofs.RangeReader")
+	}
+
+	filePath := dir + "/range.txt"
+	put(storage, filePath, []byte("0123456789"), t)
+
+	for _, r := range []struct {
+		offset, length int64
+		expected       string
+	}{{0, 3, "012"}, {5, -1, "56789"}, {8, 10, "89"}, {4, 0, ""}} {
+		reader, err := ofs.GetRange(storage, filePath, r.offset, r.length)
+		if err != nil {
+			t.Errorf("failed to get range %v+%v, got %v", r.offset, r.length, err)
+			continue
+		}
+		data, _ := ioutil.ReadAll(reader)
+		reader.Close()
+		if string(data) != r.expected {
+			t.Errorf("range %v+%v should be %q, but got %q", r.offset, r.length, r.expected, data)
+		}
+	}
+
+	if _, err := storage.(ofs.RangeReader).GetRange(filePath, -2, 3); !errors.Is(err, ofs.ErrInvalidPath) {
+		t.Errorf("range with a negative offset should fail with ofs.ErrInvalidPath, but got %v", err)
+	}
+
+	reader, err := ofs.OpenReaderAt(storage, filePath)
+	if err != nil {
+		t.Errorf("failed to open reader, got %v", err)
+		return
+	}
+	defer reader.Close()
+
+	buffer := make([]byte, 4)
+	if n, err := reader.ReadAt(buffer, 3); n != 4 || string(buffer) != "3456" {
+		t.Errorf("ReadAt should read 3456, but got %q, %v", buffer[:n], err)
+	}
+
+	if _, err := reader.Seek(-2, io.SeekEnd); err != nil {
+		t.Errorf("failed to seek, got %v", err)
+	}
+	if data, _ := ioutil.ReadAll(reader); string(data) != "89" {
+		t.Errorf("read after seek should be 89, but got %q", data)
+	}
+}
+
+func testOpenWriter(storage ofs.StorageInterface, dir string, t *testing.T) {
+	if _, ok := storage.(ofs.WriterOpener); !ok {
+		t.Skip("storage doesn't implement ofs.WriterOpener")
+	}
+
+	writer, err := ofs.OpenWriter(storage, dir+"/written.txt", nil)
+	if err != nil {
+		t.Errorf("failed to open writer, got %v", err)
+		return
+	}
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(writer, "line %d\n", i)
+	}
+	if err = writer.Close(); err != nil {
+		t.Errorf("failed to close writer, got %v", err)
+	}
+	checkContent(storage, dir+"/written.txt", []byte("line 0\nline 1\nline 2\n"), t)
+
+	aborted, err := ofs.OpenWriter(storage, dir+"/aborted.txt", nil)
+	if err != nil {
+		t.Errorf("failed to open writer, got %v", err)
+		return
+	}
+	aborted.Write([]byte("partial"))
+	aborted.Abort()
+
+	if _, err := storage.Stat(dir + "/aborted.txt"); !errors.Is(err, ofs.ErrNotFound) {
+		t.Errorf("aborted object shouldn't exist, but got %v", err)
+	}
+
+	if paths := listPaths(storage, dir, t); len(paths) != 1 || path.Base(paths[0]) != "written.txt" {
+		t.Errorf("only the written object should be listed, but got %v", paths)
+	}
+}
+
+func testResumableUpload(storage ofs.StorageInterface, dir string, t *testing.T) {
+	uploader, ok := ofs.AsResumableUploader(storage)
+	if !ok {
+		t.Skip("storage doesn't implement ofs.ResumableUploader")
+	}
+
+	var (
+		ctx      = context.Background()
+		filePath = dir + "/resumable.txt"
+	)
+
+	uploadID, err := uploader.CreateUpload(ctx, filePath, &ofs.PutOptions{ContentType: "text/x-resumable"})
+	if err != nil {
+		t.Errorf("failed to create upload, got %v", err)
+		return
+	}
+
+	offset := int64(0)
+	for _, chunk := range []string{"Hello ", "resumable ", "upload"} {
+		if _, err := uploader.WriteUpload(ctx, filePath, uploadID, offset+1, strings.NewReader(chunk)); !errors.Is(err, ofs.ErrOffsetMismatch) {
+			t.Errorf("writing at wrong offset should return ofs.ErrOffsetMismatch, but got %v", err)
+		}
+
+		n, err := uploader.WriteUpload(ctx, filePath, uploadID, offset, strings.NewReader(chunk))
+		if err != nil || n != int64(len(chunk)) {
+			t.Errorf("failed to write chunk %q, got %v, %v", chunk, n, err)
+			return
+		}
+		offset += n
+
+		if current, err := uploader.UploadOffset(ctx, filePath, uploadID); err != nil || current != offset {
+			t.Errorf("upload offset should be %v, but got %v, %v", offset, current, err)
+		}
+	}
+
+	if _, err := storage.Stat(filePath); !errors.Is(err, ofs.ErrNotFound) {
+		t.Errorf("unfinished upload shouldn't be visible, but got %v", err)
+	}
+
+	if _, err := uploader.CompleteUpload(ctx, filePath, uploadID); err != nil {
+		t.Errorf("failed to complete upload, got %v", err)
+		return
+	}
+	checkContent(storage, filePath, []byte("Hello resumable upload"), t)
+
+	if object, err := storage.Stat(filePath); err != nil || object.ContentType != "text/x-resumable" {
+		t.Errorf("options should be applied to the completed object, but got %+v, %v", object, err)
+	}
+
+	abortedID, err := uploader.CreateUpload(ctx, dir+"/aborted.txt", nil)
+	if err != nil {
+		t.Errorf("failed to create upload, got %v", err)
+		return
+	}
+	uploader.WriteUpload(ctx, dir+"/aborted.txt", abortedID, 0, strings.NewReader("partial"))
+
+	if err := uploader.AbortUpload(ctx, dir+"/aborted.txt", abortedID); err != nil {
+		t.Errorf("failed to abort upload, got %v", err)
+	}
+	if _, err := uploader.UploadOffset(ctx, dir+"/aborted.txt", abortedID); !errors.Is(err, ofs.ErrNotFound) {
+		t.Errorf("aborted upload should be not found, but got %v", err)
+	}
+	if paths := listPaths(storage, dir, t); len(paths) != 1 || path.Base(paths[0]) != "resumable.txt" {
+		t.Errorf("only the completed object should be listed, but got %v", paths)
+	}
+}
@@ -0,0 +1,78 @@
+package ofs
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// ACLPrivate canned ACL of objects that are only accessible by their owner, e.g. internal state that shouldn't be public
+const ACLPrivate = "private"
+
+// PutOptions per object options of Put, empty fields fall back to the storage's defaults
+type PutOptions struct {
+	ContentType        string
+	ContentDisposition string
+	ContentEncoding    string
+	CacheControl       string
+	ACL                string
+	// Metadata custom key/value metadata, keys are case-insensitive and stored in lower case
+	Metadata map[string]string
+	// CreateOnly fail with ErrExists instead of overwriting an existing object
+	CreateOnly bool
+}
+
+// IsZero report whether no option is set
+func (options *PutOptions) IsZero() bool {
+	return options == nil || (options.ContentType == "" && options.ContentDisposition == "" && options.ContentEncoding == "" &&
+		options.CacheControl == "" && options.ACL == "" && len(options.Metadata) == 0 && !options.CreateOnly)
+}
+
+// NormalizedMetadata return Metadata with lower case keys
+func (options *PutOptions) NormalizedMetadata() map[string]string {
+	if options == nil || len(options.Metadata) == 0 {
+		return nil
+	}
+
+	metadata := make(map[string]string, len(options.Metadata))
+	for key, value := range options.Metadata {
+		metadata[strings.ToLower(key)] = value
+	}
+	return metadata
+}
+
+// PutOptions return the options to store a copy of object with the same metadata
+func (object Object) PutOptions() *PutOptions {
+	return &PutOptions{
+		ContentType:        object.ContentType,
+		ContentDisposition: object.ContentDisposition,
+		ContentEncoding:    object.ContentEncoding,
+		CacheControl:       object.CacheControl,
+		Metadata:           object.Metadata,
+	}
+}
+
+// OptionsPutter implemented by storages that could store per object options
+type OptionsPutter interface {
+	PutWithOptions(ctx context.Context, path string, reader io.Reader, options *PutOptions) (*Object, error)
+}
+
+// PutWithOptions store a reader into given path with options, returns ErrUnsupported if options are set but the storage doesn't implement OptionsPutter
+func PutWithOptions(ctx context.Context, storage StorageInterface, path string, reader io.Reader, options *PutOptions) (*Object, error) {
+	if putter, ok := storage.(OptionsPutter); ok {
+		return putter.PutWithOptions(ctx, path, reader, options)
+	}
+
+	if !options.IsZero() {
+		return nil, NewError("put", path, ErrUnsupported, nil)
+	}
+	return WithContext(storage).PutWithContext(ctx, path, reader)
+}
+
+// putCopy store a copy of object into storage, keeping object's metadata if the storage supports PutOptions
+func putCopy(ctx context.Context, storage StorageInterface, path string, reader io.Reader, object *Object) (*Object, error) {
+	if _, ok := storage.(OptionsPutter); ok {
+		return PutWithOptions(ctx, storage, path, reader, object.PutOptions())
+	}
+	return WithContext(storage).PutWithContext(ctx, path, reader)
+}
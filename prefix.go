@@ -0,0 +1,442 @@
+package ofs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+var errOutsidePrefix = errors.New("path escapes the prefix")
+
+// PrefixStorage confine Storage to the objects under Prefix, e.g. `tenants/1`, like a chroot,
+// paths are resolved relative to Prefix, paths that would escape it with `..` are refused with ErrInvalidPath,
+// and paths of returned objects and errors are relative to Prefix, so callers can't see objects outside of it.
+// Capabilities of Storage are used when it has them, use AsResumableUploader to check whether its resumable uploads are supported
+type PrefixStorage struct {
+	Storage StorageInterface
+	// Prefix directory of the objects, with a leading slash and without a trailing one, e.g. `/tenants/1`
+	Prefix string
+}
+
+// WithPrefix confine storage to the objects under prefix
+func WithPrefix(storage StorageInterface, prefix string) *PrefixStorage {
+	if inner, ok := storage.(*PrefixStorage); ok {
+		return &PrefixStorage{Storage: inner.Storage, Prefix: inner.Prefix + strings.TrimSuffix(DirPrefix(prefix), "/")}
+	}
+	return &PrefixStorage{Storage: storage, Prefix: strings.TrimSuffix(DirPrefix(prefix), "/")}
+}
+
+// FullPath return path of the wrapped storage for path relative to Prefix, or ErrInvalidPath if path escapes Prefix
+func (storage *PrefixStorage) FullPath(path string) (string, error) {
+	if strings.IndexByte(path, 0) >= 0 {
+		return "", NewError("resolve", path, ErrInvalidPath, errors.New("path contains NUL byte"))
+	}
+
+	var elems []string
+	for _, elem := range strings.Split(path, "/") {
+		switch elem {
+		case "", ".":
+		case "..":
+			if len(elems) == 0 {
+				return "", NewError("resolve", path, ErrInvalidPath, errOutsidePrefix)
+			}
+			elems = elems[:len(elems)-1]
+		default:
+			// backslashes are separators of file systems on Windows
+			for _, part := range strings.Split(elem, `\`) {
+				if part == ".." {
+					return "", NewError("resolve", path, ErrInvalidPath, errOutsidePrefix)
+				}
+			}
+			elems = append(elems, elem)
+		}
+	}
+	return storage.Prefix + "/" + strings.Join(elems, "/"), nil
+}
+
+// relativePath strip Prefix from path of the wrapped storage, ok is false if path isn't under Prefix
+func (storage *PrefixStorage) relativePath(path string) (string, bool) {
+	path = "/" + strings.TrimPrefix(path, "/")
+	if storage.Prefix == "" {
+		return path, true
+	}
+	if path == storage.Prefix {
+		return "/", true
+	}
+	if strings.HasPrefix(path, storage.Prefix+"/") {
+		return strings.TrimPrefix(path, storage.Prefix), true
+	}
+	return "", false
+}
+
+// own return a copy of object with its path relative to Prefix, pointing to the wrapper, so object.Get keeps working
+func (storage *PrefixStorage) own(object *Object) *Object {
+	if object == nil {
+		return nil
+	}
+
+	owned := *object
+	if path, ok := storage.relativePath(object.Path); ok {
+		owned.Path = path
+	}
+	owned.StorageInterface = storage
+	return &owned
+}
+
+// ownAll own objects, dropping objects outside of Prefix
+func (storage *PrefixStorage) ownAll(objects []*Object) []*Object {
+	owned := make([]*Object, 0, len(objects))
+	for _, object := range objects {
+		if _, ok := storage.relativePath(object.Path); ok {
+			owned = append(owned, storage.own(object))
+		}
+	}
+	return owned
+}
+
+// wrapError make the path of the wrapped storage's error relative to Prefix
+func (storage *PrefixStorage) wrapError(err error) error {
+	if e, ok := err.(*Error); ok {
+		if path, ok := storage.relativePath(e.Path); ok && e.Path != "" {
+			wrapped := *e
+			wrapped.Path = path
+			return &wrapped
+		}
+	}
+	return err
+}
+
+// Get receive file with given path
+func (storage *PrefixStorage) Get(path string) (*os.File, error) {
+	return storage.GetWithContext(context.Background(), path)
+}
+
+// GetWithContext receive file with given path
+func (storage *PrefixStorage) GetWithContext(ctx context.Context, path string) (*os.File, error) {
+	fullpath, err := storage.FullPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := WithContext(storage.Storage).GetWithContext(ctx, fullpath)
+	return file, storage.wrapError(err)
+}
+
+// GetStream get file as stream
+func (storage *PrefixStorage) GetStream(path string) (io.ReadCloser, error) {
+	return storage.GetStreamWithContext(context.Background(), path)
+}
+
+// GetStreamWithContext get file as stream
+func (storage *PrefixStorage) GetStreamWithContext(ctx context.Context, path string) (io.ReadCloser, error) {
+	fullpath, err := storage.FullPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := WithContext(storage.Storage).GetStreamWithContext(ctx, fullpath)
+	return stream, storage.wrapError(err)
+}
+
+// Put store a reader into given path
+func (storage *PrefixStorage) Put(path string, reader io.Reader) (*Object, error) {
+	return storage.PutWithContext(context.Background(), path, reader)
+}
+
+// PutWithContext store a reader into given path
+func (storage *PrefixStorage) PutWithContext(ctx context.Context, path string, reader io.Reader) (*Object, error) {
+	fullpath, err := storage.FullPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := WithContext(storage.Storage).PutWithContext(ctx, fullpath, reader)
+	return storage.own(object), storage.wrapError(err)
+}
+
+// PutWithOptions store a reader into given path with options, see PutWithOptions
+func (storage *PrefixStorage) PutWithOptions(ctx context.Context, path string, reader io.Reader, options *PutOptions) (*Object, error) {
+	fullpath, err := storage.FullPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := PutWithOptions(ctx, storage.Storage, fullpath, reader, options)
+	return storage.own(object), storage.wrapError(err)
+}
+
+// OpenWriter open a writer to store an object into given path, see OpenWriter
+func (storage *PrefixStorage) OpenWriter(path string, options *PutOptions) (Writer, error) {
+	fullpath, err := storage.FullPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	writer, err := OpenWriter(storage.Storage, fullpath, options)
+	return writer, storage.wrapError(err)
+}
+
+// Delete delete file, Prefix itself can't be deleted
+func (storage *PrefixStorage) Delete(path string) error {
+	return storage.DeleteWithContext(context.Background(), path)
+}
+
+// DeleteWithContext delete file, Prefix itself can't be deleted
+func (storage *PrefixStorage) DeleteWithContext(ctx context.Context, path string) error {
+	fullpath, err := storage.FullPath(path)
+	if err != nil {
+		return err
+	}
+	if fullpath == storage.Prefix+"/" {
+		return NewError("delete", path, ErrInvalidPath, errors.New("can't delete the prefix"))
+	}
+	return storage.wrapError(WithContext(storage.Storage).DeleteWithContext(ctx, fullpath))
+}
+
+// List list all objects under current path
+func (storage *PrefixStorage) List(path string) ([]*Object, error) {
+	return storage.ListWithContext(context.Background(), path)
+}
+
+// ListWithContext list all objects under current path
+func (storage *PrefixStorage) ListWithContext(ctx context.Context, path string) ([]*Object, error) {
+	fullpath, err := storage.FullPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := WithContext(storage.Storage).ListWithContext(ctx, fullpath)
+	return storage.ownAll(objects), storage.wrapError(err)
+}
+
+// ListPage list one page of entries under path, see ListPage
+func (storage *PrefixStorage) ListPage(ctx context.Context, path string, options ListOptions) (*ListResult, error) {
+	fullpath, err := storage.FullPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.StartAfter != "" {
+		if options.StartAfter, err = storage.FullPath(options.StartAfter); err != nil {
+			return nil, err
+		}
+	}
+	options.ContinuationToken = storage.fullToken(options.ContinuationToken)
+
+	result, err := ListPage(ctx, storage.Storage, fullpath, options)
+	if err != nil {
+		return nil, storage.wrapError(err)
+	}
+	return &ListResult{Objects: storage.ownAll(result.Objects), NextContinuationToken: storage.relativeToken(result.NextContinuationToken)}, nil
+}
+
+// relativeToken make continuation tokens that are paths of the wrapped storage, e.g. of Paginate, relative to Prefix,
+// opaque tokens are kept, those starting with a slash are escaped with another one, so fullToken could tell them apart
+func (storage *PrefixStorage) relativeToken(token string) string {
+	if storage.Prefix == "" || !strings.HasPrefix(token, "/") {
+		return token
+	}
+	if path, ok := storage.relativePath(token); ok {
+		return path
+	}
+	return "/" + token
+}
+
+// fullToken revert relativeToken
+func (storage *PrefixStorage) fullToken(token string) string {
+	switch {
+	case storage.Prefix == "" || !strings.HasPrefix(token, "/"):
+		return token
+	case strings.HasPrefix(token, "//"):
+		return token[1:]
+	case token == "/":
+		return storage.Prefix
+	}
+	return storage.Prefix + token
+}
+
+// Stat get object's metadata
+func (storage *PrefixStorage) Stat(path string) (*Object, error) {
+	return storage.StatWithContext(context.Background(), path)
+}
+
+// StatWithContext get object's metadata
+func (storage *PrefixStorage) StatWithContext(ctx context.Context, path string) (*Object, error) {
+	fullpath, err := storage.FullPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := WithContext(storage.Storage).StatWithContext(ctx, fullpath)
+	return storage.own(object), storage.wrapError(err)
+}
+
+// GetRange get length bytes of the object starting at offset, see GetRange
+func (storage *PrefixStorage) GetRange(path string, offset, length int64) (io.ReadCloser, error) {
+	fullpath, err := storage.FullPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := GetRange(storage.Storage, fullpath, offset, length)
+	return stream, storage.wrapError(err)
+}
+
+// OpenReaderAt open a random access reader of the object, see OpenReaderAt
+func (storage *PrefixStorage) OpenReaderAt(path string) (ObjectReader, error) {
+	fullpath, err := storage.FullPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := OpenReaderAt(storage.Storage, fullpath)
+	return reader, storage.wrapError(err)
+}
+
+// Copy copy object src to dst, see Copy
+func (storage *PrefixStorage) Copy(src, dst string) (*Object, error) {
+	fullSrc, fullDst, err := storage.fullPaths(src, dst)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := Copy(storage.Storage, fullSrc, fullDst)
+	return storage.own(object), storage.wrapError(err)
+}
+
+// Move move object src to dst, see Move
+func (storage *PrefixStorage) Move(src, dst string) (*Object, error) {
+	fullSrc, fullDst, err := storage.fullPaths(src, dst)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := Move(storage.Storage, fullSrc, fullDst)
+	return storage.own(object), storage.wrapError(err)
+}
+
+func (storage *PrefixStorage) fullPaths(src, dst string) (string, string, error) {
+	fullSrc, err := storage.FullPath(src)
+	if err != nil {
+		return "", "", err
+	}
+	fullDst, err := storage.FullPath(dst)
+	return fullSrc, fullDst, err
+}
+
+// CopyFrom copy srcPath of src server side if the wrapped storage implements CrossCopier, return ErrUnsupported otherwise,
+// src could be a PrefixStorage too, e.g. to copy objects between tenants of one bucket
+func (storage *PrefixStorage) CopyFrom(ctx context.Context, src StorageInterface, srcPath, dstPath string) (*Object, error) {
+	copier, ok := storage.Storage.(CrossCopier)
+	if !ok {
+		return nil, NewError("copy", dstPath, ErrUnsupported, nil)
+	}
+
+	fullDst, err := storage.FullPath(dstPath)
+	if err != nil {
+		return nil, err
+	}
+	if prefixed, ok := src.(*PrefixStorage); ok {
+		if srcPath, err = prefixed.FullPath(srcPath); err != nil {
+			return nil, err
+		}
+		src = prefixed.Storage
+	}
+
+	object, err := copier.CopyFrom(ctx, src, srcPath, fullDst)
+	return storage.own(object), storage.wrapError(err)
+}
+
+// ResumableUploads return storage as ResumableUploader if the wrapped storage supports resumable uploads, see AsResumableUploader
+func (storage *PrefixStorage) ResumableUploads() (ResumableUploader, bool) {
+	if _, ok := AsResumableUploader(storage.Storage); !ok {
+		return nil, false
+	}
+	return storage, true
+}
+
+// uploader return the resumable uploads of the wrapped storage, or ErrUnsupported if it has none
+func (storage *PrefixStorage) uploader(op, path string) (ResumableUploader, string, error) {
+	uploader, ok := AsResumableUploader(storage.Storage)
+	if !ok {
+		return nil, "", NewError(op, path, ErrUnsupported, nil)
+	}
+	fullpath, err := storage.FullPath(path)
+	return uploader, fullpath, err
+}
+
+// CreateUpload start a resumable upload of path if the wrapped storage implements ResumableUploader, return ErrUnsupported otherwise
+func (storage *PrefixStorage) CreateUpload(ctx context.Context, path string, options *PutOptions) (string, error) {
+	uploader, fullpath, err := storage.uploader("create upload", path)
+	if err != nil {
+		return "", err
+	}
+
+	uploadID, err := uploader.CreateUpload(ctx, fullpath, options)
+	return uploadID, storage.wrapError(err)
+}
+
+// UploadOffset return the number of bytes staged, see ResumableUploader
+func (storage *PrefixStorage) UploadOffset(ctx context.Context, path, uploadID string) (int64, error) {
+	uploader, fullpath, err := storage.uploader("upload offset", path)
+	if err != nil {
+		return 0, err
+	}
+
+	offset, err := uploader.UploadOffset(ctx, fullpath, uploadID)
+	return offset, storage.wrapError(err)
+}
+
+// WriteUpload append reader to the staged data, see ResumableUploader
+func (storage *PrefixStorage) WriteUpload(ctx context.Context, path, uploadID string, offset int64, reader io.Reader) (int64, error) {
+	uploader, fullpath, err := storage.uploader("write upload", path)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := uploader.WriteUpload(ctx, fullpath, uploadID, offset, reader)
+	return n, storage.wrapError(err)
+}
+
+// CompleteUpload store the staged data at path, see ResumableUploader
+func (storage *PrefixStorage) CompleteUpload(ctx context.Context, path, uploadID string) (*Object, error) {
+	uploader, fullpath, err := storage.uploader("complete upload", path)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := uploader.CompleteUpload(ctx, fullpath, uploadID)
+	return storage.own(object), storage.wrapError(err)
+}
+
+// AbortUpload discard the staged data, see ResumableUploader
+func (storage *PrefixStorage) AbortUpload(ctx context.Context, path, uploadID string) error {
+	uploader, fullpath, err := storage.uploader("abort upload", path)
+	if err != nil {
+		return err
+	}
+	return storage.wrapError(uploader.AbortUpload(ctx, fullpath, uploadID))
+}
+
+// GetURL get public accessible URL
+func (storage *PrefixStorage) GetURL(path string) (string, error) {
+	return storage.GetURLWithContext(context.Background(), path)
+}
+
+// GetURLWithContext get public accessible URL
+func (storage *PrefixStorage) GetURLWithContext(ctx context.Context, path string) (string, error) {
+	fullpath, err := storage.FullPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	url, err := WithContext(storage.Storage).GetURLWithContext(ctx, fullpath)
+	return url, storage.wrapError(err)
+}
+
+// GetEndpoint get endpoint of the wrapped storage
+func (storage *PrefixStorage) GetEndpoint() string {
+	return storage.Storage.GetEndpoint()
+}
@@ -0,0 +1,189 @@
+package ofs_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/MayCMF/ofs"
+	fs "github.com/MayCMF/ofs/filesystem"
+	"github.com/MayCMF/ofs/memory"
+	"github.com/MayCMF/ofs/ofstest"
+)
+
+func TestPrefixStorage(t *testing.T) {
+	storage := memory.New()
+	ofstest.TestAll(ofs.WithPrefix(storage, "tenants/1"), t)
+
+	if _, err := ofs.WithPrefix(storage, "tenants/1").Put("/a.txt", strings.NewReader("a")); err != nil {
+		t.Fatalf("Put fail %v", err)
+	}
+	if _, err := storage.Stat("/tenants/1/a.txt"); err != nil {
+		t.Errorf("objects should be stored under the prefix, but got %v", err)
+	}
+}
+
+func TestPrefixStorageResumableUpload(t *testing.T) {
+	if _, ok := ofs.AsResumableUploader(ofs.WithPrefix(memory.New(), "tenants/1")); ok {
+		t.Errorf("resumable uploads shouldn't be supported if the wrapped storage doesn't support them")
+	}
+	nested := &ofs.PrefixStorage{Storage: ofs.WithPrefix(memory.New(), "tenants"), Prefix: "/1"}
+	if _, ok := ofs.AsResumableUploader(nested); ok {
+		t.Errorf("wrappers should be probed through all wrapped storages")
+	}
+
+	var (
+		storage = fs.New(t.TempDir())
+		ctx     = context.Background()
+	)
+	ofstest.TestAll(ofs.WithPrefix(storage, "tenants/1"), t)
+
+	uploader, ok := ofs.AsResumableUploader(ofs.WithPrefix(storage, "tenants/1"))
+	if !ok {
+		t.Fatalf("resumable uploads of the wrapped storage should be forwarded")
+	}
+	uploadID, err := uploader.CreateUpload(ctx, "/upload.txt", nil)
+	if err != nil {
+		t.Fatalf("CreateUpload fail %v", err)
+	}
+	if _, err = uploader.WriteUpload(ctx, "/upload.txt", uploadID, 0, strings.NewReader("resumed")); err != nil {
+		t.Fatalf("WriteUpload fail %v", err)
+	}
+	if _, err = uploader.WriteUpload(ctx, "/upload.txt", uploadID, 0, strings.NewReader("resumed")); !errors.Is(err, ofs.ErrOffsetMismatch) {
+		t.Errorf("WriteUpload at wrong offset should fail, but got %v", err)
+	}
+
+	object, err := uploader.CompleteUpload(ctx, "/upload.txt", uploadID)
+	if err != nil || object.Path != "/upload.txt" {
+		t.Fatalf("CompleteUpload should return the object relative to the prefix, but got %+v, %v", object, err)
+	}
+	if _, err := storage.Stat("/tenants/1/upload.txt"); err != nil {
+		t.Errorf("upload should be stored under the prefix, but got %v", err)
+	}
+	if _, err := uploader.CreateUpload(ctx, "../escape.txt", nil); !errors.Is(err, ofs.ErrInvalidPath) {
+		t.Errorf("uploads shouldn't escape the prefix, but got %v", err)
+	}
+}
+
+func TestPrefixStorageIsolation(t *testing.T) {
+	storage := memory.New()
+	storage.Put("/tenants/1/a.txt", strings.NewReader("tenant 1"))
+	storage.Put("/tenants/10/secret.txt", strings.NewReader("tenant 10"))
+	storage.Put("/tenants/2/secret.txt", strings.NewReader("tenant 2"))
+
+	tenant := ofs.WithPrefix(storage, "/tenants/1/")
+	if tenant.Prefix != "/tenants/1" {
+		t.Errorf("prefix should be normalized, but got %v", tenant.Prefix)
+	}
+
+	objects, err := tenant.List("/")
+	if err != nil {
+		t.Fatalf("List fail %v", err)
+	}
+	if len(objects) != 1 || objects[0].Path != "/a.txt" {
+		t.Errorf("only objects of the prefix should be listed relative to it, but got %v", objects)
+	}
+
+	result, err := ofs.ListPage(context.Background(), tenant, "", ofs.ListOptions{Recursive: true})
+	if err != nil || len(result.Objects) != 1 || result.Objects[0].Path != "/a.txt" {
+		t.Errorf("ListPage should list objects relative to the prefix, but got %v %v", result, err)
+	}
+
+	if object, err := tenant.Stat("a.txt"); err != nil || object.Path != "/a.txt" || object.StorageInterface != tenant {
+		t.Errorf("Stat should return objects relative to the prefix, but got %v %v", object, err)
+	}
+
+	for _, path := range []string{"../2/secret.txt", "/../10/secret.txt", "a/../../2/secret.txt", `..\2\secret.txt`, "a\x00"} {
+		_, err := tenant.GetStream(path)
+		if !errors.Is(err, ofs.ErrInvalidPath) {
+			t.Errorf("%q should be refused, but got %v", path, err)
+		}
+		if _, err := tenant.Put(path, strings.NewReader("escaped")); !errors.Is(err, ofs.ErrInvalidPath) {
+			t.Errorf("Put %q should be refused, but got %v", path, err)
+		}
+	}
+
+	// `..` inside the prefix is fine
+	stream, err := tenant.GetStream("dir/../a.txt")
+	if err != nil {
+		t.Fatalf("GetStream fail %v", err)
+	}
+	content, _ := ioutil.ReadAll(stream)
+	stream.Close()
+	if string(content) != "tenant 1" {
+		t.Errorf("content should be read from the prefix, but got %q", content)
+	}
+
+	if _, err := tenant.Stat("missing.txt"); !errors.Is(err, ofs.ErrNotFound) || strings.Contains(err.Error(), "tenants") {
+		t.Errorf("errors should be relative to the prefix, but got %v", err)
+	}
+
+	if err := tenant.Delete("/"); !errors.Is(err, ofs.ErrInvalidPath) {
+		t.Errorf("prefix shouldn't be deletable, but got %v", err)
+	}
+
+	if url, _ := tenant.GetURL("a.txt"); url != "memory://tenants/1/a.txt" {
+		t.Errorf("URL should point to the full path, but got %v", url)
+	}
+
+	nested := ofs.WithPrefix(tenant, "photos")
+	if nested.Prefix != "/tenants/1/photos" || nested.Storage != ofs.StorageInterface(storage) {
+		t.Errorf("nested prefixes should be flattened, but got %v", nested.Prefix)
+	}
+}
+
+// opaqueTokenStorage list one object per page with opaque continuation tokens starting with a slash, like those of S3 could
+type opaqueTokenStorage struct {
+	ofs.StorageInterface
+}
+
+func (storage *opaqueTokenStorage) ListPage(ctx context.Context, path string, options ofs.ListOptions) (*ofs.ListResult, error) {
+	if options.ContinuationToken == "/opaque" {
+		return &ofs.ListResult{Objects: []*ofs.Object{{Path: "/tenants/1/b.txt"}}}, nil
+	}
+	if options.ContinuationToken != "" {
+		return nil, ofs.NewError("list", path, ofs.ErrInvalidPath, errors.New("unknown token "+options.ContinuationToken))
+	}
+	return &ofs.ListResult{Objects: []*ofs.Object{{Path: "/tenants/1/a.txt"}}, NextContinuationToken: "/opaque"}, nil
+}
+
+func TestPrefixStorageListPageTokens(t *testing.T) {
+	storage := memory.New()
+	tenant := ofs.WithPrefix(storage, "/tenants/1")
+	for _, path := range []string{"/a.txt", "/b.txt", "/c.txt"} {
+		tenant.Put(path, strings.NewReader(path))
+	}
+
+	var paths []string
+	options := ofs.ListOptions{Recursive: true, MaxKeys: 1}
+	for {
+		result, err := tenant.ListPage(context.Background(), "", options)
+		if err != nil {
+			t.Fatalf("ListPage fail %v", err)
+		}
+		for _, object := range result.Objects {
+			paths = append(paths, object.Path)
+		}
+		if strings.Contains(result.NextContinuationToken, "tenants") {
+			t.Errorf("continuation tokens shouldn't expose the prefix, but got %v", result.NextContinuationToken)
+		}
+		if result.NextContinuationToken == "" {
+			break
+		}
+		options.ContinuationToken = result.NextContinuationToken
+	}
+	if strings.Join(paths, ",") != "/a.txt,/b.txt,/c.txt" {
+		t.Errorf("pages should list all objects once, but got %v", paths)
+	}
+
+	opaque := ofs.WithPrefix(&opaqueTokenStorage{StorageInterface: storage}, "/tenants/1")
+	result, err := opaque.ListPage(context.Background(), "", ofs.ListOptions{})
+	if err == nil {
+		result, err = opaque.ListPage(context.Background(), "", ofs.ListOptions{ContinuationToken: result.NextContinuationToken})
+	}
+	if err != nil || len(result.Objects) != 1 || result.Objects[0].Path != "/b.txt" {
+		t.Errorf("opaque continuation tokens should be kept, but got %v %v", result, err)
+	}
+}
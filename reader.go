@@ -0,0 +1,116 @@
+package ofs
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// ObjectReader random access reader of an object
+type ObjectReader interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+	Size() int64
+}
+
+// RangeReader implemented by storages that could read part of an object without fetching all of it
+type RangeReader interface {
+	// GetRange get length bytes of the object starting at offset, or till the end if length is negative
+	GetRange(path string, offset, length int64) (io.ReadCloser, error)
+	OpenReaderAt(path string) (ObjectReader, error)
+}
+
+// GetRange get length bytes of the object starting at offset, or till the end if length is negative,
+// storages that don't implement RangeReader are read with GetStream, skipping bytes before offset
+func GetRange(storage StorageInterface, path string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 {
+		return nil, NewError("get range", path, ErrInvalidPath, fmt.Errorf("negative offset %d", offset))
+	}
+
+	if reader, ok := storage.(RangeReader); ok {
+		return reader.GetRange(path, offset, length)
+	}
+
+	stream, err := storage.GetStream(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = io.CopyN(ioutil.Discard, stream, offset); err != nil && err != io.EOF {
+		stream.Close()
+		return nil, err
+	}
+	return LimitReadCloser(stream, length), nil
+}
+
+// OpenReaderAt open a random access reader of the object, storages that don't implement RangeReader are copied into a TempFile
+func OpenReaderAt(storage StorageInterface, path string) (ObjectReader, error) {
+	if reader, ok := storage.(RangeReader); ok {
+		return reader.OpenReaderAt(path)
+	}
+
+	stream, err := storage.GetStream(path)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	file, err := TempFile(stream, "ofs-reader-*")
+	if err != nil {
+		return nil, err
+	}
+	return NewFileReader(file)
+}
+
+// NewFileReader return file as ObjectReader
+func NewFileReader(file *os.File) (ObjectReader, error) {
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &fileReader{File: file, size: info.Size()}, nil
+}
+
+type fileReader struct {
+	*os.File
+	size int64
+}
+
+func (reader *fileReader) Size() int64 {
+	return reader.size
+}
+
+// TempFile copy reader into a temporary file, e.g. for Get of storages that don't keep objects as files,
+// the file is unlinked right away, so it is removed once closed, on platforms that can't unlink open files callers have to remove it
+func TempFile(reader io.Reader, pattern string) (*os.File, error) {
+	file, err := ioutil.TempFile("", pattern)
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(file.Name())
+
+	if _, err = io.Copy(file, reader); err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
+
+// LimitReadCloser return a ReadCloser that reads at most n bytes from reader, or everything if n is negative, and closes reader
+func LimitReadCloser(reader io.ReadCloser, n int64) io.ReadCloser {
+	if n < 0 {
+		return reader
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(reader, n), reader}
+}
@@ -0,0 +1,30 @@
+package ofs_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/MayCMF/ofs"
+	"github.com/MayCMF/ofs/memory"
+)
+
+func TestGetRangeFallback(t *testing.T) {
+	storage := plainStorage{memory.New()}
+	storage.Put("/range.txt", strings.NewReader("0123456789"))
+
+	stream, err := ofs.GetRange(storage, "/range.txt", 2, 3)
+	if err != nil {
+		t.Fatalf("GetRange fail %v", err)
+	}
+	data, _ := ioutil.ReadAll(stream)
+	stream.Close()
+	if string(data) != "234" {
+		t.Errorf("range should be read from the stream, but got %q", data)
+	}
+
+	if _, err := ofs.GetRange(storage, "/range.txt", -2, 3); !errors.Is(err, ofs.ErrInvalidPath) {
+		t.Errorf("range with a negative offset should fail with ofs.ErrInvalidPath, but got %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package ofs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrReadOnly returned by writes into read-only storages, the returned errors are of kind ErrPermission too
+var ErrReadOnly = errors.New("ofs: read-only storage")
+
+// ReadOnlyStorage wrap a storage so it can't be mutated, Put, Delete, copies, moves and uploads return an ErrPermission error wrapping ErrReadOnly,
+// reads, List and GetURL pass through, the wrapped storage is unexported and returned objects point to the wrapper, so it can't be unwrapped
+type ReadOnlyStorage struct {
+	storage StorageInterface
+}
+
+// ReadOnly return storage as ReadOnlyStorage
+func ReadOnly(storage StorageInterface) *ReadOnlyStorage {
+	if readOnly, ok := storage.(*ReadOnlyStorage); ok {
+		return readOnly
+	}
+	return &ReadOnlyStorage{storage: storage}
+}
+
+func readOnlyError(op, path string) error {
+	return NewError(op, path, ErrPermission, ErrReadOnly)
+}
+
+// own return a copy of object pointing to the wrapper
+func (storage *ReadOnlyStorage) own(object *Object) *Object {
+	if object == nil {
+		return nil
+	}
+
+	owned := *object
+	owned.StorageInterface = storage
+	return &owned
+}
+
+// Get receive file with given path
+func (storage *ReadOnlyStorage) Get(path string) (*os.File, error) {
+	return storage.storage.Get(path)
+}
+
+// GetWithContext receive file with given path
+func (storage *ReadOnlyStorage) GetWithContext(ctx context.Context, path string) (*os.File, error) {
+	return WithContext(storage.storage).GetWithContext(ctx, path)
+}
+
+// GetStream get file as stream
+func (storage *ReadOnlyStorage) GetStream(path string) (io.ReadCloser, error) {
+	return storage.storage.GetStream(path)
+}
+
+// GetStreamWithContext get file as stream
+func (storage *ReadOnlyStorage) GetStreamWithContext(ctx context.Context, path string) (io.ReadCloser, error) {
+	return WithContext(storage.storage).GetStreamWithContext(ctx, path)
+}
+
+// GetRange get length bytes of the object starting at offset, see GetRange
+func (storage *ReadOnlyStorage) GetRange(path string, offset, length int64) (io.ReadCloser, error) {
+	return GetRange(storage.storage, path, offset, length)
+}
+
+// OpenReaderAt open a random access reader of the object, see OpenReaderAt
+func (storage *ReadOnlyStorage) OpenReaderAt(path string) (ObjectReader, error) {
+	return OpenReaderAt(storage.storage, path)
+}
+
+// Put return ErrReadOnly
+func (storage *ReadOnlyStorage) Put(path string, reader io.Reader) (*Object, error) {
+	return nil, readOnlyError("put", path)
+}
+
+// PutWithContext return ErrReadOnly
+func (storage *ReadOnlyStorage) PutWithContext(ctx context.Context, path string, reader io.Reader) (*Object, error) {
+	return nil, readOnlyError("put", path)
+}
+
+// PutWithOptions return ErrReadOnly
+func (storage *ReadOnlyStorage) PutWithOptions(ctx context.Context, path string, reader io.Reader, options *PutOptions) (*Object, error) {
+	return nil, readOnlyError("put", path)
+}
+
+// OpenWriter return ErrReadOnly
+func (storage *ReadOnlyStorage) OpenWriter(path string, options *PutOptions) (Writer, error) {
+	return nil, readOnlyError("open writer", path)
+}
+
+// Delete return ErrReadOnly
+func (storage *ReadOnlyStorage) Delete(path string) error {
+	return readOnlyError("delete", path)
+}
+
+// DeleteWithContext return ErrReadOnly
+func (storage *ReadOnlyStorage) DeleteWithContext(ctx context.Context, path string) error {
+	return readOnlyError("delete", path)
+}
+
+// Copy return ErrReadOnly
+func (storage *ReadOnlyStorage) Copy(src, dst string) (*Object, error) {
+	return nil, readOnlyError("copy", dst)
+}
+
+// Move return ErrReadOnly
+func (storage *ReadOnlyStorage) Move(src, dst string) (*Object, error) {
+	return nil, readOnlyError("move", src)
+}
+
+// CopyFrom return ErrReadOnly, so Transfer into the storage fails instead of falling back to Put
+func (storage *ReadOnlyStorage) CopyFrom(ctx context.Context, src StorageInterface, srcPath, dstPath string) (*Object, error) {
+	return nil, readOnlyError("copy", dstPath)
+}
+
+// CreateUpload return ErrReadOnly
+func (storage *ReadOnlyStorage) CreateUpload(ctx context.Context, path string, options *PutOptions) (string, error) {
+	return "", readOnlyError("create upload", path)
+}
+
+// UploadOffset return ErrReadOnly
+func (storage *ReadOnlyStorage) UploadOffset(ctx context.Context, path, uploadID string) (int64, error) {
+	return 0, readOnlyError("upload offset", path)
+}
+
+// WriteUpload return ErrReadOnly
+func (storage *ReadOnlyStorage) WriteUpload(ctx context.Context, path, uploadID string, offset int64, reader io.Reader) (int64, error) {
+	return 0, readOnlyError("write upload", path)
+}
+
+// CompleteUpload return ErrReadOnly
+func (storage *ReadOnlyStorage) CompleteUpload(ctx context.Context, path, uploadID string) (*Object, error) {
+	return nil, readOnlyError("complete upload", path)
+}
+
+// AbortUpload return ErrReadOnly
+func (storage *ReadOnlyStorage) AbortUpload(ctx context.Context, path, uploadID string) error {
+	return readOnlyError("abort upload", path)
+}
+
+// List list all objects under current path
+func (storage *ReadOnlyStorage) List(path string) ([]*Object, error) {
+	return storage.ListWithContext(context.Background(), path)
+}
+
+// ListWithContext list all objects under current path
+func (storage *ReadOnlyStorage) ListWithContext(ctx context.Context, path string) ([]*Object, error) {
+	objects, err := WithContext(storage.storage).ListWithContext(ctx, path)
+	for i, object := range objects {
+		objects[i] = storage.own(object)
+	}
+	return objects, err
+}
+
+// ListPage list one page of entries under path, see ListPage
+func (storage *ReadOnlyStorage) ListPage(ctx context.Context, path string, options ListOptions) (*ListResult, error) {
+	result, err := ListPage(ctx, storage.storage, path, options)
+	if err != nil {
+		return nil, err
+	}
+
+	owned := &ListResult{Objects: make([]*Object, len(result.Objects)), NextContinuationToken: result.NextContinuationToken}
+	for i, object := range result.Objects {
+		owned.Objects[i] = storage.own(object)
+	}
+	return owned, nil
+}
+
+// Stat get object's metadata
+func (storage *ReadOnlyStorage) Stat(path string) (*Object, error) {
+	return storage.StatWithContext(context.Background(), path)
+}
+
+// StatWithContext get object's metadata
+func (storage *ReadOnlyStorage) StatWithContext(ctx context.Context, path string) (*Object, error) {
+	object, err := WithContext(storage.storage).StatWithContext(ctx, path)
+	return storage.own(object), err
+}
+
+// GetURL get public accessible URL
+func (storage *ReadOnlyStorage) GetURL(path string) (string, error) {
+	return storage.storage.GetURL(path)
+}
+
+// GetURLWithContext get public accessible URL
+func (storage *ReadOnlyStorage) GetURLWithContext(ctx context.Context, path string) (string, error) {
+	return WithContext(storage.storage).GetURLWithContext(ctx, path)
+}
+
+// GetEndpoint get endpoint of the wrapped storage
+func (storage *ReadOnlyStorage) GetEndpoint() string {
+	return storage.storage.GetEndpoint()
+}
@@ -0,0 +1,87 @@
+package ofs_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/MayCMF/ofs"
+	"github.com/MayCMF/ofs/memory"
+)
+
+func TestReadOnly(t *testing.T) {
+	storage := memory.New()
+	storage.Put("/docs/a.txt", strings.NewReader("0123456789"))
+	readOnly := ofs.ReadOnly(storage)
+
+	stream, err := readOnly.GetStream("/docs/a.txt")
+	if err != nil {
+		t.Fatalf("GetStream fail %v", err)
+	}
+	content, _ := ioutil.ReadAll(stream)
+	stream.Close()
+	if string(content) != "0123456789" {
+		t.Errorf("content should be read through, but got %q", content)
+	}
+
+	if rangeStream, err := ofs.GetRange(readOnly, "/docs/a.txt", 2, 3); err != nil {
+		t.Errorf("GetRange fail %v", err)
+	} else if content, _ := ioutil.ReadAll(rangeStream); string(content) != "234" {
+		t.Errorf("range should be read through, but got %q", content)
+	}
+
+	objects, err := readOnly.List("/docs")
+	if err != nil || len(objects) != 1 {
+		t.Fatalf("List should pass through, but got %v %v", objects, err)
+	}
+	if objects[0].StorageInterface != readOnly {
+		t.Errorf("listed objects shouldn't expose the writable storage")
+	}
+	if object, err := readOnly.Stat("/docs/a.txt"); err != nil || object.StorageInterface != readOnly {
+		t.Errorf("Stat should pass through without exposing the writable storage, but got %v %v", object, err)
+	}
+	if url, err := readOnly.GetURL("/docs/a.txt"); err != nil || url != "memory://docs/a.txt" {
+		t.Errorf("GetURL should pass through, but got %v %v", url, err)
+	}
+
+	ctx := context.Background()
+	for name, write := range map[string]func() error{
+		"Put": func() error { _, err := readOnly.Put("/b.txt", strings.NewReader("b")); return err },
+		"PutWithOptions": func() error {
+			_, err := ofs.PutWithOptions(ctx, readOnly, "/b.txt", strings.NewReader("b"), &ofs.PutOptions{ContentType: "text/plain"})
+			return err
+		},
+		"OpenWriter": func() error { _, err := ofs.OpenWriter(readOnly, "/b.txt", nil); return err },
+		"Delete":     func() error { return readOnly.Delete("/docs/a.txt") },
+		"Copy":       func() error { _, err := ofs.Copy(readOnly, "/docs/a.txt", "/b.txt"); return err },
+		"Move":       func() error { _, err := ofs.Move(readOnly, "/docs/a.txt", "/b.txt"); return err },
+		"CreateUpload": func() error {
+			_, err := readOnly.CreateUpload(ctx, "/b.txt", nil)
+			return err
+		},
+		"Transfer": func() error {
+			src := memory.New()
+			src.Put("/c.txt", strings.NewReader("c"))
+			report, err := ofs.Transfer(ctx, src, readOnly, "/", "/", nil)
+			if err != nil {
+				return err
+			}
+			return report.Failed["/c.txt"]
+		},
+	} {
+		err := write()
+		if !errors.Is(err, ofs.ErrPermission) || !errors.Is(err, ofs.ErrReadOnly) {
+			t.Errorf("%v should fail with ErrReadOnly, but got %v", name, err)
+		}
+	}
+
+	if objects, _ := storage.List("/"); len(objects) != 1 {
+		t.Errorf("storage shouldn't be changed, but got %v", objects)
+	}
+
+	if ofs.ReadOnly(readOnly) != readOnly {
+		t.Errorf("read-only storages shouldn't be wrapped twice")
+	}
+}
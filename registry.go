@@ -0,0 +1,207 @@
+package ofs
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidConfig returned by Open when the storage URL can't be turned into a storage
+var ErrInvalidConfig = errors.New("ofs: invalid storage config")
+
+// Opener build a storage from its URL, backends register openers of their schemes with Register
+type Opener func(u *url.URL) (StorageInterface, error)
+
+var (
+	openersMutex sync.RWMutex
+	openers      = map[string]Opener{}
+)
+
+// Register make a storage available by scheme for Open, backends usually register themselves in init, so importing them is enough, e.g.
+//
+//	import _ "github.com/MayCMF/ofs/awss3"
+//
+// it panics if scheme is registered twice or opener is nil
+func Register(scheme string, opener Opener) {
+	openersMutex.Lock()
+	defer openersMutex.Unlock()
+
+	scheme = strings.ToLower(scheme)
+	if opener == nil {
+		panic("ofs: Register opener is nil")
+	}
+	if _, dup := openers[scheme]; dup {
+		panic("ofs: Register called twice for scheme " + scheme)
+	}
+	openers[scheme] = opener
+}
+
+// Schemes return the sorted registered schemes
+func Schemes() []string {
+	openersMutex.RLock()
+	defer openersMutex.RUnlock()
+
+	schemes := make([]string, 0, len(openers))
+	for scheme := range openers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Open open a storage from a URL like `s3://bucket?region=eu-west-1&acl=private` or `file:///var/uploads`,
+// query parameters are mapped onto the backend's options, see the openers of the backends for their parameters,
+// invalid URLs, unknown schemes and invalid or unknown parameters are returned as ErrInvalidConfig
+func Open(rawURL string) (StorageInterface, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, NewError("open", "", ErrInvalidConfig, err)
+	}
+	if u.Scheme == "" {
+		return nil, NewError("open", redactURL(u), ErrInvalidConfig, errors.New("missing scheme"))
+	}
+
+	openersMutex.RLock()
+	opener, ok := openers[strings.ToLower(u.Scheme)]
+	openersMutex.RUnlock()
+	if !ok {
+		return nil, NewError("open", redactURL(u), ErrInvalidConfig,
+			fmt.Errorf("unknown scheme %q (registered: %v), forgotten to import the backend?", u.Scheme, strings.Join(Schemes(), ", ")))
+	}
+
+	storage, err := opener(u)
+	if err != nil {
+		if errors.As(err, new(*Error)) {
+			return nil, err
+		}
+		return nil, NewError("open", redactURL(u), ErrInvalidConfig, err)
+	}
+	return storage, nil
+}
+
+// redactURL URL without credentials and query parameters, which may contain secrets
+func redactURL(u *url.URL) string {
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path, Opaque: u.Opaque}).String()
+}
+
+// URLParams query parameters of a storage URL for openers, read them with the typed getters,
+// then check Err, which reports invalid values and parameters that were never read
+type URLParams struct {
+	values url.Values
+	read   map[string]bool
+	errs   []string
+}
+
+// NewURLParams initialize URLParams of u's query
+func NewURLParams(u *url.URL) *URLParams {
+	return &URLParams{values: u.Query(), read: map[string]bool{}}
+}
+
+func (params *URLParams) invalid(name, format string, args ...interface{}) {
+	params.errs = append(params.errs, fmt.Sprintf("parameter %q: ", name)+fmt.Sprintf(format, args...))
+}
+
+// String return parameter name, or "" if it isn't set
+func (params *URLParams) String(name string) string {
+	params.read[name] = true
+
+	values := params.values[name]
+	if len(values) > 1 {
+		params.invalid(name, "given %d times", len(values))
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// OneOf return parameter name, which must be one of allowed, or "" if it isn't set
+func (params *URLParams) OneOf(name string, allowed ...string) string {
+	value := params.String(name)
+	if value == "" {
+		return ""
+	}
+
+	for _, a := range allowed {
+		if value == a {
+			return value
+		}
+	}
+	params.invalid(name, "%q isn't one of %v", value, strings.Join(allowed, ", "))
+	return ""
+}
+
+// Bool return parameter name parsed with strconv.ParseBool, a parameter without value like `?path_style` is true
+func (params *URLParams) Bool(name string) bool {
+	if _, ok := params.values[name]; ok && params.values.Get(name) == "" {
+		params.String(name)
+		return true
+	}
+
+	value := params.String(name)
+	if value == "" {
+		return false
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		params.invalid(name, "%q isn't a boolean", value)
+	}
+	return b
+}
+
+// Int64 return parameter name as a non-negative integer, or 0 if it isn't set
+func (params *URLParams) Int64(name string) int64 {
+	value := params.String(name)
+	if value == "" {
+		return 0
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		params.invalid(name, "%q isn't a non-negative integer", value)
+		return 0
+	}
+	return n
+}
+
+// Duration return parameter name parsed with time.ParseDuration, or 0 if it isn't set
+func (params *URLParams) Duration(name string) time.Duration {
+	value := params.String(name)
+	if value == "" {
+		return 0
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		params.invalid(name, "%q isn't a non-negative duration", value)
+		return 0
+	}
+	return duration
+}
+
+// Err return the invalid values and the unknown parameters, i.e. parameters that haven't been read, or nil
+func (params *URLParams) Err() error {
+	errs := params.errs
+
+	var unknown []string
+	for name := range params.values {
+		if !params.read[name] {
+			unknown = append(unknown, strconv.Quote(name))
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		errs = append(errs, "unknown parameters "+strings.Join(unknown, ", "))
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(errs, "; "))
+}
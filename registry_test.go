@@ -0,0 +1,86 @@
+package ofs_test
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MayCMF/ofs"
+	"github.com/MayCMF/ofs/memory"
+)
+
+func TestOpen(t *testing.T) {
+	storage, err := ofs.Open("memory://?latency=5ms&endpoint=https://cdn.example.com")
+	if err != nil {
+		t.Fatalf("Open fail %v", err)
+	}
+	if mem, ok := storage.(*memory.Storage); !ok || mem.Latency != 5*time.Millisecond || mem.Endpoint != "https://cdn.example.com" {
+		t.Errorf("parameters should be mapped onto the storage, but got %#v", storage)
+	}
+
+	for rawURL, want := range map[string]string{
+		"unknown://bucket":                 `unknown scheme "unknown"`,
+		"/var/uploads":                     "missing scheme",
+		"memory://?latency=soon":           `parameter "latency": "soon" isn't a non-negative duration`,
+		"memory://?endpoint=a&endpoint=b":  `parameter "endpoint": given 2 times`,
+		"memory://?secret=1&region=eu":     `unknown parameters "region", "secret"`,
+		"memory://?latency=-1s&typo=value": `isn't a non-negative duration; unknown parameters "typo"`,
+	} {
+		_, err := ofs.Open(rawURL)
+		if !errors.Is(err, ofs.ErrInvalidConfig) {
+			t.Errorf("Open(%q) should fail with ErrInvalidConfig, but got %v", rawURL, err)
+		} else if !strings.Contains(err.Error(), want) {
+			t.Errorf("Open(%q) error should mention %q, but got %v", rawURL, want, err)
+		} else if strings.Contains(err.Error(), "secret=") {
+			t.Errorf("error shouldn't contain query parameters, but got %v", err)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	var opened *url.URL
+	ofs.Register("Test-Scheme", func(u *url.URL) (ofs.StorageInterface, error) {
+		opened = u
+		return memory.New(), nil
+	})
+
+	if _, err := ofs.Open("test-scheme://host/path"); err != nil || opened == nil || opened.Host != "host" {
+		t.Errorf("registered opener should be called, but got %v %v", opened, err)
+	}
+
+	found := false
+	for _, scheme := range ofs.Schemes() {
+		found = found || scheme == "test-scheme"
+	}
+	if !found {
+		t.Errorf("Schemes should include registered schemes, but got %v", ofs.Schemes())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("registering a scheme twice should panic")
+		}
+	}()
+	ofs.Register("test-scheme", func(u *url.URL) (ofs.StorageInterface, error) { return nil, nil })
+}
+
+func TestURLParams(t *testing.T) {
+	u, _ := url.Parse("x://?flag&enabled=false&size=10&mode=b")
+	params := ofs.NewURLParams(u)
+
+	if !params.Bool("flag") || params.Bool("enabled") || params.Bool("missing") {
+		t.Errorf("Bool should parse booleans")
+	}
+	if params.Int64("size") != 10 || params.OneOf("mode", "a", "b") != "b" {
+		t.Errorf("typed getters should parse values")
+	}
+	if err := params.Err(); err != nil {
+		t.Errorf("all parameters are read and valid, but got %v", err)
+	}
+
+	if params.OneOf("mode", "a"); params.Err() == nil || !strings.Contains(params.Err().Error(), `"b" isn't one of a`) {
+		t.Errorf("OneOf should reject other values, but got %v", params.Err())
+	}
+}
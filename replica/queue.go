@@ -0,0 +1,251 @@
+package replica
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/MayCMF/ofs"
+)
+
+// task queued replication of path to replica
+type task struct {
+	// op `put` copies the object from replica source, `delete` deletes it
+	op       string
+	path     string
+	replica  int
+	source   int
+	attempts int
+	// notBefore time of the next attempt
+	notBefore time.Time
+}
+
+func (storage *Storage) queuePut(path string) func(replica, source int) {
+	return func(replica, source int) {
+		storage.enqueue(&task{op: "put", path: path, replica: replica, source: source})
+	}
+}
+
+func (storage *Storage) queueDelete(path string) func(replica, source int) {
+	return func(replica, source int) {
+		storage.enqueue(&task{op: "delete", path: path, replica: replica, source: source})
+	}
+}
+
+// enqueue queue t, the worker is started with the first task, and exits once the queue is empty again
+func (storage *Storage) enqueue(t *task) {
+	storage.mutex.Lock()
+
+	if storage.closed {
+		storage.mutex.Unlock()
+		storage.reportError(t.replica, t.op, t.path, errClosed)
+		return
+	}
+
+	if storage.pending == 0 {
+		storage.idle = make(chan struct{})
+	}
+	storage.pending++
+	storage.queue = append(storage.queue, t)
+
+	if !storage.running {
+		storage.running = true
+		storage.wake = make(chan struct{}, 1)
+		storage.stop = make(chan struct{})
+		storage.done = make(chan struct{})
+		go storage.work(storage.wake, storage.stop, storage.done)
+	}
+	wake := storage.wake
+	storage.mutex.Unlock()
+
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+var errClosed = errors.New("replica: storage closed, replication dropped")
+
+// work run queued tasks one by one until the queue is empty or the storage is closed
+func (storage *Storage) work(wake, stop, done chan struct{}) {
+	defer close(done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		t, wait := storage.next()
+		if t == nil && wait < 0 {
+			return
+		}
+		if t == nil {
+			var (
+				timer   *time.Timer
+				timeout <-chan time.Time
+			)
+			if wait >= 0 {
+				timer = time.NewTimer(wait)
+				timeout = timer.C
+			}
+
+			select {
+			case <-wake:
+			case <-timeout:
+			case <-stop:
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+			continue
+		}
+
+		storage.finish(t, storage.replicate(ctx, t))
+	}
+}
+
+// next take the first task that is due from the queue, or return how long to wait for it,
+// -1 if the queue is empty, the worker is marked as stopped then
+func (storage *Storage) next() (*task, time.Duration) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	var (
+		now  = time.Now()
+		wait = time.Duration(-1)
+	)
+
+	if len(storage.queue) == 0 {
+		storage.running = false
+		return nil, wait
+	}
+
+	for i, t := range storage.queue {
+		if !t.notBefore.After(now) {
+			storage.queue = append(storage.queue[:i], storage.queue[i+1:]...)
+			return t, 0
+		}
+		if d := t.notBefore.Sub(now); wait < 0 || d < wait {
+			wait = d
+		}
+	}
+	return nil, wait
+}
+
+// finish requeue t if it failed with exponential backoff, or give it up after MaxRetries attempts
+func (storage *Storage) finish(t *task, err error) {
+	storage.mutex.Lock()
+
+	if err != nil && !storage.closed {
+		t.attempts++
+		if t.attempts < storage.maxRetries() {
+			t.notBefore = time.Now().Add(storage.retryDelay() << uint(t.attempts-1))
+			storage.queue = append(storage.queue, t)
+			storage.mutex.Unlock()
+			return
+		}
+	}
+
+	storage.pending--
+	if storage.pending == 0 {
+		close(storage.idle)
+	}
+	storage.mutex.Unlock()
+
+	if err != nil {
+		storage.reportError(t.replica, t.op, t.path, err)
+	}
+}
+
+// replicate run t, objects are copied from replica source with ofs.Transfer
+func (storage *Storage) replicate(ctx context.Context, t *task) error {
+	replica := storage.Replicas[t.replica]
+
+	if t.op == "delete" {
+		if err := ofs.WithContext(replica).DeleteWithContext(ctx, t.path); err != nil && !errors.Is(err, ofs.ErrNotFound) {
+			return err
+		}
+		return nil
+	}
+
+	report, err := ofs.Transfer(ctx, storage.Replicas[t.source], replica, "/", "/", &ofs.TransferOptions{Paths: []string{t.path}})
+	if err != nil {
+		return err
+	}
+	// the object has been deleted or moved since, which is replicated by its own task
+	if err = report.Failed[t.path]; errors.Is(err, ofs.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Pending return the number of queued replications, including the running one
+func (storage *Storage) Pending() int {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	return storage.pending
+}
+
+// Flush wait until all queued replications have succeeded or been given up
+func (storage *Storage) Flush(ctx context.Context) error {
+	storage.mutex.Lock()
+	if storage.pending == 0 {
+		storage.mutex.Unlock()
+		return nil
+	}
+	idle := storage.idle
+	storage.mutex.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stop the retry queue, queued replications are dropped and reported to OnError, call Flush before to wait for them,
+// writes after Close don't queue replications anymore
+func (storage *Storage) Close() error {
+	storage.mutex.Lock()
+	if storage.closed {
+		storage.mutex.Unlock()
+		return nil
+	}
+	storage.closed = true
+	running := storage.running
+	if running {
+		close(storage.stop)
+	}
+	storage.mutex.Unlock()
+
+	if running {
+		<-storage.done
+	}
+
+	storage.mutex.Lock()
+	dropped := storage.queue
+	storage.queue = nil
+	if storage.pending > 0 {
+		storage.pending = 0
+		close(storage.idle)
+	}
+	storage.mutex.Unlock()
+
+	for _, t := range dropped {
+		storage.reportError(t.replica, t.op, t.path, errClosed)
+	}
+	return nil
+}
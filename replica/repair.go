@@ -0,0 +1,199 @@
+package replica
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/MayCMF/ofs"
+)
+
+// RepairOptions options of Repair
+type RepairOptions struct {
+	// DeleteExtra delete objects that the primary doesn't have from the other replicas, instead of copying them to all replicas
+	DeleteExtra bool
+	// Verify compare MD5 checksums of objects of the same size, objects are compared by size only otherwise,
+	// as ETags and modification times aren't comparable across backends
+	Verify bool
+	// DryRun only report what would be repaired
+	DryRun bool
+	// Concurrency number of objects copied in parallel, see ofs.TransferOptions
+	Concurrency int
+}
+
+// RepairReport result of Repair, paths are keyed by replica index
+type RepairReport struct {
+	// Copied paths that were missing or different, and have been copied to the replica
+	Copied map[int][]string
+	// Deleted paths that the primary doesn't have, and have been deleted from the replica, see RepairOptions.DeleteExtra
+	Deleted map[int][]string
+	// Failed errors of paths that couldn't be repaired
+	Failed map[int]map[string]error
+}
+
+func (report *RepairReport) fail(replica int, path string, err error) {
+	if report.Failed[replica] == nil {
+		report.Failed[replica] = map[string]error{}
+	}
+	report.Failed[replica][path] = err
+}
+
+// Repair reconcile the objects under path of all replicas by comparing their List results, objects that are missing on a replica
+// or differ are copied from the primary, or from the first replica that has them if the primary doesn't,
+// failures of single objects are recorded in the report, the returned error is only set if a replica couldn't be listed
+func (storage *Storage) Repair(ctx context.Context, path string, options *RepairOptions) (*RepairReport, error) {
+	if options == nil {
+		options = &RepairOptions{}
+	}
+
+	var (
+		report   = &RepairReport{Copied: map[int][]string{}, Deleted: map[int][]string{}, Failed: map[int]map[string]error{}}
+		listings = make([]map[string]*ofs.Object, len(storage.Replicas))
+		paths    []string
+	)
+
+	for i, replica := range storage.Replicas {
+		listing := map[string]*ofs.Object{}
+		err := ofs.Walk(ctx, replica, path, ofs.ListOptions{Recursive: true}, func(object *ofs.Object) error {
+			if !object.IsDir {
+				key := "/" + strings.TrimPrefix(object.Path, "/")
+				if _, ok := listing[key]; !ok {
+					listing[key] = object
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return report, fmt.Errorf("replica %d: %w", i, err)
+		}
+
+		for key := range listing {
+			if !contains(listings[:i], key) {
+				paths = append(paths, key)
+			}
+		}
+		listings[i] = listing
+	}
+	sort.Strings(paths)
+
+	var (
+		// copies paths to copy by source and target replica
+		copies  = map[[2]int][]string{}
+		deletes = map[int][]string{}
+	)
+
+	for _, key := range paths {
+		source := 0
+		for listings[source][key] == nil {
+			source++
+		}
+
+		if source != 0 && options.DeleteExtra {
+			for i := range listings {
+				if listings[i][key] != nil {
+					deletes[i] = append(deletes[i], key)
+				}
+			}
+			continue
+		}
+
+		for i := range listings {
+			if i == source {
+				continue
+			}
+
+			differs, err := storage.differs(ctx, source, i, key, listings, options)
+			if err != nil {
+				report.fail(i, key, err)
+			} else if differs {
+				copies[[2]int{source, i}] = append(copies[[2]int{source, i}], key)
+			}
+		}
+	}
+
+	if options.DryRun {
+		for replicas, keys := range copies {
+			report.Copied[replicas[1]] = append(report.Copied[replicas[1]], keys...)
+		}
+		for replica, keys := range deletes {
+			report.Deleted[replica] = keys
+		}
+	} else {
+		for replicas, keys := range copies {
+			transfer, err := ofs.Transfer(ctx, storage.Replicas[replicas[0]], storage.Replicas[replicas[1]], "/", "/",
+				&ofs.TransferOptions{Paths: keys, Concurrency: options.Concurrency, Verify: options.Verify})
+			if err != nil {
+				return report, err
+			}
+
+			report.Copied[replicas[1]] = append(report.Copied[replicas[1]], transfer.Transferred...)
+			for key, err := range transfer.Failed {
+				report.fail(replicas[1], key, err)
+			}
+		}
+
+		for replica, keys := range deletes {
+			for _, key := range keys {
+				if err := ofs.WithContext(storage.Replicas[replica]).DeleteWithContext(ctx, key); err != nil {
+					report.fail(replica, key, err)
+				} else {
+					report.Deleted[replica] = append(report.Deleted[replica], key)
+				}
+			}
+		}
+	}
+
+	for _, keys := range report.Copied {
+		sort.Strings(keys)
+	}
+	return report, ctx.Err()
+}
+
+func contains(listings []map[string]*ofs.Object, key string) bool {
+	for _, listing := range listings {
+		if _, ok := listing[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// differs report whether object key of replica target is missing or differs from the one of replica source
+func (storage *Storage) differs(ctx context.Context, source, target int, key string, listings []map[string]*ofs.Object, options *RepairOptions) (bool, error) {
+	object := listings[target][key]
+	if object == nil || object.Size != listings[source][key].Size {
+		return true, nil
+	}
+	if !options.Verify {
+		return false, nil
+	}
+
+	sourceChecksum, err := checksum(ctx, storage.Replicas[source], key)
+	if err != nil {
+		return false, err
+	}
+	targetChecksum, err := checksum(ctx, storage.Replicas[target], key)
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Equal(sourceChecksum, targetChecksum), nil
+}
+
+// checksum MD5 checksum of object path
+func checksum(ctx context.Context, storage ofs.StorageInterface, path string) ([]byte, error) {
+	stream, err := ofs.WithContext(storage).GetStreamWithContext(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	hasher := md5.New()
+	if _, err = io.Copy(hasher, ofs.ContextReader(ctx, stream)); err != nil {
+		return nil, err
+	}
+	return hasher.Sum(nil), nil
+}
@@ -0,0 +1,310 @@
+// Package replica implements a storage that replicates objects to several storages, e.g. to local disk and S3 for redundancy
+package replica
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/MayCMF/ofs"
+)
+
+// WritePolicy how writes are replicated
+type WritePolicy int
+
+const (
+	// WriteAll write to all replicas concurrently, writes fail if any replica fails
+	WriteAll WritePolicy = iota
+	// WriteQuorum write to all replicas concurrently, writes succeed if a majority of the replicas succeeded,
+	// replicas that failed are caught up through the retry queue
+	WriteQuorum
+	// WritePrimary write to the primary, the first replica, and replicate to the others asynchronously through the retry queue
+	WritePrimary
+)
+
+const (
+	// DefaultMaxRetries default number of attempts of queued replications
+	DefaultMaxRetries = 5
+	// DefaultRetryDelay default delay before the first retry of a queued replication, it doubles with every attempt
+	DefaultRetryDelay = time.Second
+	// DefaultHealthCooldown default time a replica that failed is read last
+	DefaultHealthCooldown = 30 * time.Second
+	// DefaultStragglerTimeout default time writes of WriteQuorum wait for replicas that fell behind the quorum
+	DefaultStragglerTimeout = 10 * time.Second
+)
+
+// Storage replicating storage, writes go to the replicas according to Policy, reads are served by the first healthy replica,
+// falling back to the next replicas if it fails, replicas failing with other errors than ofs.ErrNotFound are read last for HealthCooldown.
+// Queued replications copy the object from a replica that has it, so they always replicate the latest content,
+// writes that fail but succeeded on some replicas are queued for the others as well, so replicas don't stay diverged,
+// call Flush to wait for them, Close to drop them, and Repair to reconcile replicas that are out of sync anyway.
+// The queue's worker only runs while replications are queued, so a Storage that isn't closed doesn't leak it
+type Storage struct {
+	// Replicas replicated storages, the first one is the primary
+	Replicas []ofs.StorageInterface
+	Policy   WritePolicy
+	// MaxRetries attempts of queued replications before they are given up, DefaultMaxRetries if zero
+	MaxRetries int
+	// RetryDelay delay before the first retry of a queued replication, DefaultRetryDelay if zero
+	RetryDelay time.Duration
+	// HealthCooldown time a replica that failed is read last, DefaultHealthCooldown if zero
+	HealthCooldown time.Duration
+	// StragglerTimeout time writes of WriteQuorum wait for replicas that fell behind while the others make a quorum,
+	// those replicas are abandoned and caught up through the retry queue then, DefaultStragglerTimeout if zero
+	StragglerTimeout time.Duration
+	// OnError called with errors of replicas that reads fell back from, and of queued replications that have been given up
+	OnError func(replica int, op, path string, err error)
+
+	mutex     sync.Mutex
+	unhealthy map[int]time.Time
+	// queue retry queue, pending counts its tasks and the running one, idle is closed once pending drops to zero,
+	// running is set while a worker runs, it is cleared by the worker once the queue is empty
+	queue   []*task
+	pending int
+	idle    chan struct{}
+	running bool
+	closed  bool
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// New initialize replicating storage of replicas, the first replica is the primary
+func New(policy WritePolicy, replicas ...ofs.StorageInterface) *Storage {
+	return &Storage{Replicas: replicas, Policy: policy}
+}
+
+func (storage *Storage) maxRetries() int {
+	if storage.MaxRetries > 0 {
+		return storage.MaxRetries
+	}
+	return DefaultMaxRetries
+}
+
+func (storage *Storage) retryDelay() time.Duration {
+	if storage.RetryDelay > 0 {
+		return storage.RetryDelay
+	}
+	return DefaultRetryDelay
+}
+
+func (storage *Storage) healthCooldown() time.Duration {
+	if storage.HealthCooldown > 0 {
+		return storage.HealthCooldown
+	}
+	return DefaultHealthCooldown
+}
+
+func (storage *Storage) stragglerTimeout() time.Duration {
+	if storage.StragglerTimeout > 0 {
+		return storage.StragglerTimeout
+	}
+	return DefaultStragglerTimeout
+}
+
+func (storage *Storage) reportError(replica int, op, path string, err error) {
+	if storage.OnError != nil {
+		storage.OnError(replica, op, path, err)
+	}
+}
+
+// own return a copy of object pointing to the replicating storage
+func (storage *Storage) own(object *ofs.Object) *ofs.Object {
+	if object == nil {
+		return nil
+	}
+
+	owned := *object
+	owned.StorageInterface = storage
+	return &owned
+}
+
+// readOrder indexes of replicas in the order they are read, healthy replicas first
+func (storage *Storage) readOrder() []int {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	var (
+		order     = make([]int, 0, len(storage.Replicas))
+		unhealthy []int
+		now       = time.Now()
+	)
+
+	for i := range storage.Replicas {
+		if until, ok := storage.unhealthy[i]; ok && now.Before(until) {
+			unhealthy = append(unhealthy, i)
+		} else {
+			order = append(order, i)
+		}
+	}
+	return append(order, unhealthy...)
+}
+
+func (storage *Storage) setHealthy(replica int, healthy bool) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if healthy {
+		delete(storage.unhealthy, replica)
+		return
+	}
+	if storage.unhealthy == nil {
+		storage.unhealthy = map[int]time.Time{}
+	}
+	storage.unhealthy[replica] = time.Now().Add(storage.healthCooldown())
+}
+
+// read call fn with replicas in read order until it succeeds, return the error of the first replica if all failed
+func (storage *Storage) read(ctx context.Context, op, path string, fn func(replica ofs.StorageInterface) error) error {
+	if len(storage.Replicas) == 0 {
+		return ofs.NewError(op, path, ofs.ErrUnsupported, errors.New("no replicas"))
+	}
+
+	var firstErr error
+	for _, i := range storage.readOrder() {
+		err := fn(storage.Replicas[i])
+		if err == nil {
+			storage.setHealthy(i, true)
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return err
+		}
+
+		// objects may not have been replicated yet, that doesn't make the replica unhealthy
+		if !errors.Is(err, ofs.ErrNotFound) {
+			storage.setHealthy(i, false)
+			storage.reportError(i, op, path, err)
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Get receive file with given path
+func (storage *Storage) Get(path string) (*os.File, error) {
+	return storage.GetWithContext(context.Background(), path)
+}
+
+// GetWithContext receive file with given path
+func (storage *Storage) GetWithContext(ctx context.Context, path string) (file *os.File, err error) {
+	err = storage.read(ctx, "get", path, func(replica ofs.StorageInterface) (err error) {
+		file, err = ofs.WithContext(replica).GetWithContext(ctx, path)
+		return err
+	})
+	return file, err
+}
+
+// GetStream get file as stream
+func (storage *Storage) GetStream(path string) (io.ReadCloser, error) {
+	return storage.GetStreamWithContext(context.Background(), path)
+}
+
+// GetStreamWithContext get file as stream
+func (storage *Storage) GetStreamWithContext(ctx context.Context, path string) (stream io.ReadCloser, err error) {
+	err = storage.read(ctx, "get", path, func(replica ofs.StorageInterface) (err error) {
+		stream, err = ofs.WithContext(replica).GetStreamWithContext(ctx, path)
+		return err
+	})
+	return stream, err
+}
+
+// GetRange get length bytes of the object starting at offset, see ofs.GetRange
+func (storage *Storage) GetRange(path string, offset, length int64) (stream io.ReadCloser, err error) {
+	// refused before reaching the replicas, so they aren't taken for unhealthy
+	if offset < 0 {
+		return nil, ofs.NewError("get range", path, ofs.ErrInvalidPath, fmt.Errorf("negative offset %d", offset))
+	}
+
+	err = storage.read(context.Background(), "get", path, func(replica ofs.StorageInterface) (err error) {
+		stream, err = ofs.GetRange(replica, path, offset, length)
+		return err
+	})
+	return stream, err
+}
+
+// OpenReaderAt open a random access reader of the object, see ofs.OpenReaderAt
+func (storage *Storage) OpenReaderAt(path string) (reader ofs.ObjectReader, err error) {
+	err = storage.read(context.Background(), "get", path, func(replica ofs.StorageInterface) (err error) {
+		reader, err = ofs.OpenReaderAt(replica, path)
+		return err
+	})
+	return reader, err
+}
+
+// List list all objects under current path
+func (storage *Storage) List(path string) ([]*ofs.Object, error) {
+	return storage.ListWithContext(context.Background(), path)
+}
+
+// ListWithContext list all objects under current path
+func (storage *Storage) ListWithContext(ctx context.Context, path string) (objects []*ofs.Object, err error) {
+	err = storage.read(ctx, "list", path, func(replica ofs.StorageInterface) (err error) {
+		objects, err = ofs.WithContext(replica).ListWithContext(ctx, path)
+		return err
+	})
+	for i, object := range objects {
+		objects[i] = storage.own(object)
+	}
+	return objects, err
+}
+
+// ListPage list one page of entries under path, see ofs.ListPage, continuation tokens are only valid for the same replica,
+// so pages may be inconsistent if reads fall back to another replica while paginating
+func (storage *Storage) ListPage(ctx context.Context, path string, options ofs.ListOptions) (result *ofs.ListResult, err error) {
+	err = storage.read(ctx, "list", path, func(replica ofs.StorageInterface) (err error) {
+		result, err = ofs.ListPage(ctx, replica, path, options)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	owned := &ofs.ListResult{Objects: make([]*ofs.Object, len(result.Objects)), NextContinuationToken: result.NextContinuationToken}
+	for i, object := range result.Objects {
+		owned.Objects[i] = storage.own(object)
+	}
+	return owned, nil
+}
+
+// Stat get object's metadata
+func (storage *Storage) Stat(path string) (*ofs.Object, error) {
+	return storage.StatWithContext(context.Background(), path)
+}
+
+// StatWithContext get object's metadata
+func (storage *Storage) StatWithContext(ctx context.Context, path string) (object *ofs.Object, err error) {
+	err = storage.read(ctx, "stat", path, func(replica ofs.StorageInterface) (err error) {
+		object, err = ofs.WithContext(replica).StatWithContext(ctx, path)
+		return err
+	})
+	return storage.own(object), err
+}
+
+// GetURL get public accessible URL of the first healthy replica
+func (storage *Storage) GetURL(path string) (string, error) {
+	return storage.GetURLWithContext(context.Background(), path)
+}
+
+// GetURLWithContext get public accessible URL of the first healthy replica
+func (storage *Storage) GetURLWithContext(ctx context.Context, path string) (url string, err error) {
+	err = storage.read(ctx, "get url", path, func(replica ofs.StorageInterface) (err error) {
+		url, err = ofs.WithContext(replica).GetURLWithContext(ctx, path)
+		return err
+	})
+	return url, err
+}
+
+// GetEndpoint get endpoint of the primary
+func (storage *Storage) GetEndpoint() string {
+	if len(storage.Replicas) == 0 {
+		return ""
+	}
+	return storage.Replicas[0].GetEndpoint()
+}
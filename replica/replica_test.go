@@ -0,0 +1,412 @@
+package replica_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MayCMF/ofs"
+	"github.com/MayCMF/ofs/memory"
+	"github.com/MayCMF/ofs/ofstest"
+	"github.com/MayCMF/ofs/replica"
+)
+
+var errBroken = errors.New("replica is down")
+
+// brokenStorage fail all operations while broken is set, it hides optional capabilities of the wrapped storage
+type brokenStorage struct {
+	ofs.StorageInterface
+	broken int32
+}
+
+func (storage *brokenStorage) setBroken(broken bool) {
+	if broken {
+		atomic.StoreInt32(&storage.broken, 1)
+	} else {
+		atomic.StoreInt32(&storage.broken, 0)
+	}
+}
+
+func (storage *brokenStorage) err() error {
+	if atomic.LoadInt32(&storage.broken) == 1 {
+		return errBroken
+	}
+	return nil
+}
+
+func (storage *brokenStorage) Put(path string, reader io.Reader) (*ofs.Object, error) {
+	if err := storage.err(); err != nil {
+		return nil, err
+	}
+	return storage.StorageInterface.Put(path, reader)
+}
+
+func (storage *brokenStorage) GetStream(path string) (io.ReadCloser, error) {
+	if err := storage.err(); err != nil {
+		return nil, err
+	}
+	return storage.StorageInterface.GetStream(path)
+}
+
+func (storage *brokenStorage) Stat(path string) (*ofs.Object, error) {
+	if err := storage.err(); err != nil {
+		return nil, err
+	}
+	return storage.StorageInterface.Stat(path)
+}
+
+func (storage *brokenStorage) Delete(path string) error {
+	if err := storage.err(); err != nil {
+		return err
+	}
+	return storage.StorageInterface.Delete(path)
+}
+
+func read(t *testing.T, storage ofs.StorageInterface, path string) string {
+	stream, err := storage.GetStream(path)
+	if err != nil {
+		t.Fatalf("GetStream fail %v", err)
+	}
+	defer stream.Close()
+	content, _ := ioutil.ReadAll(stream)
+	return string(content)
+}
+
+func flush(t *testing.T, storage *replica.Storage) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := storage.Flush(ctx); err != nil {
+		t.Fatalf("Flush fail %v", err)
+	}
+}
+
+func TestAll(t *testing.T) {
+	for name, policy := range map[string]replica.WritePolicy{"all": replica.WriteAll, "quorum": replica.WriteQuorum} {
+		t.Run(name, func(t *testing.T) {
+			storage := replica.New(policy, memory.New(), memory.New(), memory.New())
+			defer storage.Close()
+			ofstest.TestAll(storage, t)
+		})
+	}
+}
+
+func TestWriteAll(t *testing.T) {
+	primary, secondary := memory.New(), &brokenStorage{StorageInterface: memory.New()}
+	storage := replica.New(replica.WriteAll, primary, secondary)
+	storage.RetryDelay = 10 * time.Millisecond
+	defer storage.Close()
+
+	object, err := storage.Put("/a.txt", strings.NewReader("replicated"))
+	if err != nil {
+		t.Fatalf("Put fail %v", err)
+	}
+	if object.Path != "/a.txt" || object.StorageInterface != storage {
+		t.Errorf("Put should return the object of the replicating storage, but got %+v", object)
+	}
+	if read(t, primary, "/a.txt") != "replicated" || read(t, secondary, "/a.txt") != "replicated" {
+		t.Errorf("object should be written to all replicas")
+	}
+
+	if _, err := storage.Put("/b.txt", strings.NewReader("b")); err != nil {
+		t.Fatalf("Put fail %v", err)
+	}
+
+	secondary.setBroken(true)
+	if _, err := storage.Put("/a.txt", strings.NewReader("updated")); !errors.Is(err, errBroken) {
+		t.Errorf("Put should fail if a replica fails, but got %v", err)
+	}
+	if err := storage.Delete("/b.txt"); !errors.Is(err, errBroken) {
+		t.Errorf("Delete should fail if a replica fails, but got %v", err)
+	}
+	if storage.Pending() != 2 {
+		t.Errorf("failed replicas of failed writes should be queued, but got %v pending", storage.Pending())
+	}
+
+	secondary.setBroken(false)
+	flush(t, storage)
+	if read(t, secondary, "/a.txt") != "updated" {
+		t.Errorf("failed Put should be caught up from the replica that succeeded")
+	}
+	if _, err := secondary.Stat("/b.txt"); !errors.Is(err, ofs.ErrNotFound) {
+		t.Errorf("failed Delete should be caught up from the replica that succeeded, but got %v", err)
+	}
+}
+
+func TestWriteAllCreateOnly(t *testing.T) {
+	primary, secondary := memory.New(), memory.New()
+	storage := replica.New(replica.WriteAll, primary, secondary)
+	storage.RetryDelay = 10 * time.Millisecond
+	defer storage.Close()
+
+	secondary.Put("/a.txt", strings.NewReader("existing"))
+	_, err := storage.PutWithOptions(context.Background(), "/a.txt", strings.NewReader("new"), &ofs.PutOptions{CreateOnly: true})
+	if !errors.Is(err, ofs.ErrExists) {
+		t.Errorf("Put should fail with ofs.ErrExists if a replica has the object, but got %v", err)
+	}
+
+	flush(t, storage)
+	if read(t, primary, "/a.txt") != "existing" || read(t, secondary, "/a.txt") != "existing" {
+		t.Errorf("existing object should be kept and caught up to the replicas that created it")
+	}
+}
+
+func TestWriteQuorum(t *testing.T) {
+	broken := &brokenStorage{StorageInterface: memory.New()}
+	broken.setBroken(true)
+	storage := replica.New(replica.WriteQuorum, memory.New(), broken, memory.New())
+	storage.RetryDelay = 10 * time.Millisecond
+	defer storage.Close()
+
+	if _, err := storage.Put("/a.txt", strings.NewReader(strings.Repeat("quorum", 10000))); err != nil {
+		t.Fatalf("Put should succeed with a majority of replicas, but got %v", err)
+	}
+	if storage.Pending() != 1 {
+		t.Errorf("failed replica should be queued, but got %v pending", storage.Pending())
+	}
+
+	broken.setBroken(false)
+	flush(t, storage)
+	if read(t, broken, "/a.txt") != strings.Repeat("quorum", 10000) {
+		t.Errorf("failed replica should be caught up")
+	}
+
+	second := &brokenStorage{StorageInterface: memory.New()}
+	second.setBroken(true)
+	broken.setBroken(true)
+	storage.Replicas[2] = second
+	if _, err := storage.Put("/b.txt", strings.NewReader("b")); !errors.Is(err, errBroken) || !strings.Contains(err.Error(), "2 of 3 replicas failed") {
+		t.Errorf("Put should fail without a majority, but got %v", err)
+	}
+}
+
+// hangingStorage block writes without reading their data until release is closed, writes after that are forwarded, it hides optional capabilities of the wrapped storage
+type hangingStorage struct {
+	ofs.StorageInterface
+	release chan struct{}
+}
+
+func (storage *hangingStorage) Put(path string, reader io.Reader) (*ofs.Object, error) {
+	select {
+	case <-storage.release:
+		return storage.StorageInterface.Put(path, reader)
+	default:
+	}
+	<-storage.release
+	return nil, errBroken
+}
+
+func TestWriteQuorumStraggler(t *testing.T) {
+	secondary := memory.New()
+	hanging := &hangingStorage{StorageInterface: secondary, release: make(chan struct{})}
+	storage := replica.New(replica.WriteQuorum, memory.New(), hanging, memory.New())
+	storage.StragglerTimeout, storage.RetryDelay = 50*time.Millisecond, 10*time.Millisecond
+	defer storage.Close()
+
+	content := strings.Repeat("straggler", 100000)
+	done := make(chan error)
+	go func() {
+		_, err := storage.Put("/a.txt", strings.NewReader(content))
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Put should succeed with a quorum, but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("a hanging replica shouldn't stall writes of a quorum")
+	}
+	if storage.Pending() != 1 {
+		t.Errorf("abandoned replica should be queued, but got %v pending", storage.Pending())
+	}
+
+	close(hanging.release)
+	flush(t, storage)
+	if read(t, secondary, "/a.txt") != content {
+		t.Errorf("abandoned replica should be caught up")
+	}
+}
+
+func TestWritePrimary(t *testing.T) {
+	primary, secondary := memory.New(), &brokenStorage{StorageInterface: memory.New()}
+	storage := replica.New(replica.WritePrimary, primary, secondary)
+	storage.RetryDelay = 10 * time.Millisecond
+	defer storage.Close()
+
+	secondary.setBroken(true)
+	if _, err := storage.Put("/a.txt", strings.NewReader("async")); err != nil {
+		t.Fatalf("Put fail %v", err)
+	}
+	if read(t, primary, "/a.txt") != "async" {
+		t.Errorf("object should be written to the primary")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	secondary.setBroken(false)
+	flush(t, storage)
+	if read(t, secondary, "/a.txt") != "async" {
+		t.Errorf("object should be replicated asynchronously")
+	}
+
+	if _, err := storage.Move("/a.txt", "/b.txt"); err != nil {
+		t.Fatalf("Move fail %v", err)
+	}
+	flush(t, storage)
+	if _, err := secondary.Stat("/a.txt"); !errors.Is(err, ofs.ErrNotFound) || read(t, secondary, "/b.txt") != "async" {
+		t.Errorf("Move should be replicated, but got %v", err)
+	}
+
+	if err := storage.Delete("/b.txt"); err != nil {
+		t.Fatalf("Delete fail %v", err)
+	}
+	flush(t, storage)
+	if _, err := secondary.Stat("/b.txt"); !errors.Is(err, ofs.ErrNotFound) {
+		t.Errorf("Delete should be replicated, but got %v", err)
+	}
+}
+
+func TestRetryGivenUp(t *testing.T) {
+	secondary := &brokenStorage{StorageInterface: memory.New()}
+	secondary.setBroken(true)
+
+	var (
+		mutex  sync.Mutex
+		errs   []error
+		closed = make(chan struct{})
+	)
+	storage := replica.New(replica.WritePrimary, memory.New(), secondary)
+	storage.MaxRetries, storage.RetryDelay = 2, time.Millisecond
+	storage.OnError = func(replica int, op, path string, err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if replica != 1 || op != "put" || path != "/a.txt" {
+			t.Errorf("unexpected error of replica %v %v %v", replica, op, path)
+		}
+		errs = append(errs, err)
+	}
+
+	storage.Put("/a.txt", strings.NewReader("a"))
+	flush(t, storage)
+	mutex.Lock()
+	if len(errs) != 1 || !errors.Is(errs[0], errBroken) {
+		t.Errorf("given up replication should be reported, but got %v", errs)
+	}
+	errs = nil
+	mutex.Unlock()
+
+	storage.RetryDelay = time.Hour
+	storage.Put("/a.txt", strings.NewReader("a"))
+	go func() {
+		storage.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Close should stop the queue")
+	}
+	if storage.Pending() != 0 {
+		t.Errorf("Close should drop queued replications, but got %v", storage.Pending())
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(errs) != 1 {
+		t.Errorf("dropped replications should be reported, but got %v", errs)
+	}
+}
+
+func TestReadFallback(t *testing.T) {
+	primary, secondary := &brokenStorage{StorageInterface: memory.New()}, memory.New()
+	storage := replica.New(replica.WriteAll, primary, secondary)
+	defer storage.Close()
+
+	var reported int32
+	storage.OnError = func(replica int, op, path string, err error) { atomic.AddInt32(&reported, 1) }
+
+	// not replicated to the primary yet
+	secondary.Put("/only-secondary.txt", strings.NewReader("secondary"))
+	if read(t, storage, "/only-secondary.txt") != "secondary" {
+		t.Errorf("reads should fall back to replicas that have the object")
+	}
+	if atomic.LoadInt32(&reported) != 0 {
+		t.Errorf("missing objects shouldn't be reported")
+	}
+
+	storage.Put("/a.txt", strings.NewReader("a"))
+	primary.setBroken(true)
+	if object, err := storage.Stat("/a.txt"); err != nil || object.StorageInterface != storage {
+		t.Errorf("Stat should fall back to healthy replicas, but got %v %v", object, err)
+	}
+	if atomic.LoadInt32(&reported) != 1 {
+		t.Errorf("errors of replicas should be reported, but got %v", reported)
+	}
+
+	// the primary is read last while it is unhealthy
+	if read(t, storage, "/a.txt") != "a" || atomic.LoadInt32(&reported) != 1 {
+		t.Errorf("unhealthy replicas should be read last, but got %v reports", reported)
+	}
+
+	if _, err := storage.Stat("/missing.txt"); !errors.Is(err, ofs.ErrNotFound) {
+		t.Errorf("Stat of missing objects should fail with ErrNotFound, but got %v", err)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	primary, secondary, third := memory.New(), memory.New(), memory.New()
+	storage := replica.New(replica.WriteAll, primary, secondary, third)
+	defer storage.Close()
+
+	primary.Put("/docs/a.txt", strings.NewReader("a"))
+	primary.Put("/docs/b.txt", strings.NewReader("bbb"))
+	secondary.Put("/docs/b.txt", strings.NewReader("b"))
+	secondary.Put("/docs/extra.txt", strings.NewReader("extra"))
+	third.Put("/docs/a.txt", strings.NewReader("x"))
+	third.Put("/docs/b.txt", strings.NewReader("bbb"))
+
+	report, err := storage.Repair(context.Background(), "/docs", &replica.RepairOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Repair fail %v", err)
+	}
+	if strings.Join(report.Copied[0], ",") != "/docs/extra.txt" ||
+		strings.Join(report.Copied[1], ",") != "/docs/a.txt,/docs/b.txt" ||
+		strings.Join(report.Copied[2], ",") != "/docs/extra.txt" {
+		t.Errorf("dry run should report missing and different objects, but got %v", report.Copied)
+	}
+	if _, err := primary.Stat("/docs/extra.txt"); !errors.Is(err, ofs.ErrNotFound) {
+		t.Errorf("dry run shouldn't change replicas")
+	}
+
+	// same size, so only found by checksums
+	if report, _ := storage.Repair(context.Background(), "/docs", &replica.RepairOptions{DryRun: true, Verify: true}); strings.Join(report.Copied[2], ",") != "/docs/a.txt,/docs/extra.txt" {
+		t.Errorf("Verify should compare checksums, but got %v", report.Copied)
+	}
+
+	report, err = storage.Repair(context.Background(), "/docs", &replica.RepairOptions{DeleteExtra: true, Verify: true})
+	if err != nil || len(report.Failed) != 0 {
+		t.Fatalf("Repair fail %v %v", err, report.Failed)
+	}
+	if strings.Join(report.Deleted[1], ",") != "/docs/extra.txt" {
+		t.Errorf("objects the primary doesn't have should be deleted, but got %v", report.Deleted)
+	}
+
+	for i, replica := range storage.Replicas {
+		if read(t, replica, "/docs/a.txt") != "a" || read(t, replica, "/docs/b.txt") != "bbb" {
+			t.Errorf("replica %v should be repaired", i)
+		}
+		if _, err := replica.Stat("/docs/extra.txt"); !errors.Is(err, ofs.ErrNotFound) {
+			t.Errorf("replica %v should be repaired", i)
+		}
+	}
+
+	if report, _ := storage.Repair(context.Background(), "/docs", &replica.RepairOptions{Verify: true}); len(report.Copied)+len(report.Deleted) != 0 {
+		t.Errorf("repaired replicas should be in sync, but got %v %v", report.Copied, report.Deleted)
+	}
+}
@@ -0,0 +1,393 @@
+package replica
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/MayCMF/ofs"
+)
+
+// result result of a write to one replica, done is false for replicas that are written asynchronously
+type result struct {
+	object *ofs.Object
+	err    error
+	done   bool
+}
+
+// required number of replicas that must succeed for a write to succeed
+func (storage *Storage) required() int {
+	switch storage.Policy {
+	case WriteQuorum:
+		return len(storage.Replicas)/2 + 1
+	case WritePrimary:
+		return 1
+	}
+	return len(storage.Replicas)
+}
+
+// each call fn for all replicas concurrently, or only for the primary with WritePrimary
+func (storage *Storage) each(fn func(replica ofs.StorageInterface) (*ofs.Object, error)) []result {
+	var (
+		results = make([]result, len(storage.Replicas))
+		n       = len(storage.Replicas)
+		wg      sync.WaitGroup
+	)
+
+	if storage.Policy == WritePrimary && n > 0 {
+		n = 1
+	}
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			object, err := fn(storage.Replicas[i])
+			results[i] = result{object: object, err: err, done: true}
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// settle check results against Policy, replications of replicas that failed or haven't been written are queued with queue,
+// return the object of the first replica that succeeded, writes that fail are reconciled
+func (storage *Storage) settle(op, path string, results []result, queue func(replica, source int)) (*ofs.Object, error) {
+	if len(storage.Replicas) == 0 {
+		return nil, ofs.NewError(op, path, ofs.ErrUnsupported, errors.New("no replicas"))
+	}
+
+	var (
+		source    = -1
+		succeeded int
+		pending   []int
+		failed    []int
+	)
+
+	for i, result := range results {
+		switch {
+		case !result.done:
+			pending = append(pending, i)
+		case result.err != nil:
+			pending = append(pending, i)
+			failed = append(failed, i)
+		default:
+			succeeded++
+			if source < 0 {
+				source = i
+			}
+		}
+	}
+
+	if succeeded < storage.required() || (storage.Policy == WritePrimary && source != 0) {
+		storage.reconcile(results, source, queue)
+
+		first := failed[0]
+		if len(failed) == 1 {
+			return nil, fmt.Errorf("replica %d: %w", first, results[first].err)
+		}
+		return nil, fmt.Errorf("%d of %d replicas failed, replica %d: %w", len(failed), len(results), first, results[first].err)
+	}
+
+	for _, i := range pending {
+		queue(i, source)
+	}
+	return storage.own(results[source].object), nil
+}
+
+// reconcile queue replications of a failed write that succeeded on some replicas, so replicas don't stay diverged:
+// if a replica refused a CreateOnly write with ofs.ErrExists its object is kept and copied to the replicas that succeeded,
+// otherwise the others are caught up from source, so the write is eventually applied to all replicas anyway
+func (storage *Storage) reconcile(results []result, source int, queue func(replica, source int)) {
+	if source < 0 {
+		return
+	}
+
+	for i, result := range results {
+		if result.done && errors.Is(result.err, ofs.ErrExists) {
+			for j, result := range results {
+				if result.done && result.err == nil {
+					queue(j, i)
+				}
+			}
+			return
+		}
+	}
+
+	for i, result := range results {
+		if !result.done || result.err != nil {
+			queue(i, source)
+		}
+	}
+}
+
+// Put store a reader into given path
+func (storage *Storage) Put(path string, reader io.Reader) (*ofs.Object, error) {
+	return storage.PutWithOptions(context.Background(), path, reader, nil)
+}
+
+// PutWithContext store a reader into given path
+func (storage *Storage) PutWithContext(ctx context.Context, path string, reader io.Reader) (*ofs.Object, error) {
+	return storage.PutWithOptions(ctx, path, reader, nil)
+}
+
+// PutWithOptions store a reader into given path according to Policy, the reader is streamed into all replicas at once,
+// so it is read only once. With WriteQuorum options.CreateOnly only holds for the replicas that succeeded, a replica failing
+// with ofs.ErrExists is still caught up by the retry queue, which overwrites its object with the one of the quorum
+func (storage *Storage) PutWithOptions(ctx context.Context, path string, reader io.Reader, options *ofs.PutOptions) (*ofs.Object, error) {
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		seeker.Seek(0, 0)
+	}
+
+	var results []result
+	if storage.Policy == WritePrimary || len(storage.Replicas) <= 1 {
+		results = storage.each(func(replica ofs.StorageInterface) (*ofs.Object, error) {
+			return ofs.PutWithOptions(ctx, replica, path, reader, options)
+		})
+	} else {
+		results = storage.fanOut(ctx, path, ofs.ContextReader(ctx, reader), options)
+	}
+	return storage.settle("put", path, results, storage.queuePut(path))
+}
+
+// fanOutBuffer number of chunks buffered per replica by fanOut, so replicas could fall behind the others that far without slowing them down
+const fanOutBuffer = 8
+
+// errAbandoned error of replicas that fell behind during a quorum write
+var errAbandoned = errors.New("replica: abandoned slow replica")
+
+// feed chunks streamed into one replica by fanOut
+type feed struct {
+	chunks chan []byte
+	// err error the writer is closed with once chunks are drained, set before chunks is closed
+	err    error
+	writer *io.PipeWriter
+	cancel context.CancelFunc
+	// done closed once the replica's write returned
+	done chan struct{}
+	// abandoned the replica fell behind and its write has been canceled
+	abandoned bool
+}
+
+// stop stop feeding the replica, its write fails with err if it is still reading
+func (f *feed) stop(err error) {
+	f.err = err
+	close(f.chunks)
+	f.writer.CloseWithError(err)
+}
+
+type fanOutResult struct {
+	replica int
+	result  result
+}
+
+// fanOut stream reader into all replicas concurrently, every replica is fed from its own buffer, replicas that fail are dropped
+// without stopping the others. With WriteQuorum replicas that stall for StragglerTimeout while the others make a quorum,
+// or that haven't finished StragglerTimeout after a quorum succeeded, are abandoned: their writes are canceled,
+// and their results aren't done, so settle queues them for the retry queue
+func (storage *Storage) fanOut(ctx context.Context, path string, reader io.Reader, options *ofs.PutOptions) []result {
+	var (
+		results  = make([]result, len(storage.Replicas))
+		feeds    = make([]*feed, len(storage.Replicas))
+		live     = map[int]*feed{}
+		finished = make(chan fanOutResult, len(storage.Replicas))
+		readErr  error
+	)
+
+	for i, replica := range storage.Replicas {
+		var (
+			pipeReader, pipeWriter = io.Pipe()
+			replicaCtx, cancel     = context.WithCancel(ctx)
+			f                      = &feed{chunks: make(chan []byte, fanOutBuffer), writer: pipeWriter, cancel: cancel, done: make(chan struct{})}
+		)
+		feeds[i], live[i] = f, f
+
+		go func(i int, replica ofs.StorageInterface) {
+			defer cancel()
+			object, err := ofs.PutWithOptions(replicaCtx, replica, path, pipeReader, options)
+			// unblock pending writes if the replica stopped reading
+			if err != nil {
+				pipeReader.CloseWithError(err)
+			} else {
+				pipeReader.Close()
+			}
+			close(f.done)
+			finished <- fanOutResult{replica: i, result: result{object: object, err: err, done: true}}
+		}(i, replica)
+
+		go func() {
+			for chunk := range f.chunks {
+				if _, err := f.writer.Write(chunk); err != nil {
+					return
+				}
+			}
+			f.writer.CloseWithError(f.err)
+		}()
+	}
+
+	buffer := make([]byte, 32*1024)
+	for {
+		n, err := reader.Read(buffer)
+		if n > 0 && storage.feed(feeds, append([]byte(nil), buffer[:n]...)) == 0 {
+			break
+		}
+		if err != nil {
+			if err != io.EOF {
+				readErr = err
+			}
+			break
+		}
+	}
+
+	for i, f := range live {
+		if f.abandoned {
+			delete(live, i)
+		} else if feeds[i] != nil {
+			f.err = readErr
+			close(f.chunks)
+		}
+	}
+
+	var (
+		succeeded int
+		timeout   <-chan time.Time
+	)
+	for len(live) > 0 {
+		select {
+		case r := <-finished:
+			if live[r.replica] == nil {
+				continue
+			}
+			delete(live, r.replica)
+			results[r.replica] = r.result
+			if r.result.err == nil {
+				succeeded++
+			}
+			if storage.Policy == WriteQuorum && succeeded >= storage.required() && timeout == nil && readErr == nil {
+				timer := time.NewTimer(storage.stragglerTimeout())
+				defer timer.Stop()
+				timeout = timer.C
+			}
+		case <-timeout:
+			for _, f := range live {
+				f.cancel()
+			}
+			live = nil
+		}
+	}
+	return results
+}
+
+// feed send chunk to the live feeds, feeds of replicas that stopped reading are dropped, with WriteQuorum feeds that don't take
+// the chunk within StragglerTimeout are abandoned if the others still make a quorum, return the number of live feeds
+func (storage *Storage) feed(feeds []*feed, chunk []byte) int {
+	live := 0
+	for _, f := range feeds {
+		if f != nil {
+			live++
+		}
+	}
+
+	for i, f := range feeds {
+		if f == nil {
+			continue
+		}
+
+		select {
+		case f.chunks <- chunk:
+			continue
+		case <-f.done:
+			feeds[i] = nil
+			live--
+			f.stop(io.ErrClosedPipe)
+			continue
+		default:
+		}
+
+		var (
+			timer   *time.Timer
+			timeout <-chan time.Time
+		)
+		if storage.Policy == WriteQuorum && live > storage.required() {
+			timer = time.NewTimer(storage.stragglerTimeout())
+			timeout = timer.C
+		}
+
+		select {
+		case f.chunks <- chunk:
+		case <-f.done:
+			feeds[i] = nil
+			live--
+			f.stop(io.ErrClosedPipe)
+		case <-timeout:
+			feeds[i] = nil
+			live--
+			f.abandoned = true
+			f.stop(errAbandoned)
+			f.cancel()
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+	return live
+}
+
+// Delete delete file
+func (storage *Storage) Delete(path string) error {
+	return storage.DeleteWithContext(context.Background(), path)
+}
+
+// DeleteWithContext delete file according to Policy, replicas that don't have the object count as succeeded,
+// ofs.ErrNotFound is only returned if none of the written replicas had it
+func (storage *Storage) DeleteWithContext(ctx context.Context, path string) error {
+	var notFound int32
+	results := storage.each(func(replica ofs.StorageInterface) (*ofs.Object, error) {
+		err := ofs.WithContext(replica).DeleteWithContext(ctx, path)
+		if errors.Is(err, ofs.ErrNotFound) {
+			atomic.AddInt32(&notFound, 1)
+			return nil, nil
+		}
+		return nil, err
+	})
+
+	if _, err := storage.settle("delete", path, results, storage.queueDelete(path)); err != nil {
+		return err
+	}
+
+	done := 0
+	for _, result := range results {
+		if result.done {
+			done++
+		}
+	}
+	if int(notFound) == done {
+		return ofs.NewError("delete", path, ofs.ErrNotFound, nil)
+	}
+	return nil
+}
+
+// Copy copy object src to dst on the replicas according to Policy, see ofs.Copy
+func (storage *Storage) Copy(src, dst string) (*ofs.Object, error) {
+	results := storage.each(func(replica ofs.StorageInterface) (*ofs.Object, error) {
+		return ofs.Copy(replica, src, dst)
+	})
+	return storage.settle("copy", dst, results, storage.queuePut(dst))
+}
+
+// Move move object src to dst on the replicas according to Policy, see ofs.Move
+func (storage *Storage) Move(src, dst string) (*ofs.Object, error) {
+	results := storage.each(func(replica ofs.StorageInterface) (*ofs.Object, error) {
+		return ofs.Move(replica, src, dst)
+	})
+
+	queuePut, queueDelete := storage.queuePut(dst), storage.queueDelete(src)
+	return storage.settle("move", dst, results, func(replica, source int) {
+		queuePut(replica, source)
+		queueDelete(replica, source)
+	})
+}
@@ -0,0 +1,260 @@
+package ofs
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CrossCopier implemented by storages that could copy objects from another storage server side, e.g. from a bucket of the same S3 endpoint
+type CrossCopier interface {
+	// CopyFrom copy srcPath of src into dstPath, return ErrUnsupported if src can't be copied server side
+	CopyFrom(ctx context.Context, src StorageInterface, srcPath, dstPath string) (*Object, error)
+}
+
+// TransferOptions options of Transfer
+type TransferOptions struct {
+	// Concurrency number of objects transferred in parallel, 1 if zero
+	Concurrency int
+	// Verify compare MD5 checksums of source and destination after each object is transferred
+	Verify bool
+	// Paths only transfer these source objects instead of listing srcPath, e.g. report.FailedPaths() to resume a transfer
+	Paths []string
+	// Progress called while objects are transferred with the source path, transferred and total bytes,
+	// calls are serialized, but come from the goroutines transferring the objects
+	Progress func(path string, transferred, total int64)
+}
+
+// TransferReport result of Transfer
+type TransferReport struct {
+	// Transferred source paths that have been transferred
+	Transferred []string
+	// Failed errors of source paths that failed
+	Failed map[string]error
+
+	mutex sync.Mutex
+}
+
+// FailedPaths return sorted source paths that failed, pass them as TransferOptions.Paths to retry them
+func (report *TransferReport) FailedPaths() []string {
+	paths := make([]string, 0, len(report.Failed))
+	for path := range report.Failed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (report *TransferReport) add(path string, err error) {
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	if err != nil {
+		report.Failed[path] = err
+	} else {
+		report.Transferred = append(report.Transferred, path)
+	}
+}
+
+// ErrChecksumMismatch returned for transferred objects whose destination checksum differs from the source
+var ErrChecksumMismatch = errors.New("ofs: checksum mismatch")
+
+// Transfer copy object srcPath, or all objects under srcPath if it isn't an object, from src into dstPath of dst,
+// objects are copied server side if dst implements CrossCopier and accepts src, and streamed otherwise,
+// failures of single objects are recorded in the report, the returned error is only set if objects couldn't be listed
+func Transfer(ctx context.Context, src, dst StorageInterface, srcPath, dstPath string, options *TransferOptions) (*TransferReport, error) {
+	if options == nil {
+		options = &TransferOptions{}
+	}
+
+	var (
+		report      = &TransferReport{Failed: map[string]error{}}
+		paths       = make(chan string)
+		concurrency = options.Concurrency
+		single      bool
+		wg          sync.WaitGroup
+	)
+
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	// objects are transferred concurrently, so calls of Progress are serialized
+	if progress := options.Progress; progress != nil && concurrency > 1 {
+		var mutex sync.Mutex
+		serialized := *options
+		serialized.Progress = func(path string, transferred, total int64) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			progress(path, transferred, total)
+		}
+		options = &serialized
+	}
+
+	if len(options.Paths) == 0 {
+		if _, err := src.Stat(srcPath); err == nil {
+			single = true
+		} else if !errors.Is(err, ErrNotFound) {
+			return report, err
+		}
+	}
+
+	// objects under srcPath keep their relative path under dstPath, the object srcPath itself is copied to dstPath
+	dstOf := func(path string) string {
+		path = "/" + strings.TrimPrefix(path, "/")
+		if prefix := DirPrefix(srcPath); strings.HasPrefix(path, prefix) {
+			return DirPrefix(dstPath) + path[len(prefix):]
+		}
+		return dstPath
+	}
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				report.add(path, transferObject(ctx, src, dst, path, dstOf(path), options))
+			}
+		}()
+	}
+
+	err := func() error {
+		defer close(paths)
+
+		send := func(path string) error {
+			select {
+			case paths <- path:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if len(options.Paths) > 0 {
+			for _, path := range options.Paths {
+				if err := send(path); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		if single {
+			return send(srcPath)
+		}
+
+		return Walk(ctx, src, srcPath, ListOptions{Recursive: true}, func(object *Object) error {
+			return send(object.Path)
+		})
+	}()
+
+	wg.Wait()
+	sort.Strings(report.Transferred)
+	return report, err
+}
+
+// transferObject copy object srcPath of src into dstPath of dst
+func transferObject(ctx context.Context, src, dst StorageInterface, srcPath, dstPath string, options *TransferOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	object, err := src.Stat(srcPath)
+	if err != nil {
+		return err
+	}
+
+	copied := false
+	if copier, ok := dst.(CrossCopier); ok {
+		if _, err = copier.CopyFrom(ctx, src, srcPath, dstPath); err == nil {
+			copied = true
+			if options.Progress != nil {
+				options.Progress(srcPath, object.Size, object.Size)
+			}
+		} else if !errors.Is(err, ErrUnsupported) {
+			return err
+		}
+	}
+
+	var checksum []byte
+	if !copied {
+		stream, err := WithContext(src).GetStreamWithContext(ctx, srcPath)
+		if err != nil {
+			return err
+		}
+		defer stream.Close()
+
+		var (
+			hasher = md5.New()
+			reader = &progressReader{reader: io.TeeReader(stream, hasher), path: srcPath, total: object.Size, progress: options.Progress}
+		)
+		if _, err = putCopy(ctx, dst, dstPath, reader, object); err != nil {
+			return err
+		}
+		checksum = hasher.Sum(nil)
+	}
+
+	dstObject, err := dst.Stat(dstPath)
+	if err != nil {
+		return err
+	}
+	if dstObject.Size != object.Size {
+		return NewError("transfer", dstPath, ErrChecksumMismatch, fmt.Errorf("size %d, expected %d", dstObject.Size, object.Size))
+	}
+
+	if options.Verify {
+		if checksum == nil {
+			if checksum, err = streamChecksum(ctx, src, srcPath); err != nil {
+				return err
+			}
+		}
+
+		dstChecksum, err := streamChecksum(ctx, dst, dstPath)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(checksum, dstChecksum) {
+			return NewError("transfer", dstPath, ErrChecksumMismatch, fmt.Errorf("md5 %x, expected %x", dstChecksum, checksum))
+		}
+	}
+	return nil
+}
+
+// streamChecksum MD5 checksum of object path
+func streamChecksum(ctx context.Context, storage StorageInterface, path string) ([]byte, error) {
+	stream, err := WithContext(storage).GetStreamWithContext(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	hasher := md5.New()
+	if _, err = io.Copy(hasher, ContextReader(ctx, stream)); err != nil {
+		return nil, err
+	}
+	return hasher.Sum(nil), nil
+}
+
+// progressReader report read bytes to progress
+type progressReader struct {
+	reader      io.Reader
+	path        string
+	transferred int64
+	total       int64
+	progress    func(path string, transferred, total int64)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.transferred += int64(n)
+	if r.progress != nil && n > 0 {
+		r.progress(r.path, r.transferred, r.total)
+	}
+	return n, err
+}
@@ -0,0 +1,81 @@
+package ofs_test
+
+import (
+	"context"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/MayCMF/ofs"
+	fs "github.com/MayCMF/ofs/filesystem"
+)
+
+// plainStorage hides optional capabilities of the wrapped storage
+type plainStorage struct {
+	ofs.StorageInterface
+}
+
+func TestTransfer(t *testing.T) {
+	src := fs.New(t.TempDir())
+	for _, path := range []string{"/assets/a.txt", "/assets/b/c.txt", "/other.txt"} {
+		src.Put(path, strings.NewReader("content of "+path))
+	}
+
+	for name, dst := range map[string]ofs.StorageInterface{
+		"server side": fs.New(t.TempDir()),
+		"streaming":   plainStorage{fs.New(t.TempDir())},
+	} {
+		// calls of Progress are serialized, so it doesn't need a lock
+		progress := map[string]int64{}
+
+		report, err := ofs.Transfer(context.Background(), src, dst, "/assets", "/backup", &ofs.TransferOptions{
+			Concurrency: 2,
+			Verify:      true,
+			Progress: func(path string, transferred, total int64) {
+				progress[path] = transferred
+			},
+		})
+
+		if err != nil || len(report.Failed) != 0 {
+			t.Errorf("%v: transfer fail %v, %v", name, err, report.Failed)
+			continue
+		}
+
+		if expected := []string{"/assets/a.txt", "/assets/b/c.txt"}; !reflect.DeepEqual(report.Transferred, expected) {
+			t.Errorf("%v: transferred should be %v, but got %v", name, expected, report.Transferred)
+		}
+
+		if progress["/assets/b/c.txt"] != int64(len("content of /assets/b/c.txt")) {
+			t.Errorf("%v: progress should be reported, but got %v", name, progress)
+		}
+
+		stream, err := dst.GetStream("/backup/b/c.txt")
+		if err != nil {
+			t.Errorf("%v: transferred object should exist, %v", name, err)
+			continue
+		}
+		if data, _ := ioutil.ReadAll(stream); string(data) != "content of /assets/b/c.txt" {
+			t.Errorf("%v: transferred content is wrong, got %v", name, string(data))
+		}
+		stream.Close()
+	}
+}
+
+func TestTransferFailedPaths(t *testing.T) {
+	var (
+		src = fs.New(t.TempDir())
+		dst = fs.New(t.TempDir())
+	)
+	src.Put("/a.txt", strings.NewReader("a"))
+
+	report, err := ofs.Transfer(context.Background(), src, dst, "/", "/", &ofs.TransferOptions{Paths: []string{"/a.txt", "/missing.txt"}})
+	if err != nil {
+		t.Errorf("Transfer fail %v", err)
+		return
+	}
+
+	if failed := report.FailedPaths(); !reflect.DeepEqual(failed, []string{"/missing.txt"}) {
+		t.Errorf("Failed paths should be [/missing.txt], but got %v", failed)
+	}
+}
@@ -0,0 +1,468 @@
+// Package tus implements the tus 1.0 resumable upload protocol (https://tus.io/protocols/resumable-upload) over ofs storages
+//
+// It supports the core protocol and the creation, creation-with-upload, termination and expiration extensions.
+// Storages implementing ofs.ResumableUploader stage uploads natively, e.g. S3 multipart uploads or temporary files of FileSystem,
+// chunks of other storages are staged as objects under Handler.UploadDir and concatenated on completion.
+// Upload states and staged chunks are written with a private ACL, set Handler.StateStorage to keep them out of Storage entirely.
+package tus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MayCMF/ofs"
+)
+
+// Version supported version of the tus protocol
+const Version = "1.0.0"
+
+// Extensions supported extensions of the tus protocol
+const Extensions = "creation,creation-with-upload,termination,expiration"
+
+// DefaultUploadDir default directory of upload states and staged chunks
+const DefaultUploadDir = "/.tus-uploads"
+
+// DefaultExpiry default time unfinished uploads are kept
+const DefaultExpiry = 24 * time.Hour
+
+// offsetContentType content type of PATCH requests
+const offsetContentType = "application/offset+octet-stream"
+
+// Handler http.Handler of tus uploads into Storage, POST to its root to create uploads, the returned Location is used for HEAD, PATCH and DELETE
+type Handler struct {
+	Storage ofs.StorageInterface
+	// StateStorage storage of upload states and staged chunks, Storage if nil
+	StateStorage ofs.StorageInterface
+	// UploadDir directory of upload states and staged chunks in StateStorage, DefaultUploadDir if empty
+	UploadDir string
+	// BasePath URL path the handler is mounted at, used for Location of created uploads, the path of the creation request if empty
+	BasePath string
+	// MaxSize maximum size of an upload, unlimited if zero
+	MaxSize int64
+	// Expiry time unfinished uploads are kept, DefaultExpiry if zero
+	Expiry time.Duration
+	// Destination path of the upload in Storage, "/" + upload.ID if nil
+	Destination func(req *http.Request, upload *Upload) (string, error)
+	// OnComplete called once an upload has been stored
+	OnComplete func(upload *Upload, object *ofs.Object)
+
+	mutex  sync.Mutex
+	locked map[string]bool
+}
+
+// New initialize a Handler of storage
+func New(storage ofs.StorageInterface) *Handler {
+	return &Handler{Storage: storage}
+}
+
+func (handler *Handler) stateStorage() ofs.StorageInterface {
+	if handler.StateStorage != nil {
+		return handler.StateStorage
+	}
+	return handler.Storage
+}
+
+func (handler *Handler) uploadDir() string {
+	if handler.UploadDir != "" {
+		return handler.UploadDir
+	}
+	return DefaultUploadDir
+}
+
+func (handler *Handler) expiry() time.Duration {
+	if handler.Expiry > 0 {
+		return handler.Expiry
+	}
+	return DefaultExpiry
+}
+
+// lock lock upload id, return false if it is locked by another request already
+func (handler *Handler) lock(id string) bool {
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+
+	if handler.locked == nil {
+		handler.locked = map[string]bool{}
+	}
+	if handler.locked[id] {
+		return false
+	}
+	handler.locked[id] = true
+	return true
+}
+
+func (handler *Handler) unlock(id string) {
+	handler.mutex.Lock()
+	delete(handler.locked, id)
+	handler.mutex.Unlock()
+}
+
+// ServeHTTP serve tus requests
+func (handler *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	method := req.Method
+	if override := req.Header.Get("X-HTTP-Method-Override"); override != "" {
+		method = strings.ToUpper(override)
+	}
+
+	header := w.Header()
+	header.Set("Tus-Resumable", Version)
+
+	if method == http.MethodOptions {
+		header.Set("Tus-Version", Version)
+		header.Set("Tus-Extension", Extensions)
+		if handler.MaxSize > 0 {
+			header.Set("Tus-Max-Size", strconv.FormatInt(handler.MaxSize, 10))
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if req.Header.Get("Tus-Resumable") != Version {
+		header.Set("Tus-Version", Version)
+		http.Error(w, "unsupported tus version", http.StatusPreconditionFailed)
+		return
+	}
+
+	id := strings.Trim(req.URL.Path, "/")
+	if id == "" {
+		if method != http.MethodPost {
+			header.Set("Allow", "OPTIONS, POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		handler.create(w, req)
+		return
+	}
+
+	if !validID(id) {
+		http.NotFound(w, req)
+		return
+	}
+
+	switch method {
+	case http.MethodHead:
+		handler.head(w, req, id)
+	case http.MethodPatch:
+		handler.patch(w, req, id)
+	case http.MethodDelete:
+		handler.terminate(w, req, id)
+	default:
+		header.Set("Allow", "OPTIONS, HEAD, PATCH, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// create handle POST requests of the creation extension
+func (handler *Handler) create(w http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("Upload-Defer-Length") != "" {
+		http.Error(w, "deferred length isn't supported", http.StatusBadRequest)
+		return
+	}
+
+	length, err := parseLength(req.Header.Get("Upload-Length"))
+	if err != nil {
+		http.Error(w, "Upload-Length: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if handler.MaxSize > 0 && length > handler.MaxSize {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	metadata, err := parseMetadata(req.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, "Upload-Metadata: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	upload := &Upload{
+		ID:        newID(),
+		Length:    length,
+		Metadata:  metadata,
+		ExpiresAt: time.Now().Add(handler.expiry()).UTC(),
+	}
+
+	upload.Path = "/" + upload.ID
+	if handler.Destination != nil {
+		if upload.Path, err = handler.Destination(req, upload); err != nil {
+			serveError(w, err)
+			return
+		}
+	}
+
+	options := &ofs.PutOptions{ContentType: metadata["filetype"]}
+	if upload.UploadID, err = handler.uploader().CreateUpload(req.Context(), upload.Path, options); err != nil {
+		serveError(w, err)
+		return
+	}
+
+	if err = handler.saveUpload(req.Context(), upload); err != nil {
+		handler.uploader().AbortUpload(req.Context(), upload.Path, upload.UploadID)
+		serveError(w, err)
+		return
+	}
+
+	handler.lock(upload.ID)
+	defer handler.unlock(upload.ID)
+
+	w.Header().Set("Location", handler.location(req, upload.ID))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+
+	// creation-with-upload, empty uploads are completed right away
+	if req.Header.Get("Content-Type") == offsetContentType || length == 0 {
+		if status := handler.write(w, req, upload, 0); status != 0 {
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// location URL of upload id
+func (handler *Handler) location(req *http.Request, id string) string {
+	base := handler.BasePath
+	if base == "" {
+		// RequestURI keeps prefixes removed by http.StripPrefix
+		if u, err := url.ParseRequestURI(req.RequestURI); err == nil {
+			base = u.Path
+		} else {
+			base = req.URL.Path
+		}
+	}
+	return strings.TrimSuffix(base, "/") + "/" + id
+}
+
+// load load upload id, expired uploads are terminated, reply with an error status and return nil if it isn't available
+func (handler *Handler) load(w http.ResponseWriter, req *http.Request, id string) *Upload {
+	upload, err := handler.loadUpload(req.Context(), id)
+	if err != nil {
+		serveError(w, err)
+		return nil
+	}
+
+	if upload.Expired() {
+		handler.remove(req.Context(), upload)
+		http.Error(w, "upload expired", http.StatusGone)
+		return nil
+	}
+	return upload
+}
+
+// offset current offset of upload
+func (handler *Handler) offset(ctx context.Context, upload *Upload) (int64, error) {
+	if upload.Completed {
+		return upload.Length, nil
+	}
+	return handler.uploader().UploadOffset(ctx, upload.Path, upload.UploadID)
+}
+
+// head handle HEAD requests, reply with the upload's offset
+func (handler *Handler) head(w http.ResponseWriter, req *http.Request, id string) {
+	upload := handler.load(w, req, id)
+	if upload == nil {
+		return
+	}
+
+	offset, err := handler.offset(req.Context(), upload)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Cache-Control", "no-store")
+	header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	header.Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	header.Set("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	if len(upload.Metadata) > 0 {
+		header.Set("Upload-Metadata", encodeMetadata(upload.Metadata))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// patch handle PATCH requests, append the body to the upload
+func (handler *Handler) patch(w http.ResponseWriter, req *http.Request, id string) {
+	if req.Header.Get("Content-Type") != offsetContentType {
+		http.Error(w, "Content-Type should be "+offsetContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	offset, err := parseLength(req.Header.Get("Upload-Offset"))
+	if err != nil {
+		http.Error(w, "Upload-Offset: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !handler.lock(id) {
+		http.Error(w, "upload is locked by another request", http.StatusLocked)
+		return
+	}
+	defer handler.unlock(id)
+
+	upload := handler.load(w, req, id)
+	if upload == nil {
+		return
+	}
+
+	if status := handler.write(w, req, upload, offset); status != 0 {
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// write append req's body to upload at offset, and complete the upload once all data is received,
+// return the status of the error that has been replied, or 0 on success
+func (handler *Handler) write(w http.ResponseWriter, req *http.Request, upload *Upload, offset int64) int {
+	current, err := handler.offset(req.Context(), upload)
+	if err != nil {
+		return serveError(w, err)
+	}
+	if current != offset {
+		http.Error(w, "Upload-Offset should be "+strconv.FormatInt(current, 10), http.StatusConflict)
+		return http.StatusConflict
+	}
+
+	upload.Offset = offset
+	remaining := upload.Length - offset
+	if req.ContentLength > remaining {
+		http.Error(w, "body exceeds Upload-Length", http.StatusRequestEntityTooLarge)
+		return http.StatusRequestEntityTooLarge
+	}
+
+	if remaining > 0 && !upload.Completed {
+		n, err := handler.uploader().WriteUpload(req.Context(), upload.Path, upload.UploadID, offset, io.LimitReader(req.Body, remaining))
+		upload.Offset = offset + n
+		if err != nil {
+			handler.saveUpload(req.Context(), upload)
+			return serveError(w, err)
+		}
+	}
+
+	if upload.Offset == upload.Length && !upload.Completed {
+		object, err := handler.uploader().CompleteUpload(req.Context(), upload.Path, upload.UploadID)
+		if err != nil {
+			return serveError(w, err)
+		}
+		upload.Completed = true
+
+		if handler.OnComplete != nil {
+			handler.OnComplete(upload, object)
+		}
+	}
+
+	if err = handler.saveUpload(req.Context(), upload); err != nil {
+		return serveError(w, err)
+	}
+	return 0
+}
+
+// terminate handle DELETE requests of the termination extension
+func (handler *Handler) terminate(w http.ResponseWriter, req *http.Request, id string) {
+	if !handler.lock(id) {
+		http.Error(w, "upload is locked by another request", http.StatusLocked)
+		return
+	}
+	defer handler.unlock(id)
+
+	upload, err := handler.loadUpload(req.Context(), id)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	if err = handler.remove(req.Context(), upload); err != nil {
+		serveError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// remove abort upload if it is unfinished, and remove its state
+func (handler *Handler) remove(ctx context.Context, upload *Upload) error {
+	if !upload.Completed {
+		if err := handler.uploader().AbortUpload(ctx, upload.Path, upload.UploadID); err != nil && !errors.Is(err, ofs.ErrNotFound) {
+			return err
+		}
+	}
+	return ofs.WithContext(handler.stateStorage()).DeleteWithContext(ctx, handler.statePath(upload.ID))
+}
+
+// CleanupExpired terminate expired uploads, call it periodically to remove data of abandoned uploads
+func (handler *Handler) CleanupExpired(ctx context.Context) error {
+	return ofs.Walk(ctx, handler.stateStorage(), handler.uploadDir(), ofs.ListOptions{}, func(object *ofs.Object) error {
+		id := strings.TrimSuffix(path.Base(object.Path), ".json")
+		if object.IsDir || !validID(id) || !handler.lock(id) {
+			return nil
+		}
+		defer handler.unlock(id)
+
+		upload, err := handler.loadUpload(ctx, id)
+		if err != nil || !upload.Expired() {
+			return err
+		}
+		return handler.remove(ctx, upload)
+	})
+}
+
+// serveError reply with the status code of err, return the status
+func serveError(w http.ResponseWriter, err error) int {
+	status := ofs.HTTPStatus(err)
+	http.Error(w, http.StatusText(status), status)
+	return status
+}
+
+// newID random id of an upload
+func newID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
+
+func validID(id string) bool {
+	decoded, err := hex.DecodeString(id)
+	return err == nil && len(decoded) == 16
+}
+
+// parseMetadata parse Upload-Metadata header, comma separated pairs of key and base64 encoded value
+func parseMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		switch len(fields) {
+		case 0:
+			continue
+		case 1:
+			metadata[fields[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, errors.New("invalid value of " + fields[0])
+			}
+			metadata[fields[0]] = string(value)
+		default:
+			return nil, errors.New("invalid pair " + strconv.Quote(pair))
+		}
+	}
+	return metadata, nil
+}
+
+func base64Encode(value string) string {
+	return base64.StdEncoding.EncodeToString([]byte(value))
+}
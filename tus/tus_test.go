@@ -0,0 +1,316 @@
+package tus_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MayCMF/ofs"
+	s3 "github.com/MayCMF/ofs/awss3"
+	"github.com/MayCMF/ofs/awss3/s3test"
+	fs "github.com/MayCMF/ofs/filesystem"
+	"github.com/MayCMF/ofs/memory"
+	"github.com/MayCMF/ofs/tus"
+)
+
+func request(handler http.Handler, method, path string, body []byte, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("Tus-Resumable", tus.Version)
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func patch(handler http.Handler, location string, offset int, chunk []byte) *httptest.ResponseRecorder {
+	return request(handler, http.MethodPatch, location, chunk, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": strconv.Itoa(offset),
+	})
+}
+
+func create(t *testing.T, handler http.Handler, length int) string {
+	resp := request(handler, http.MethodPost, "/files/", nil, map[string]string{
+		"Upload-Length":   strconv.Itoa(length),
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("report.txt")) + ",filetype " + base64.StdEncoding.EncodeToString([]byte("text/x-report")) + ",private",
+	})
+	if resp.Code != http.StatusCreated || !strings.HasPrefix(resp.Header().Get("Location"), "/files/") || resp.Header().Get("Upload-Expires") == "" {
+		t.Fatalf("POST should create an upload, but got %v %v", resp.Code, resp.Header())
+	}
+	return resp.Header().Get("Location")
+}
+
+func testUpload(t *testing.T, storage ofs.StorageInterface, content []byte, chunkSize int) {
+	var (
+		handler   = tus.New(storage)
+		completed *ofs.Object
+	)
+	handler.OnComplete = func(upload *tus.Upload, object *ofs.Object) { completed = object }
+	server := http.StripPrefix("/files", handler)
+
+	location := create(t, server, len(content))
+
+	resp := request(server, http.MethodHead, location, nil, nil)
+	if resp.Code != http.StatusOK || resp.Header().Get("Upload-Offset") != "0" || resp.Header().Get("Upload-Length") != strconv.Itoa(len(content)) ||
+		!strings.Contains(resp.Header().Get("Upload-Metadata"), "filename "+base64.StdEncoding.EncodeToString([]byte("report.txt"))) {
+		t.Errorf("HEAD should return the upload's offset, but got %v %v", resp.Code, resp.Header())
+	}
+
+	for offset := 0; offset < len(content); offset += chunkSize {
+		end := offset + chunkSize
+		if end > len(content) {
+			end = len(content)
+		}
+
+		if resp := patch(server, location, offset+1, content[offset:end]); resp.Code != http.StatusConflict {
+			t.Errorf("PATCH at wrong offset should conflict, but got %v", resp.Code)
+		}
+
+		if resp := patch(server, location, offset, content[offset:end]); resp.Code != http.StatusNoContent || resp.Header().Get("Upload-Offset") != strconv.Itoa(end) {
+			t.Fatalf("PATCH should append the chunk, but got %v %v %v", resp.Code, resp.Header(), resp.Body.String())
+		}
+
+		if end < len(content) {
+			if resp := request(server, http.MethodHead, location, nil, nil); resp.Header().Get("Upload-Offset") != strconv.Itoa(end) {
+				t.Errorf("HEAD should return offset %v, but got %v", end, resp.Header().Get("Upload-Offset"))
+			}
+			if completed != nil {
+				t.Errorf("upload shouldn't be completed before all data is received")
+			}
+		}
+	}
+
+	if completed == nil {
+		t.Fatalf("upload should be completed")
+	}
+
+	object, err := storage.Stat(completed.Path)
+	if err != nil || object.Size != int64(len(content)) || object.ContentType != "text/x-report" {
+		t.Errorf("completed upload should be stored with its content type, but got %+v, %v", object, err)
+	}
+
+	stream, err := storage.GetStream(completed.Path)
+	if err != nil {
+		t.Fatalf("GetStream fail %v", err)
+	}
+	defer stream.Close()
+	if data, _ := ioutil.ReadAll(stream); !bytes.Equal(data, content) {
+		t.Errorf("stored content should be the uploaded content, but got %v bytes", len(data))
+	}
+
+	if resp := request(server, http.MethodHead, location, nil, nil); resp.Header().Get("Upload-Offset") != strconv.Itoa(len(content)) {
+		t.Errorf("HEAD of completed upload should return its length, but got %v", resp.Header().Get("Upload-Offset"))
+	}
+
+	if resp := request(server, http.MethodDelete, location, nil, nil); resp.Code != http.StatusNoContent {
+		t.Errorf("DELETE should remove the upload state, but got %v", resp.Code)
+	}
+	if _, err := storage.Stat(completed.Path); err != nil {
+		t.Errorf("DELETE of completed upload should keep the object, but got %v", err)
+	}
+}
+
+func TestUploadWithMemory(t *testing.T) {
+	testUpload(t, memory.New(), bytes.Repeat([]byte("0123456789"), 1000), 3000)
+}
+
+func TestUploadWithFileSystem(t *testing.T) {
+	testUpload(t, fs.New(t.TempDir()), bytes.Repeat([]byte("0123456789"), 1000), 3000)
+}
+
+func TestUploadWithS3(t *testing.T) {
+	server := s3test.NewServer("ofs")
+	defer server.Close()
+
+	client := s3.New(server.Config("ofs"))
+	// parts are 5MB, chunks are staged until they fill a part
+	testUpload(t, client, bytes.Repeat([]byte("0123456789"), 1200*1024), 2*1024*1024)
+
+	if server.PendingUploads() != 0 {
+		t.Errorf("multipart uploads should be completed, but %v are pending", server.PendingUploads())
+	}
+	if objects, _ := client.List(s3.UploadStagingPrefix); len(objects) != 0 {
+		t.Errorf("staged tails should be removed, but got %v", len(objects))
+	}
+}
+
+func TestProtocol(t *testing.T) {
+	storage := memory.New()
+	handler := tus.New(storage)
+	handler.MaxSize = 100
+
+	if resp := request(handler, http.MethodOptions, "/", nil, nil); resp.Code != http.StatusNoContent || resp.Header().Get("Tus-Version") != tus.Version ||
+		resp.Header().Get("Tus-Extension") != tus.Extensions || resp.Header().Get("Tus-Max-Size") != "100" {
+		t.Errorf("OPTIONS should describe the server, but got %v %v", resp.Code, resp.Header())
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("Upload-Length", "10")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusPreconditionFailed {
+		t.Errorf("requests without Tus-Resumable should fail, but got %v", recorder.Code)
+	}
+
+	if resp := request(handler, http.MethodPost, "/", nil, map[string]string{"Upload-Length": "101"}); resp.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("uploads larger than MaxSize should be rejected, but got %v", resp.Code)
+	}
+
+	if resp := request(handler, http.MethodPost, "/", nil, nil); resp.Code != http.StatusBadRequest {
+		t.Errorf("uploads without Upload-Length should be rejected, but got %v", resp.Code)
+	}
+
+	if resp := request(handler, http.MethodPost, "/", nil, map[string]string{"Upload-Length": "10", "Upload-Metadata": "filename !!!"}); resp.Code != http.StatusBadRequest {
+		t.Errorf("invalid metadata should be rejected, but got %v", resp.Code)
+	}
+
+	// creation-with-upload
+	resp := request(handler, http.MethodPost, "/", []byte("Hello"), map[string]string{"Upload-Length": "10", "Content-Type": "application/offset+octet-stream"})
+	if resp.Code != http.StatusCreated || resp.Header().Get("Upload-Offset") != "5" {
+		t.Errorf("POST with body should store the first chunk, but got %v %v", resp.Code, resp.Header())
+	}
+	location := resp.Header().Get("Location")
+
+	if resp := request(handler, http.MethodPatch, location, []byte("World"), map[string]string{"Upload-Offset": "5"}); resp.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("PATCH without offset content type should be rejected, but got %v", resp.Code)
+	}
+
+	if resp := patch(handler, location, 5, []byte("World!")); resp.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("PATCH exceeding Upload-Length should be rejected, but got %v", resp.Code)
+	}
+
+	// termination
+	if resp := request(handler, http.MethodDelete, location, nil, nil); resp.Code != http.StatusNoContent {
+		t.Errorf("DELETE should terminate the upload, but got %v", resp.Code)
+	}
+	if resp := request(handler, http.MethodHead, location, nil, nil); resp.Code != http.StatusNotFound {
+		t.Errorf("terminated upload should be not found, but got %v", resp.Code)
+	}
+	if objects, _ := storage.List("/"); len(objects) != 0 {
+		t.Errorf("terminated upload shouldn't leave objects, but got %v", len(objects))
+	}
+
+	if resp := request(handler, http.MethodHead, "/../../etc", nil, nil); resp.Code != http.StatusNotFound {
+		t.Errorf("invalid upload id should be not found, but got %v", resp.Code)
+	}
+
+	// empty uploads are completed on creation
+	resp = request(handler, http.MethodPost, "/", nil, map[string]string{"Upload-Length": "0"})
+	if id := strings.TrimPrefix(resp.Header().Get("Location"), "/"); resp.Code != http.StatusCreated {
+		t.Errorf("empty upload should be created, but got %v", resp.Code)
+	} else if object, err := storage.Stat("/" + id); err != nil || object.Size != 0 {
+		t.Errorf("empty upload should be stored, but got %+v, %v", object, err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	storage := memory.New()
+	handler := tus.New(storage)
+	handler.Expiry = time.Millisecond
+
+	var locations []string
+	for i := 0; i < 2; i++ {
+		resp := request(handler, http.MethodPost, "/", []byte("Hello"), map[string]string{"Upload-Length": "10", "Content-Type": "application/offset+octet-stream"})
+		locations = append(locations, resp.Header().Get("Location"))
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	if resp := patch(handler, locations[0], 5, []byte("World")); resp.Code != http.StatusGone {
+		t.Errorf("expired upload should be gone, but got %v", resp.Code)
+	}
+
+	if err := handler.CleanupExpired(context.Background()); err != nil {
+		t.Errorf("CleanupExpired fail %v", err)
+	}
+
+	if objects, _ := storage.List("/"); len(objects) != 0 {
+		t.Errorf("expired uploads should be removed, but got %v", fmt.Sprint(len(objects)))
+	}
+}
+
+func TestStateStorage(t *testing.T) {
+	var (
+		storage, state = memory.New(), memory.New()
+		handler        = tus.New(storage)
+	)
+	handler.StateStorage = state
+
+	resp := request(handler, http.MethodPost, "/", []byte("Hello"), map[string]string{"Upload-Length": "10", "Content-Type": "application/offset+octet-stream"})
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("POST should create an upload, but got %v", resp.Code)
+	}
+	if objects, _ := storage.List("/"); len(objects) != 0 {
+		t.Errorf("states and chunks should be kept out of Storage, but got %v", len(objects))
+	}
+	if objects, _ := state.List(tus.DefaultUploadDir); len(objects) == 0 {
+		t.Errorf("states and chunks should be stored in StateStorage")
+	}
+
+	if resp := patch(handler, resp.Header().Get("Location"), 5, []byte("World")); resp.Code != http.StatusNoContent {
+		t.Fatalf("PATCH should complete the upload, but got %v %v", resp.Code, resp.Body.String())
+	}
+	if objects, _ := storage.List("/"); len(objects) != 1 {
+		t.Errorf("completed upload should be stored in Storage, but got %v objects", len(objects))
+	}
+}
+
+// brokenBody returns data, then fails like a dropped connection
+type brokenBody struct {
+	data []byte
+}
+
+func (body *brokenBody) Read(p []byte) (int, error) {
+	if len(body.data) == 0 {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, body.data)
+	body.data = body.data[n:]
+	return n, nil
+}
+
+func TestInterruptedChunk(t *testing.T) {
+	var (
+		storage   = memory.New()
+		handler   = tus.New(storage)
+		completed *ofs.Object
+	)
+	handler.OnComplete = func(upload *tus.Upload, object *ofs.Object) { completed = object }
+	server := http.StripPrefix("/files", handler)
+	location := create(t, server, 10)
+
+	req := httptest.NewRequest(http.MethodPatch, location, &brokenBody{data: []byte("Hello")})
+	req.Header.Set("Tus-Resumable", tus.Version)
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", "0")
+	server.ServeHTTP(httptest.NewRecorder(), req)
+
+	if resp := request(server, http.MethodHead, location, nil, nil); resp.Header().Get("Upload-Offset") != "5" {
+		t.Errorf("data received before the connection failed should be kept, but got offset %v", resp.Header().Get("Upload-Offset"))
+	}
+
+	if resp := patch(server, location, 5, []byte("World")); resp.Code != http.StatusNoContent {
+		t.Fatalf("PATCH should resume the upload, but got %v %v", resp.Code, resp.Body.String())
+	}
+	if completed == nil {
+		t.Fatalf("resumed upload should be completed")
+	}
+	stream, err := storage.GetStream(completed.Path)
+	if err != nil {
+		t.Fatalf("GetStream fail %v", err)
+	}
+	defer stream.Close()
+	if data, _ := ioutil.ReadAll(stream); string(data) != "HelloWorld" {
+		t.Errorf("resumed upload should be stored, but got %q", data)
+	}
+}
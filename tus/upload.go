@@ -0,0 +1,290 @@
+package tus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MayCMF/ofs"
+)
+
+// Upload state of an upload, it is stored as JSON under Handler.UploadDir
+type Upload struct {
+	// ID id of the upload in URLs
+	ID string `json:"id"`
+	// Path destination of the upload in the storage
+	Path string `json:"path"`
+	// Length total size of the upload
+	Length int64 `json:"length"`
+	// Offset number of bytes received when the state was saved
+	Offset int64 `json:"offset"`
+	// Metadata decoded Upload-Metadata of the creation request
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	Completed bool              `json:"completed,omitempty"`
+
+	// UploadID id of the storage's resumable upload
+	UploadID string `json:"upload_id"`
+}
+
+// Expired report whether the upload expired
+func (upload *Upload) Expired() bool {
+	return !upload.ExpiresAt.IsZero() && time.Now().After(upload.ExpiresAt)
+}
+
+// statePath path of the state of upload id
+func (handler *Handler) statePath(id string) string {
+	return ofs.DirPrefix(handler.uploadDir()) + id + ".json"
+}
+
+func (handler *Handler) saveUpload(ctx context.Context, upload *Upload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	return putPrivate(ctx, handler.stateStorage(), handler.statePath(upload.ID), bytes.NewReader(data))
+}
+
+// putPrivate store internal data of uploads, with a private ACL if storage supports PutOptions
+func putPrivate(ctx context.Context, storage ofs.StorageInterface, path string, reader io.Reader) error {
+	var options *ofs.PutOptions
+	if _, ok := storage.(ofs.OptionsPutter); ok {
+		options = &ofs.PutOptions{ACL: ofs.ACLPrivate}
+	}
+	_, err := ofs.PutWithOptions(ctx, storage, path, reader, options)
+	return err
+}
+
+func (handler *Handler) loadUpload(ctx context.Context, id string) (*Upload, error) {
+	stream, err := ofs.WithContext(handler.stateStorage()).GetStreamWithContext(ctx, handler.statePath(id))
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	upload := &Upload{}
+	if err = json.NewDecoder(stream).Decode(upload); err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// uploader return the storage's resumable uploads, or stage chunks as objects under UploadDir of StateStorage if it has none
+func (handler *Handler) uploader() ofs.ResumableUploader {
+	if uploader, ok := ofs.AsResumableUploader(handler.Storage); ok {
+		return uploader
+	}
+	return chunkUploader{storage: handler.Storage, staging: handler.stateStorage(), dir: ofs.DirPrefix(handler.uploadDir()) + "chunks"}
+}
+
+// chunkUploader stage every written chunk as an object of staging, chunks are concatenated into the destination in storage
+// on completion, it is used for storages that don't implement ofs.ResumableUploader
+type chunkUploader struct {
+	storage ofs.StorageInterface
+	staging ofs.StorageInterface
+	dir     string
+}
+
+// chunkOptions object that keeps the PutOptions of an upload
+const chunkOptions = "options.json"
+
+func (uploader chunkUploader) uploadDir(uploadID string) string {
+	return ofs.DirPrefix(uploader.dir) + uploadID
+}
+
+// chunks staged chunk objects sorted by offset, their names are zero padded offsets
+func (uploader chunkUploader) chunks(ctx context.Context, uploadID string) ([]*ofs.Object, int64, error) {
+	var (
+		chunks []*ofs.Object
+		size   int64
+	)
+
+	err := ofs.Walk(ctx, uploader.staging, uploader.uploadDir(uploadID), ofs.ListOptions{}, func(object *ofs.Object) error {
+		if !object.IsDir && path.Base(object.Path) != chunkOptions {
+			chunks = append(chunks, object)
+			size += object.Size
+		}
+		return nil
+	})
+	sort.Slice(chunks, func(i, j int) bool { return path.Base(chunks[i].Path) < path.Base(chunks[j].Path) })
+	return chunks, size, err
+}
+
+func (uploader chunkUploader) CreateUpload(ctx context.Context, path string, options *ofs.PutOptions) (string, error) {
+	var (
+		uploadID = newID()
+		data     = []byte("{}")
+		err      error
+	)
+
+	if options != nil {
+		if data, err = json.Marshal(options); err != nil {
+			return "", err
+		}
+	}
+
+	return uploadID, putPrivate(ctx, uploader.staging, uploader.uploadDir(uploadID)+"/"+chunkOptions, bytes.NewReader(data))
+}
+
+func (uploader chunkUploader) UploadOffset(ctx context.Context, path, uploadID string) (int64, error) {
+	_, size, err := uploader.chunks(ctx, uploadID)
+	return size, err
+}
+
+func (uploader chunkUploader) WriteUpload(ctx context.Context, path, uploadID string, offset int64, reader io.Reader) (int64, error) {
+	size, err := uploader.UploadOffset(ctx, path, uploadID)
+	if err != nil {
+		return 0, err
+	}
+	if size != offset {
+		return 0, ofs.NewError("write upload", path, ofs.ErrOffsetMismatch, nil)
+	}
+
+	// only store non-empty chunks, chunks whose reader fails midway are stored up to the failure
+	head := make([]byte, 1)
+	n, err := io.ReadFull(reader, head)
+	if n == 0 {
+		if err == io.EOF {
+			err = nil
+		}
+		return 0, err
+	}
+
+	counter := &countingReader{reader: io.MultiReader(bytes.NewReader(head[:n]), reader)}
+	chunkPath := fmt.Sprintf("%v/%020d", uploader.uploadDir(uploadID), offset)
+	if err = putPrivate(ctx, uploader.staging, chunkPath, counter); err != nil {
+		return 0, err
+	}
+	return counter.n, counter.err
+}
+
+func (uploader chunkUploader) CompleteUpload(ctx context.Context, path, uploadID string) (*ofs.Object, error) {
+	chunks, _, err := uploader.chunks(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	options := &ofs.PutOptions{}
+	stream, err := ofs.WithContext(uploader.staging).GetStreamWithContext(ctx, uploader.uploadDir(uploadID)+"/"+chunkOptions)
+	if err != nil {
+		return nil, err
+	}
+	err = json.NewDecoder(stream).Decode(options)
+	stream.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	reader := &chunksReader{ctx: ctx, storage: uploader.staging, chunks: chunks}
+	defer reader.Close()
+
+	object, err := ofs.PutWithOptions(ctx, uploader.storage, path, reader, options)
+	if err != nil {
+		return nil, err
+	}
+	return object, uploader.AbortUpload(ctx, path, uploadID)
+}
+
+func (uploader chunkUploader) AbortUpload(ctx context.Context, path, uploadID string) error {
+	chunks, _, err := uploader.chunks(ctx, uploadID)
+	if err != nil {
+		return err
+	}
+
+	storage := ofs.WithContext(uploader.staging)
+	for _, chunk := range chunks {
+		if err := storage.DeleteWithContext(ctx, chunk.Path); err != nil {
+			return err
+		}
+	}
+	return storage.DeleteWithContext(ctx, uploader.uploadDir(uploadID)+"/"+chunkOptions)
+}
+
+// chunksReader read chunks one after another
+type chunksReader struct {
+	ctx     context.Context
+	storage ofs.StorageInterface
+	chunks  []*ofs.Object
+	current io.ReadCloser
+}
+
+func (reader *chunksReader) Read(p []byte) (int, error) {
+	for {
+		if reader.current == nil {
+			if len(reader.chunks) == 0 {
+				return 0, io.EOF
+			}
+
+			stream, err := ofs.WithContext(reader.storage).GetStreamWithContext(reader.ctx, reader.chunks[0].Path)
+			if err != nil {
+				return 0, err
+			}
+			reader.current, reader.chunks = stream, reader.chunks[1:]
+		}
+
+		n, err := reader.current.Read(p)
+		if err == io.EOF {
+			reader.current.Close()
+			reader.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (reader *chunksReader) Close() error {
+	if reader.current != nil {
+		return reader.current.Close()
+	}
+	return nil
+}
+
+type countingReader struct {
+	reader io.Reader
+	n      int64
+	// err read error, it is reported as EOF, so the data read before is stored
+	err error
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += int64(n)
+	if err != nil && err != io.EOF {
+		r.err, err = err, io.EOF
+	}
+	return n, err
+}
+
+// encodeMetadata encode metadata as Upload-Metadata header
+func encodeMetadata(metadata map[string]string) string {
+	pairs := make([]string, 0, len(metadata))
+	for key, value := range metadata {
+		if value == "" {
+			pairs = append(pairs, key)
+		} else {
+			pairs = append(pairs, key+" "+base64Encode(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// parseLength parse a non-negative integer header
+func parseLength(value string) (int64, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.New("invalid length " + strconv.Quote(value))
+	}
+	return n, nil
+}
@@ -0,0 +1,42 @@
+package ofs
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrOffsetMismatch returned when data is written to a resumable upload at another offset than its current size
+var ErrOffsetMismatch = errors.New("ofs: upload offset mismatch")
+
+// ResumableUploader implemented by storages that could stage an object across several requests, e.g. with S3 multipart uploads,
+// staged data isn't visible at path until CompleteUpload
+type ResumableUploader interface {
+	// CreateUpload start staging an object of path, return the upload's id, options are applied to the object on completion
+	CreateUpload(ctx context.Context, path string, options *PutOptions) (uploadID string, err error)
+	// UploadOffset return the number of bytes staged
+	UploadOffset(ctx context.Context, path, uploadID string) (int64, error)
+	// WriteUpload append reader to the staged data, offset must equal the staged size, otherwise ErrOffsetMismatch is returned,
+	// return the number of bytes staged from reader, which are kept even if reading fails midway
+	WriteUpload(ctx context.Context, path, uploadID string, offset int64, reader io.Reader) (int64, error)
+	// CompleteUpload store the staged data at path
+	CompleteUpload(ctx context.Context, path, uploadID string) (*Object, error)
+	// AbortUpload discard the staged data
+	AbortUpload(ctx context.Context, path, uploadID string) error
+}
+
+// ResumableUploadsWrapper implemented by wrappers that implement ResumableUploader by forwarding it to the storage they wrap,
+// so they only support resumable uploads if that storage does
+type ResumableUploadsWrapper interface {
+	// ResumableUploads return the wrapper as ResumableUploader if the wrapped storage supports resumable uploads
+	ResumableUploads() (ResumableUploader, bool)
+}
+
+// AsResumableUploader return storage's resumable uploads if it supports them, see ResumableUploadsWrapper
+func AsResumableUploader(storage StorageInterface) (ResumableUploader, bool) {
+	if wrapper, ok := storage.(ResumableUploadsWrapper); ok {
+		return wrapper.ResumableUploads()
+	}
+	uploader, ok := storage.(ResumableUploader)
+	return uploader, ok
+}
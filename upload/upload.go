@@ -0,0 +1,370 @@
+// Package upload stores files of multipart/form-data requests into ofs storages, validating their size and sniffed content types
+package upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/MayCMF/ofs"
+)
+
+// DefaultMaxSize default maximum size of an uploaded file
+const DefaultMaxSize = 32 << 20
+
+// sniffLen number of bytes content types are sniffed from, see http.DetectContentType
+const sniffLen = 512
+
+// maxCollisionAttempts number of names tried by CollisionSuffix and CollisionUUID before giving up with ofs.ErrExists
+const maxCollisionAttempts = 100
+
+var (
+	// ErrTooLarge returned when a file exceeds Handler.MaxSize
+	ErrTooLarge = errors.New("upload: file too large")
+	// ErrTypeNotAllowed returned when the sniffed content type of a file isn't in Handler.AllowedTypes
+	ErrTypeNotAllowed = errors.New("upload: content type not allowed")
+)
+
+// Collision strategy of naming files whose sanitized name is taken already, except CollisionOverwrite names are claimed by storing
+// an empty placeholder create-only before the file is written, so concurrent uploads of the same name get different names.
+// That is only race free with storages implementing ofs.OptionsPutter whose CreateOnly is atomic, e.g. FileSystem and memory,
+// names of other storages are probed with Stat, so concurrent uploads could still overwrite each other
+type Collision int
+
+const (
+	// CollisionOverwrite replace the existing file
+	CollisionOverwrite Collision = iota
+	// CollisionSuffix append a counter to the name, e.g. `report-1.pdf`
+	CollisionSuffix
+	// CollisionUUID name every file with a random UUID, keeping the extension, e.g. `0b7e3f5c-6f1d-4b8a-9d0e-1c2b3a4d5e6f.pdf`
+	CollisionUUID
+)
+
+// Handler http.Handler that stores files of multipart/form-data POST requests into Dir of Storage,
+// files are streamed into the storage part by part without buffering the request
+type Handler struct {
+	Storage ofs.StorageInterface
+	// Dir directory files are stored in
+	Dir string
+	// Field only store files of this form field, files of all fields if empty
+	Field string
+	// MaxSize maximum size of a file, DefaultMaxSize if zero
+	MaxSize int64
+	// AllowedTypes media types of allowed files, e.g. `image/png` or `image/*`, types are sniffed from the content with http.DetectContentType,
+	// so renaming a file doesn't bypass them, all types are allowed if empty
+	AllowedTypes []string
+	// Collision naming strategy of files whose name exists already
+	Collision Collision
+	// ErrorLog logger of internal errors, which are replied without details, the log package's standard logger if nil
+	ErrorLog *log.Logger
+}
+
+// New initialize a Handler storing files into dir of storage
+func New(storage ofs.StorageInterface, dir string) *Handler {
+	return &Handler{Storage: storage, Dir: dir}
+}
+
+// File description of a stored file
+type File struct {
+	// Field form field of the file
+	Field string `json:"field,omitempty"`
+	// Filename original file name sent by the client
+	Filename     string     `json:"filename"`
+	Path         string     `json:"path"`
+	URL          string     `json:"url,omitempty"`
+	Size         int64      `json:"size"`
+	ContentType  string     `json:"content_type"`
+	ETag         string     `json:"etag,omitempty"`
+	LastModified *time.Time `json:"last_modified,omitempty"`
+}
+
+func (handler *Handler) maxSize() int64 {
+	if handler.MaxSize > 0 {
+		return handler.MaxSize
+	}
+	return DefaultMaxSize
+}
+
+// ServeHTTP store files of the request, reply with JSON `{"files": [...]}` describing the stored files, or `{"error": "..."}`
+func (handler *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": http.StatusText(http.StatusMethodNotAllowed)})
+		return
+	}
+
+	reader, err := req.MultipartReader()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	files := []*File{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		if part.FileName() == "" || (handler.Field != "" && part.FormName() != handler.Field) {
+			part.Close()
+			continue
+		}
+
+		file, err := handler.Store(req.Context(), part.FileName(), part)
+		part.Close()
+		if err != nil {
+			handler.serveError(w, err, part.FileName(), handler.remove(files))
+			return
+		}
+		file.Field = part.FormName()
+		files = append(files, file)
+	}
+
+	if len(files) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "no file uploaded"})
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"files": files})
+}
+
+// remove remove files stored by a request that failed, return the files that couldn't be removed
+func (handler *Handler) remove(files []*File) []*File {
+	kept := []*File{}
+	for _, file := range files {
+		if err := handler.Storage.Delete(file.Path); err != nil {
+			handler.logf("upload: remove %v: %v", file.Path, err)
+			kept = append(kept, file)
+		}
+	}
+	return kept
+}
+
+// serveError reply with the status of err, details of internal errors are logged instead of replied,
+// kept are files of the request that have been stored and couldn't be removed
+func (handler *Handler) serveError(w http.ResponseWriter, err error, filename string, kept []*File) {
+	var (
+		status  = errorStatus(err)
+		message = err.Error()
+	)
+	if status >= http.StatusInternalServerError {
+		handler.logf("upload: store %v: %v", filename, err)
+		message = http.StatusText(status)
+	}
+	writeJSON(w, status, map[string]interface{}{"error": message, "filename": filename, "files": kept})
+}
+
+func (handler *Handler) logf(format string, args ...interface{}) {
+	if handler.ErrorLog != nil {
+		handler.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// Store validate reader and store it into Dir with the sanitized filename, named according to Collision
+func (handler *Handler) Store(ctx context.Context, filename string, reader io.Reader) (*File, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(reader, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if !handler.allowed(contentType) {
+		return nil, fmt.Errorf("%w: %v", ErrTypeNotAllowed, contentType)
+	}
+
+	storagePath, claimed, err := handler.claim(ctx, SanitizeFilename(filename))
+	if err != nil {
+		return nil, err
+	}
+	// remove the placeholder of the claimed name if the file isn't stored
+	release := func() {
+		if claimed {
+			handler.Storage.Delete(storagePath)
+		}
+	}
+
+	// options are only passed to storages that support them, others detect content types on their own
+	var options *ofs.PutOptions
+	if _, ok := handler.Storage.(ofs.OptionsPutter); ok {
+		options = &ofs.PutOptions{ContentType: contentType}
+	}
+
+	writer, err := ofs.OpenWriter(handler.Storage, storagePath, options)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	var (
+		maxSize = handler.maxSize()
+		body    = io.MultiReader(bytes.NewReader(head), ofs.ContextReader(ctx, reader))
+	)
+
+	written, err := io.Copy(writer, io.LimitReader(body, maxSize+1))
+	if err == nil && written > maxSize {
+		err = fmt.Errorf("%w: larger than %d bytes", ErrTooLarge, maxSize)
+	}
+	if err != nil {
+		writer.Abort()
+		release()
+		return nil, err
+	}
+	if err = writer.Close(); err != nil {
+		release()
+		return nil, err
+	}
+
+	file := &File{Filename: filename, Path: storagePath, Size: written, ContentType: contentType}
+	if object, err := ofs.WithContext(handler.Storage).StatWithContext(ctx, storagePath); err == nil {
+		file.Path, file.ETag, file.LastModified = "/"+strings.TrimPrefix(object.Path, "/"), object.ETag, object.LastModified
+		if object.ContentType != "" {
+			file.ContentType = object.ContentType
+		}
+	}
+	if url, err := ofs.WithContext(handler.Storage).GetURLWithContext(ctx, storagePath); err == nil {
+		file.URL = url
+	}
+	return file, nil
+}
+
+// allowed report whether contentType matches AllowedTypes
+func (handler *Handler) allowed(contentType string) bool {
+	if len(handler.AllowedTypes) == 0 {
+		return true
+	}
+
+	for _, allowed := range handler.AllowedTypes {
+		if allowed == contentType || allowed == "*/*" ||
+			(strings.HasSuffix(allowed, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(allowed, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// claim pick the path of filename in Dir according to Collision, return whether an empty placeholder has been stored to claim it
+func (handler *Handler) claim(ctx context.Context, filename string) (string, bool, error) {
+	dir := ofs.DirPrefix(handler.Dir)
+	if handler.Collision == CollisionOverwrite {
+		return dir + filename, false, nil
+	}
+
+	_, createOnly := handler.Storage.(ofs.OptionsPutter)
+	for i := 0; i < maxCollisionAttempts; i++ {
+		storagePath := handler.candidate(dir, filename, i)
+
+		if createOnly {
+			_, err := ofs.PutWithOptions(ctx, handler.Storage, storagePath, bytes.NewReader(nil), &ofs.PutOptions{CreateOnly: true})
+			if err == nil {
+				return storagePath, true, nil
+			}
+			if !errors.Is(err, ofs.ErrExists) {
+				return "", false, err
+			}
+			continue
+		}
+
+		_, err := ofs.WithContext(handler.Storage).StatWithContext(ctx, storagePath)
+		if errors.Is(err, ofs.ErrNotFound) {
+			return storagePath, false, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+	}
+	return "", false, ofs.NewError("upload", dir+filename, ofs.ErrExists, fmt.Errorf("no free name after %d attempts", maxCollisionAttempts))
+}
+
+// candidate name of attempt i of filename in dir according to Collision
+func (handler *Handler) candidate(dir, filename string, i int) string {
+	if handler.Collision == CollisionUUID {
+		return dir + newUUID() + strings.ToLower(path.Ext(filename))
+	}
+	if i == 0 {
+		return dir + filename
+	}
+
+	ext := path.Ext(filename)
+	return fmt.Sprintf("%v%v-%d%v", dir, strings.TrimSuffix(filename, ext), i, ext)
+}
+
+// SanitizeFilename make a client provided filename safe to store: directories are removed, reserved and control characters are replaced,
+// whitespace is replaced with `-`, leading and trailing dots are removed, and the name is limited to 255 bytes keeping its extension
+func SanitizeFilename(filename string) string {
+	// clients on Windows may send full paths
+	if idx := strings.LastIndexAny(filename, `/\`); idx >= 0 {
+		filename = filename[idx+1:]
+	}
+
+	filename = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsSpace(r):
+			return '-'
+		case r < 0x20 || r == 0x7f || strings.ContainsRune(`<>:"|?*`, r):
+			return '_'
+		}
+		return r
+	}, strings.ToValidUTF8(strings.TrimSpace(filename), "_"))
+
+	filename = strings.TrimRight(strings.TrimLeft(filename, ".-"), ".-")
+	if filename == "" {
+		return "file"
+	}
+
+	if len(filename) > 255 {
+		ext := path.Ext(filename)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		// drop a multi-byte character cut in half
+		filename = strings.ToValidUTF8(filename[:255-len(ext)], "") + ext
+	}
+	return filename
+}
+
+// newUUID random version 4 UUID
+func newUUID() string {
+	uuid := make([]byte, 16)
+	if _, err := rand.Read(uuid); err != nil {
+		panic(err)
+	}
+	uuid[6] = uuid[6]&0x0f | 0x40
+	uuid[8] = uuid[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
+
+// errorStatus HTTP status of an error returned by Store
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrTypeNotAllowed):
+		return http.StatusUnsupportedMediaType
+	}
+	return ofs.HTTPStatus(err)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
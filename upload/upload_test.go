@@ -0,0 +1,254 @@
+package upload_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/MayCMF/ofs"
+	"github.com/MayCMF/ofs/memory"
+	"github.com/MayCMF/ofs/upload"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+type response struct {
+	Files []upload.File `json:"files"`
+	Error string        `json:"error"`
+}
+
+// post send a multipart form with files, keys are field and filename separated by `:`
+func post(t *testing.T, handler http.Handler, files map[string][]byte) (int, response) {
+	var (
+		body   = &bytes.Buffer{}
+		writer = multipart.NewWriter(body)
+	)
+
+	writer.WriteField("title", "ignored")
+	for key, content := range files {
+		names := strings.SplitN(key, ":", 2)
+		part, err := writer.CreateFormFile(names[0], names[1])
+		if err != nil {
+			t.Fatalf("CreateFormFile fail %v", err)
+		}
+		part.Write(content)
+	}
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	var result response
+	if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+		t.Fatalf("response should be JSON, but got %q", recorder.Body.String())
+	}
+	return recorder.Code, result
+}
+
+func read(t *testing.T, storage *memory.Storage, path string) string {
+	stream, err := storage.GetStream(path)
+	if err != nil {
+		t.Fatalf("GetStream fail %v", err)
+	}
+	defer stream.Close()
+	content, _ := ioutil.ReadAll(stream)
+	return string(content)
+}
+
+func TestUpload(t *testing.T) {
+	storage := memory.New()
+	handler := upload.New(storage, "/uploads")
+	handler.AllowedTypes = []string{"image/*"}
+
+	code, result := post(t, handler, map[string][]byte{"avatar:../../My Photo.png": pngHeader})
+	if code != http.StatusCreated || len(result.Files) != 1 {
+		t.Fatalf("upload should succeed, but got %v %+v", code, result)
+	}
+
+	file := result.Files[0]
+	if file.Path != "/uploads/My-Photo.png" || file.Field != "avatar" || file.Filename != "My Photo.png" {
+		t.Errorf("file should be stored with sanitized name, but got %+v", file)
+	}
+	if file.Size != int64(len(pngHeader)) || file.ContentType != "image/png" || file.ETag == "" || file.LastModified == nil {
+		t.Errorf("response should describe the stored object, but got %+v", file)
+	}
+
+	if content := read(t, storage, "/uploads/My-Photo.png"); content != string(pngHeader) {
+		t.Errorf("stored content should match, but got %q", content)
+	}
+}
+
+func TestUploadValidation(t *testing.T) {
+	storage := memory.New()
+	handler := upload.New(storage, "/uploads")
+	handler.AllowedTypes = []string{"image/png"}
+	handler.MaxSize = 32
+
+	// the extension doesn't matter, the content is sniffed
+	if code, result := post(t, handler, map[string][]byte{"file:fake.png": []byte("<html><body>hi</body></html>")}); code != http.StatusUnsupportedMediaType || result.Error == "" {
+		t.Errorf("disallowed content should be rejected, but got %v %+v", code, result)
+	}
+
+	large := append(append([]byte{}, pngHeader...), bytes.Repeat([]byte{0}, 32)...)
+	if code, _ := post(t, handler, map[string][]byte{"file:large.png": large}); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("large file should be rejected, but got %v", code)
+	}
+
+	if objects, _ := storage.List("/uploads"); len(objects) != 0 {
+		t.Errorf("rejected files shouldn't be stored, but got %v", objects)
+	}
+
+	if code, _ := post(t, handler, map[string][]byte{}); code != http.StatusBadRequest {
+		t.Errorf("request without files should be rejected, but got %v", code)
+	}
+}
+
+func TestUploadCollision(t *testing.T) {
+	storage := memory.New()
+	handler := upload.New(storage, "/uploads")
+
+	handler.Collision = upload.CollisionSuffix
+	for _, want := range []string{"/uploads/a.txt", "/uploads/a-1.txt", "/uploads/a-2.txt"} {
+		if _, result := post(t, handler, map[string][]byte{"file:a.txt": []byte("a")}); len(result.Files) != 1 || result.Files[0].Path != want {
+			t.Errorf("file should be stored as %v, but got %+v", want, result)
+		}
+	}
+
+	handler.Collision = upload.CollisionUUID
+	uuid := regexp.MustCompile(`^/uploads/[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}\.txt$`)
+	if _, result := post(t, handler, map[string][]byte{"file:a.TXT": []byte("a")}); len(result.Files) != 1 || !uuid.MatchString(result.Files[0].Path) {
+		t.Errorf("file should be stored with a UUID name, but got %+v", result)
+	}
+
+	handler.Collision = upload.CollisionOverwrite
+	if _, result := post(t, handler, map[string][]byte{"file:a.txt": []byte("overwritten")}); len(result.Files) != 1 || result.Files[0].Path != "/uploads/a.txt" {
+		t.Errorf("file should be overwritten, but got %+v", result)
+	}
+	if content := read(t, storage, "/uploads/a.txt"); content != "overwritten" {
+		t.Errorf("content should be overwritten, but got %q", content)
+	}
+}
+
+func TestUploadCollisionConcurrently(t *testing.T) {
+	storage := memory.New()
+	handler := upload.New(storage, "/uploads")
+	handler.Collision = upload.CollisionSuffix
+
+	var (
+		wg    sync.WaitGroup
+		mutex sync.Mutex
+		paths = map[string]bool{}
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			file, err := handler.Store(context.Background(), "a.txt", strings.NewReader(fmt.Sprint(i)))
+			if err != nil {
+				t.Errorf("Store fail %v", err)
+				return
+			}
+			mutex.Lock()
+			paths[file.Path] = true
+			mutex.Unlock()
+		}(i)
+	}
+	wg.Wait()
+
+	if objects, _ := storage.List("/uploads"); len(paths) != 10 || len(objects) != 10 {
+		t.Errorf("concurrent uploads of one name should be stored under different names, but got %v", paths)
+	}
+}
+
+// failingStorage fail Put of paths containing `fail` with an error revealing a server path, it hides optional capabilities
+type failingStorage struct {
+	ofs.StorageInterface
+}
+
+func (storage failingStorage) Put(path string, reader io.Reader) (*ofs.Object, error) {
+	if strings.Contains(path, "fail") {
+		ioutil.ReadAll(reader)
+		return nil, &os.PathError{Op: "open", Path: "/srv/secret" + path, Err: os.ErrClosed}
+	}
+	return storage.StorageInterface.Put(path, reader)
+}
+
+func TestUploadFailure(t *testing.T) {
+	var (
+		storage = memory.New()
+		handler = upload.New(failingStorage{storage}, "/uploads")
+		logs    = &bytes.Buffer{}
+		body    = &bytes.Buffer{}
+		writer  = multipart.NewWriter(body)
+	)
+	handler.ErrorLog = log.New(logs, "", 0)
+
+	for _, filename := range []string{"a.txt", "fail.txt"} {
+		part, _ := writer.CreateFormFile("file", filename)
+		part.Write([]byte(filename))
+	}
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	var result response
+	json.Unmarshal(recorder.Body.Bytes(), &result)
+	if recorder.Code != http.StatusInternalServerError || result.Error != http.StatusText(http.StatusInternalServerError) {
+		t.Errorf("internal errors should be replied without details, but got %v %+v", recorder.Code, result)
+	}
+	if !strings.Contains(logs.String(), "/srv/secret") {
+		t.Errorf("internal errors should be logged, but got %q", logs.String())
+	}
+	if objects, _ := storage.List("/uploads"); len(objects) != 0 || len(result.Files) != 0 {
+		t.Errorf("files stored before the failure should be removed, but got %v %+v", objects, result.Files)
+	}
+}
+
+func TestUploadField(t *testing.T) {
+	storage := memory.New()
+	handler := upload.New(storage, "/")
+	handler.Field = "file"
+
+	_, result := post(t, handler, map[string][]byte{"file:a.txt": []byte("a"), "other:b.txt": []byte("b")})
+	if len(result.Files) != 1 || result.Files[0].Path != "/a.txt" {
+		t.Errorf("only files of Field should be stored, but got %+v", result)
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	for filename, want := range map[string]string{
+		"report.pdf":                       "report.pdf",
+		`C:\Users\me\report.pdf`:           "report.pdf",
+		"../../etc/passwd":                 "passwd",
+		"my file\t(1).txt":                 "my-file-(1).txt",
+		`a<b>c:"d"|e?f*.txt`:               "a_b_c__d__e_f_.txt",
+		"..hidden":                         "hidden",
+		"trailing. ":                       "trailing",
+		"":                                 "file",
+		"..":                               "file",
+		"bad\x00name.txt":                  "bad_name.txt",
+		"invalid\xffutf8.txt":              "invalid_utf8.txt",
+		strings.Repeat("é", 200) + ".jpeg": strings.Repeat("é", 125) + ".jpeg",
+	} {
+		if got := upload.SanitizeFilename(filename); got != want {
+			t.Errorf("SanitizeFilename(%q) should be %q, but got %q", filename, want, got)
+		}
+	}
+}
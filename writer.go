@@ -0,0 +1,93 @@
+package ofs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrAborted returned by writes into a Writer that has been aborted
+var ErrAborted = errors.New("ofs: write aborted")
+
+// Writer writes an object into storage, Close commits the object and reports the final error, Abort discards the partial object
+type Writer interface {
+	io.WriteCloser
+	Abort() error
+}
+
+// WriterOpener implemented by storages that could be written into
+type WriterOpener interface {
+	OpenWriter(path string, options *PutOptions) (Writer, error)
+}
+
+// OpenWriter open a writer to store an object into given path, storages that don't implement WriterOpener are written with Put through a pipe,
+// in this case Abort relies on the storage's Put failing when its reader returns an error
+func OpenWriter(storage StorageInterface, path string, options *PutOptions) (Writer, error) {
+	if opener, ok := storage.(WriterOpener); ok {
+		return opener.OpenWriter(path, options)
+	}
+
+	if _, ok := storage.(OptionsPutter); !ok && !options.IsZero() {
+		return nil, NewError("open writer", path, ErrUnsupported, nil)
+	}
+
+	return NewPipeWriter(context.Background(), func(ctx context.Context, reader io.Reader) error {
+		_, err := PutWithOptions(ctx, storage, path, reader, options)
+		return err
+	}), nil
+}
+
+// NewPipeWriter return a Writer that streams written data into put running in its own goroutine,
+// Close waits for put to finish and returns its error, Abort fails put's reader with ErrAborted and waits for put to return,
+// put's context is canceled afterwards, so put could still clean up, e.g. abort a multipart upload
+func NewPipeWriter(ctx context.Context, put func(ctx context.Context, reader io.Reader) error) Writer {
+	ctx, cancel := context.WithCancel(ctx)
+	reader, writer := io.Pipe()
+	w := &pipeWriter{writer: writer, cancel: cancel, done: make(chan struct{})}
+
+	go func() {
+		w.err = put(ctx, reader)
+		// unblock pending writes if put returned before reading everything
+		if w.err != nil {
+			reader.CloseWithError(w.err)
+		} else {
+			reader.Close()
+		}
+		close(w.done)
+	}()
+
+	return w
+}
+
+type pipeWriter struct {
+	writer *io.PipeWriter
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+	once   sync.Once
+}
+
+func (w *pipeWriter) Write(p []byte) (int, error) {
+	return w.writer.Write(p)
+}
+
+// Close finish writing and wait for the object to be stored
+func (w *pipeWriter) Close() error {
+	w.once.Do(func() {
+		w.writer.Close()
+		<-w.done
+		w.cancel()
+	})
+	return w.err
+}
+
+// Abort discard the written data
+func (w *pipeWriter) Abort() error {
+	w.once.Do(func() {
+		w.writer.CloseWithError(ErrAborted)
+		<-w.done
+		w.cancel()
+	})
+	return nil
+}